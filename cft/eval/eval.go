@@ -0,0 +1,355 @@
+// Package eval evaluates CloudFormation intrinsic functions locally,
+// using supplied values for parameters and pseudo-parameters.
+//
+// Anything that cannot be resolved without deploying the template, such as a
+// Ref to a resource or a Fn::GetAtt, is left in place. Functions that depend
+// on unresolved values are also left in place, with their arguments
+// evaluated as far as possible.
+//
+// Supported:
+//
+//	Ref
+//	Fn::Sub
+//	Fn::Join
+//	Fn::Select
+//	Fn::Split
+//	Fn::FindInMap
+//	Fn::If
+//	Fn::Equals, Fn::And, Fn::Or, Fn::Not
+//	Fn::Base64
+//	Fn::Cidr
+//	Fn::GetAZs
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// Options holds the values that are known when a template is evaluated
+type Options struct {
+	// Parameters are the values for template parameters.
+	// Parameters that are not set here use their Default, if it has one.
+	Parameters map[string]string
+
+	// PseudoParameters are values for pseudo-parameters like AWS::Region.
+	// The keys include the AWS:: prefix. AWS::Partition and AWS::URLSuffix
+	// are derived from AWS::Region if they are not set.
+	PseudoParameters map[string]string
+
+	// AZs is the list of availability zones returned by Fn::GetAZs
+	// for the current region. Fn::GetAZs is not resolved if this is empty.
+	AZs []string
+}
+
+// Context evaluates nodes from a single template
+type Context struct {
+	parameters map[string]*yaml.Node
+	pseudo     map[string]string
+	azs        []string
+	mappings   *yaml.Node
+	conditions *yaml.Node
+
+	// results stores each condition once it has been evaluated.
+	// A condition that is in the map but not in known is unresolved.
+	results map[string]bool
+	known   map[string]bool
+	visited map[string]bool
+}
+
+const noValue = "AWS::NoValue"
+
+// NewContext creates a Context for the template
+func NewContext(t *cft.Template, opts Options) *Context {
+	c := &Context{
+		parameters: make(map[string]*yaml.Node),
+		pseudo:     make(map[string]string),
+		azs:        opts.AZs,
+		results:    make(map[string]bool),
+		known:      make(map[string]bool),
+		visited:    make(map[string]bool),
+	}
+
+	for k, v := range opts.PseudoParameters {
+		c.pseudo[k] = v
+	}
+	if region, ok := c.pseudo["AWS::Region"]; ok {
+		if _, ok := c.pseudo["AWS::Partition"]; !ok {
+			c.pseudo["AWS::Partition"] = partition(region)
+		}
+		if _, ok := c.pseudo["AWS::URLSuffix"]; !ok {
+			c.pseudo["AWS::URLSuffix"] = urlSuffix(region)
+		}
+	}
+
+	c.mappings, _ = t.GetSection(cft.Mappings)
+	c.conditions, _ = t.GetSection(cft.Conditions)
+
+	params, err := t.GetSection(cft.Parameters)
+	if err != nil {
+		return c
+	}
+	for i := 0; i < len(params.Content); i += 2 {
+		name := params.Content[i].Value
+		param := params.Content[i+1]
+
+		value, ok := opts.Parameters[name]
+		if !ok {
+			_, def, _ := s11n.GetMapValue(param, "Default")
+			if def == nil || def.Kind != yaml.ScalarNode {
+				continue
+			}
+			value = def.Value
+		}
+
+		paramType := s11n.GetValue(param, "Type")
+		switch {
+		case strings.HasPrefix(paramType, "AWS::SSM::Parameter::Value"):
+			// The value is looked up in SSM at deploy time
+			continue
+		case paramType == "CommaDelimitedList" || strings.HasPrefix(paramType, "List<"):
+			items := strings.Split(value, ",")
+			for i := range items {
+				items[i] = strings.TrimSpace(items[i])
+			}
+			c.parameters[name] = node.MakeSequence(items)
+		default:
+			c.parameters[name] = node.MakeScalar(value)
+		}
+	}
+
+	return c
+}
+
+// partition returns the partition for a region
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+	return "aws"
+}
+
+// urlSuffix returns the domain suffix for a region
+func urlSuffix(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
+
+// Template returns a copy of the template with everything that can be
+// resolved using opts evaluated. Resources and Outputs with a Condition
+// that is false are removed, along with the Conditions section if
+// every condition could be resolved.
+func Template(t *cft.Template, opts Options) (*cft.Template, error) {
+	rendered := &cft.Template{Node: node.Clone(t.Node)}
+	c := NewContext(rendered, opts)
+
+	allResolved := true
+	if c.conditions != nil {
+		for i := 0; i < len(c.conditions.Content); i += 2 {
+			if _, known, err := c.Condition(c.conditions.Content[i].Value); err != nil {
+				return nil, err
+			} else if !known {
+				allResolved = false
+			}
+		}
+	}
+
+	for _, section := range []cft.Section{cft.Resources, cft.Outputs} {
+		s, err := rendered.GetSection(section)
+		if err != nil {
+			continue
+		}
+		content := make([]*yaml.Node, 0, len(s.Content))
+		for i := 0; i < len(s.Content); i += 2 {
+			name := s.Content[i]
+			item := s.Content[i+1]
+
+			_, cond, _ := s11n.GetMapValue(item, "Condition")
+			if cond != nil && cond.Kind == yaml.ScalarNode {
+				value, known, err := c.Condition(cond.Value)
+				if err != nil {
+					return nil, err
+				}
+				if known && !value {
+					continue
+				}
+				if known {
+					node.RemoveFromMap(item, "Condition")
+				}
+			}
+
+			evaluated, err := c.Eval(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", section, name.Value, err)
+			}
+			if evaluated == nil {
+				continue
+			}
+			content = append(content, name, evaluated)
+		}
+		s.Content = content
+	}
+
+	if allResolved {
+		rendered.RemoveSection(cft.Conditions)
+	}
+
+	return rendered, nil
+}
+
+// Eval returns a copy of n with intrinsic functions evaluated.
+// It returns nil if the node evaluates to AWS::NoValue.
+func (c *Context) Eval(n *yaml.Node) (*yaml.Node, error) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		out := node.Clone(n)
+		out.Content = make([]*yaml.Node, 0, len(n.Content))
+		for _, item := range n.Content {
+			evaluated, err := c.Eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if evaluated != nil {
+				out.Content = append(out.Content, evaluated)
+			}
+		}
+		return out, nil
+	case yaml.MappingNode:
+		if len(n.Content) == 2 {
+			if fn, ok := functions[n.Content[0].Value]; ok {
+				return fn(c, n)
+			}
+		}
+		out := node.Clone(n)
+		out.Content = make([]*yaml.Node, 0, len(n.Content))
+		for i := 0; i < len(n.Content); i += 2 {
+			evaluated, err := c.Eval(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if evaluated != nil {
+				out.Content = append(out.Content, node.Clone(n.Content[i]), evaluated)
+			}
+		}
+		return out, nil
+	}
+	return node.Clone(n), nil
+}
+
+// Condition returns the value of a condition from the Conditions section.
+// known is false if the condition depends on something that is not known.
+func (c *Context) Condition(name string) (value bool, known bool, err error) {
+	if v, ok := c.results[name]; ok {
+		return v, c.known[name], nil
+	}
+	if c.visited[name] {
+		return false, false, fmt.Errorf("circular dependency in condition %s", name)
+	}
+	c.visited[name] = true
+
+	var expr *yaml.Node
+	if c.conditions != nil {
+		_, expr, _ = s11n.GetMapValue(c.conditions, name)
+	}
+	if expr == nil {
+		return false, false, fmt.Errorf("condition %s not found", name)
+	}
+
+	value, known, err = c.evalCondition(expr)
+	if err != nil {
+		return false, false, fmt.Errorf("condition %s: %v", name, err)
+	}
+	c.results[name] = value
+	c.known[name] = known
+	return value, known, nil
+}
+
+// evalCondition evaluates a condition function
+func (c *Context) evalCondition(n *yaml.Node) (bool, bool, error) {
+	if n.Kind != yaml.MappingNode || len(n.Content) != 2 {
+		return false, false, fmt.Errorf("invalid condition: %s", node.ToSJson(n))
+	}
+	args := n.Content[1]
+
+	switch n.Content[0].Value {
+	case "Condition":
+		return c.Condition(args.Value)
+	case "Fn::Equals":
+		if args.Kind != yaml.SequenceNode || len(args.Content) != 2 {
+			return false, false, fmt.Errorf("Fn::Equals requires two values")
+		}
+		a, err := c.Eval(args.Content[0])
+		if err != nil {
+			return false, false, err
+		}
+		b, err := c.Eval(args.Content[1])
+		if err != nil {
+			return false, false, err
+		}
+		if a == nil || b == nil || !IsStatic(a) || !IsStatic(b) {
+			return false, false, nil
+		}
+		if a.Kind == yaml.ScalarNode && b.Kind == yaml.ScalarNode {
+			return a.Value == b.Value, true, nil
+		}
+		return node.ToSJson(a) == node.ToSJson(b), true, nil
+	case "Fn::Not":
+		if args.Kind != yaml.SequenceNode || len(args.Content) != 1 {
+			return false, false, fmt.Errorf("Fn::Not requires one condition")
+		}
+		v, known, err := c.evalCondition(args.Content[0])
+		return !v, known, err
+	case "Fn::And", "Fn::Or":
+		if args.Kind != yaml.SequenceNode {
+			return false, false, fmt.Errorf("%s requires a list of conditions", n.Content[0].Value)
+		}
+		// And is false if anything is false, Or is true if anything is true
+		decisive := n.Content[0].Value == "Fn::Or"
+		allKnown := true
+		for _, arg := range args.Content {
+			v, known, err := c.evalCondition(arg)
+			if err != nil {
+				return false, false, err
+			}
+			if known && v == decisive {
+				return decisive, true, nil
+			}
+			if !known {
+				allKnown = false
+			}
+		}
+		return !decisive, allKnown, nil
+	}
+
+	return false, false, fmt.Errorf("unexpected condition function %s", n.Content[0].Value)
+}
+
+// IsStatic returns true if the node does not contain any intrinsic functions
+func IsStatic(n *yaml.Node) bool {
+	if n.Kind == yaml.MappingNode && len(n.Content) == 2 {
+		k := n.Content[0].Value
+		if k == "Ref" || k == "Condition" || strings.HasPrefix(k, "Fn::") {
+			return false
+		}
+	}
+	for _, c := range n.Content {
+		if !IsStatic(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package eval_test
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/eval"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+)
+
+const source = `
+Parameters:
+  Env:
+    Type: String
+    Default: dev
+  Subnets:
+    Type: CommaDelimitedList
+  Name:
+    Type: String
+
+Mappings:
+  Sizes:
+    prod:
+      Instance: m5.large
+    dev:
+      Instance: t3.micro
+
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+  IsNotProd: !Not [!Condition IsProd]
+  HasName: !Not [!Equals [!Ref Name, ""]]
+
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub ${Env}-${AWS::Region}-${AWS::AccountId}
+      Tags:
+        - Key: Size
+          Value: !FindInMap [Sizes, !Ref Env, Instance]
+        - Key: Zones
+          Value: !Join [",", !GetAZs ""]
+        - Key: Second
+          Value: !Select [1, !Ref Subnets]
+        - Key: Data
+          Value: !Base64 hello
+      LoggingConfiguration: !If [IsProd, {DestinationBucketName: logs}, !Ref AWS::NoValue]
+      Name: !If [HasName, !Ref Name, !Ref AWS::NoValue]
+  Alarm:
+    Type: AWS::CloudWatch::Alarm
+    Condition: IsProd
+  Queue:
+    Type: AWS::SQS::Queue
+    Condition: IsNotProd
+    Properties:
+      QueueName: !Sub
+        - ${Prefix}-${Bucket}-${!Literal}
+        - Prefix: !Select [0, !Split ["-", a-b]]
+      Cidrs: !Cidr [10.0.0.0/16, 3, 8]
+`
+
+const expected = `Parameters:
+  Env:
+    Type: String
+    Default: dev
+
+  Subnets:
+    Type: CommaDelimitedList
+
+  Name:
+    Type: String
+
+Mappings:
+  Sizes:
+    prod:
+      Instance: m5.large
+    dev:
+      Instance: t3.micro
+
+Conditions:
+  IsProd: !Equals
+    - !Ref Env
+    - prod
+
+  IsNotProd: !Not
+    - !Condition IsProd
+
+  HasName: !Not
+    - !Equals
+      - !Ref Name
+      - ""
+
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub dev-us-east-1-${AWS::AccountId}
+      Tags:
+        - Key: Size
+          Value: t3.micro
+        - Key: Zones
+          Value: us-east-1a,us-east-1b
+        - Key: Second
+          Value: b
+        - Key: Data
+          Value: aGVsbG8=
+      Name: !If
+        - HasName
+        - !Ref Name
+        - !Ref AWS::NoValue
+
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !Sub a-${Bucket}-${!Literal}
+      Cidrs:
+        - 10.0.0.0/24
+        - 10.0.1.0/24
+        - 10.0.2.0/24
+`
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := parse.String(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := eval.Template(tmpl, eval.Options{
+		Parameters:       map[string]string{"Subnets": "a, b, c"},
+		PseudoParameters: map[string]string{"AWS::Region": "us-east-1"},
+		AZs:              []string{"us-east-1a", "us-east-1b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := format.String(rendered, format.Options{Unsorted: true})
+	if actual != expected {
+		t.Errorf("unexpected output:\n%s", actual)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	tmpl, err := parse.String(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := eval.NewContext(tmpl, eval.Options{Parameters: map[string]string{"Env": "prod"}})
+
+	value, known, err := c.Condition("IsNotProd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !known || value {
+		t.Errorf("expected IsNotProd to be false, got %v (known: %v)", value, known)
+	}
+
+	_, known, err = c.Condition("HasName")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known {
+		t.Errorf("expected HasName to be unresolved")
+	}
+
+	if _, _, err := c.Condition("Missing"); err == nil {
+		t.Errorf("expected an error for a missing condition")
+	}
+}
+
+func TestCidr(t *testing.T) {
+	blocks, err := eval.Cidr("2001:db8::/56", 2, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks[0] != "2001:db8::/64" || blocks[1] != "2001:db8:0:1::/64" {
+		t.Errorf("unexpected blocks: %v", blocks)
+	}
+
+	if _, err := eval.Cidr("10.0.0.0/24", 3, 7); err == nil {
+		t.Errorf("expected an error when the subnets do not fit")
+	}
+}
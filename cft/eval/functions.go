@@ -0,0 +1,392 @@
+package eval
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// evalFunc evaluates a mapping node with a single intrinsic function key
+type evalFunc func(c *Context, n *yaml.Node) (*yaml.Node, error)
+
+var functions map[string]evalFunc
+
+func init() {
+	functions = map[string]evalFunc{
+		"Ref":           evalRef,
+		"Fn::Sub":       evalSub,
+		"Fn::Join":      evalJoin,
+		"Fn::Select":    evalSelect,
+		"Fn::Split":     evalSplit,
+		"Fn::FindInMap": evalFindInMap,
+		"Fn::If":        evalIf,
+		"Fn::Base64":    evalBase64,
+		"Fn::Cidr":      evalCidr,
+		"Fn::GetAZs":    evalGetAZs,
+	}
+}
+
+// symbolic returns the function with its evaluated arguments,
+// for when the function itself cannot be resolved
+func symbolic(n *yaml.Node, args *yaml.Node) *yaml.Node {
+	out := node.Clone(n)
+	out.Content[1] = args
+	return out
+}
+
+// args evaluates the arguments to a function
+func args(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := c.Eval(n.Content[1])
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("%s cannot be AWS::NoValue", n.Content[0].Value)
+	}
+	return a, nil
+}
+
+// scalars returns true if a is a sequence of at least min scalars
+func scalars(a *yaml.Node, min int) bool {
+	if a.Kind != yaml.SequenceNode || len(a.Content) < min {
+		return false
+	}
+	for _, item := range a.Content[:min] {
+		if item.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the value of a parameter or pseudo-parameter, or nil
+func (c *Context) lookup(name string) *yaml.Node {
+	if v, ok := c.pseudo[name]; ok {
+		return node.MakeScalar(v)
+	}
+	if v, ok := c.parameters[name]; ok {
+		return node.Clone(v)
+	}
+	return nil
+}
+
+func evalRef(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	name := n.Content[1]
+	if name.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("Ref must be a string")
+	}
+	if name.Value == noValue {
+		return nil, nil
+	}
+	if v := c.lookup(name.Value); v != nil {
+		return v, nil
+	}
+	return node.Clone(n), nil
+}
+
+func evalSub(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a := n.Content[1]
+
+	str := a
+	var vars *yaml.Node
+	if a.Kind == yaml.SequenceNode {
+		if len(a.Content) != 2 || a.Content[1].Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("Fn::Sub requires a string and a map of variables")
+		}
+		str = a.Content[0]
+		vars = a.Content[1]
+	}
+	if str.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("Fn::Sub requires a string")
+	}
+
+	words, err := parse.ParseSub(str.Value, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Evaluate the variables first, keeping the ones that
+	// are still referenced if they can't be resolved
+	values := make(map[string]*yaml.Node)
+	if vars != nil {
+		for i := 0; i < len(vars.Content); i += 2 {
+			v, err := c.Eval(vars.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, fmt.Errorf("Fn::Sub variable %s cannot be AWS::NoValue", vars.Content[i].Value)
+			}
+			values[vars.Content[i].Value] = v
+		}
+	}
+
+	// sb is the new Sub string, which needs literal ${ escaped,
+	// and raw is the result if everything can be resolved
+	keep := node.MakeMapping()
+	unresolved := false
+	var sb, raw strings.Builder
+	for _, word := range words {
+		var name string
+		switch word.T {
+		case parse.STR:
+			sb.WriteString(strings.ReplaceAll(word.W, "${", "${!"))
+			raw.WriteString(word.W)
+			continue
+		case parse.AWS:
+			name = "AWS::" + word.W
+		case parse.RAIN:
+			name = "Rain::" + word.W
+		default:
+			name = word.W
+		}
+
+		var v *yaml.Node
+		if value, ok := values[name]; ok {
+			v = value
+			if v.Kind != yaml.ScalarNode {
+				if _, existing, _ := s11n.GetMapValue(keep, name); existing == nil {
+					keep.Content = append(keep.Content, node.MakeScalar(name), v)
+				}
+			}
+		} else if word.T == parse.REF || word.T == parse.AWS {
+			v = c.lookup(name)
+		}
+
+		if v != nil && v.Kind == yaml.ScalarNode {
+			sb.WriteString(strings.ReplaceAll(v.Value, "${", "${!"))
+			raw.WriteString(v.Value)
+		} else {
+			sb.WriteString("${" + name + "}")
+			unresolved = true
+		}
+	}
+
+	if !unresolved {
+		return node.MakeScalar(raw.String()), nil
+	}
+
+	if len(keep.Content) == 0 {
+		return symbolic(n, node.MakeScalar(sb.String())), nil
+	}
+	out := &yaml.Node{Kind: yaml.SequenceNode}
+	out.Content = append(out.Content, node.MakeScalar(sb.String()), keep)
+	return symbolic(n, out), nil
+}
+
+func evalJoin(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.SequenceNode || len(a.Content) != 2 {
+		return nil, fmt.Errorf("Fn::Join requires a delimiter and a list")
+	}
+	list := a.Content[1]
+	if a.Content[0].Kind != yaml.ScalarNode || list.Kind != yaml.SequenceNode ||
+		!scalars(list, len(list.Content)) {
+		return symbolic(n, a), nil
+	}
+	return node.MakeScalar(strings.Join(node.SequenceToStrings(list), a.Content[0].Value)), nil
+}
+
+func evalSelect(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.SequenceNode || len(a.Content) != 2 {
+		return nil, fmt.Errorf("Fn::Select requires an index and a list")
+	}
+	list := a.Content[1]
+	if a.Content[0].Kind != yaml.ScalarNode || list.Kind != yaml.SequenceNode {
+		return symbolic(n, a), nil
+	}
+	i, err := strconv.Atoi(a.Content[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("Fn::Select index %s is not a number", a.Content[0].Value)
+	}
+	if i < 0 || i >= len(list.Content) {
+		return nil, fmt.Errorf("Fn::Select index %d is out of range", i)
+	}
+	return list.Content[i], nil
+}
+
+func evalSplit(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.SequenceNode || len(a.Content) != 2 {
+		return nil, fmt.Errorf("Fn::Split requires a delimiter and a string")
+	}
+	if !scalars(a, 2) {
+		return symbolic(n, a), nil
+	}
+	return node.MakeSequence(strings.Split(a.Content[1].Value, a.Content[0].Value)), nil
+}
+
+func evalFindInMap(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.SequenceNode || len(a.Content) < 3 || len(a.Content) > 4 {
+		return nil, fmt.Errorf("Fn::FindInMap requires a map name and two keys")
+	}
+	if !scalars(a, 3) {
+		return symbolic(n, a), nil
+	}
+	if c.mappings == nil {
+		return nil, fmt.Errorf("Fn::FindInMap: the template does not have a Mappings section")
+	}
+
+	current := c.mappings
+	for _, key := range a.Content[:3] {
+		_, current, _ = s11n.GetMapValue(current, key.Value)
+		if current == nil {
+			break
+		}
+	}
+	if current != nil {
+		return node.Clone(current), nil
+	}
+
+	// The language extensions transform adds an optional default
+	if len(a.Content) == 4 {
+		_, def, _ := s11n.GetMapValue(a.Content[3], "DefaultValue")
+		if def != nil {
+			return def, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Fn::FindInMap: %s not found in Mappings",
+		strings.Join(node.SequenceToStrings(&yaml.Node{Content: a.Content[:3]}), "."))
+}
+
+func evalIf(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a := n.Content[1]
+	if a.Kind != yaml.SequenceNode || len(a.Content) != 3 || a.Content[0].Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("Fn::If requires a condition name and two values")
+	}
+
+	value, known, err := c.Condition(a.Content[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	if known {
+		if value {
+			return c.Eval(a.Content[1])
+		}
+		return c.Eval(a.Content[2])
+	}
+
+	out := &yaml.Node{Kind: yaml.SequenceNode}
+	out.Content = append(out.Content, node.Clone(a.Content[0]))
+	for _, branch := range a.Content[1:] {
+		v, err := c.Eval(branch)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			v = node.MakeRef(noValue)
+		}
+		out.Content = append(out.Content, v)
+	}
+	return symbolic(n, out), nil
+}
+
+func evalBase64(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.ScalarNode {
+		return symbolic(n, a), nil
+	}
+	return node.MakeScalar(base64.StdEncoding.EncodeToString([]byte(a.Value))), nil
+}
+
+func evalCidr(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.SequenceNode || len(a.Content) != 3 {
+		return nil, fmt.Errorf("Fn::Cidr requires an ip block, a count, and the number of subnet bits")
+	}
+	if !scalars(a, 3) {
+		return symbolic(n, a), nil
+	}
+	count, err := strconv.Atoi(a.Content[1].Value)
+	if err != nil {
+		return nil, fmt.Errorf("Fn::Cidr count %s is not a number", a.Content[1].Value)
+	}
+	bits, err := strconv.Atoi(a.Content[2].Value)
+	if err != nil {
+		return nil, fmt.Errorf("Fn::Cidr cidrBits %s is not a number", a.Content[2].Value)
+	}
+	blocks, err := Cidr(a.Content[0].Value, count, bits)
+	if err != nil {
+		return nil, err
+	}
+	return node.MakeSequence(blocks), nil
+}
+
+// Cidr returns count CIDR blocks from ipBlock, each with cidrBits host bits
+func Cidr(ipBlock string, count int, cidrBits int) ([]string, error) {
+	_, network, err := net.ParseCIDR(ipBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Fn::Cidr: %v", err)
+	}
+	if count < 1 || count > 256 {
+		return nil, fmt.Errorf("Fn::Cidr count must be between 1 and 256")
+	}
+
+	ones, size := network.Mask.Size()
+	prefix := size - cidrBits
+	if cidrBits < 1 || prefix < ones {
+		return nil, fmt.Errorf("Fn::Cidr cidrBits %d does not fit in %s", cidrBits, ipBlock)
+	}
+	available := new(big.Int).Lsh(big.NewInt(1), uint(prefix-ones))
+	if available.Cmp(big.NewInt(int64(count))) < 0 {
+		return nil, fmt.Errorf("Fn::Cidr %s only has room for %v subnets", ipBlock, available)
+	}
+
+	ip := network.IP
+	if size == 32 {
+		ip = ip.To4()
+	}
+	start := new(big.Int).SetBytes(ip)
+	step := new(big.Int).Lsh(big.NewInt(1), uint(cidrBits))
+
+	retval := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		addr := new(big.Int).Add(start, new(big.Int).Mul(step, big.NewInt(int64(i))))
+		b := addr.FillBytes(make([]byte, size/8))
+		retval = append(retval, fmt.Sprintf("%s/%d", net.IP(b), prefix))
+	}
+	return retval, nil
+}
+
+func evalGetAZs(c *Context, n *yaml.Node) (*yaml.Node, error) {
+	a, err := args(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if a.Kind != yaml.ScalarNode || len(c.azs) == 0 {
+		return symbolic(n, a), nil
+	}
+	if a.Value != "" && a.Value != c.pseudo["AWS::Region"] {
+		return symbolic(n, a), nil
+	}
+	return node.MakeSequence(c.azs), nil
+}
@@ -761,6 +761,34 @@ Resources:
 
 }
 
+func TestCustomDirectiveTag(t *testing.T) {
+	input := `
+Resources:
+  Instance:
+    Type: AWS::EC2::Instance
+    Properties:
+      ImageId: !Rain::Custom::Ami al2023
+`
+
+	source, err := parse.String(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := format.String(source, format.Options{
+		JSON:     false,
+		Unsorted: true,
+	})
+
+	if err = parse.Verify(source, output); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(output) != strings.TrimSpace(input) {
+		t.Fatalf("Got:\n%s\n\nExpected:\n%s", output, input)
+	}
+}
+
 func TestPkl(t *testing.T) {
 	source := `
 Resources:
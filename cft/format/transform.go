@@ -35,46 +35,44 @@ func formatNode(n *yaml.Node) *yaml.Node {
 		if len(n.Content) == 2 {
 
 			// Is the key relevant?
-			for tag, funcName := range cft.Tags {
-				if n.Content[0].Value == funcName {
-					// Prepare comments
-					headComments := []string{n.HeadComment, n.Content[0].HeadComment, n.Content[1].HeadComment}
-					lineComments := []string{n.LineComment, n.Content[0].LineComment, n.Content[1].LineComment}
-					footComments := []string{n.FootComment, n.Content[0].FootComment, n.Content[1].FootComment}
-
-					n = n.Content[1]
-					n.Tag = tag
-
-					// Is it a GetAtt and is currently a sequence?
-					if funcName == "Fn::GetAtt" && n.Kind == yaml.SequenceNode {
-						// Are both parts scalars?
-						allScalar := true
-						parts := make([]string, len(n.Content))
-						for i, child := range n.Content {
-							if child.Kind != yaml.ScalarNode {
-								allScalar = false
-								break
-							}
-
-							parts[i] = child.Value
-
-							headComments = append(headComments, child.HeadComment)
-							lineComments = append(lineComments, child.LineComment)
-							footComments = append(footComments, child.FootComment)
+			if tag, ok := cft.ShortTag(n.Content[0].Value); ok {
+				funcName := n.Content[0].Value
+
+				// Prepare comments
+				headComments := []string{n.HeadComment, n.Content[0].HeadComment, n.Content[1].HeadComment}
+				lineComments := []string{n.LineComment, n.Content[0].LineComment, n.Content[1].LineComment}
+				footComments := []string{n.FootComment, n.Content[0].FootComment, n.Content[1].FootComment}
+
+				n = n.Content[1]
+				n.Tag = tag
+
+				// Is it a GetAtt and is currently a sequence?
+				if funcName == "Fn::GetAtt" && n.Kind == yaml.SequenceNode {
+					// Are both parts scalars?
+					allScalar := true
+					parts := make([]string, len(n.Content))
+					for i, child := range n.Content {
+						if child.Kind != yaml.ScalarNode {
+							allScalar = false
+							break
 						}
 
-						if allScalar {
-							n.Content = []*yaml.Node{}
-							n.Kind = yaml.ScalarNode
-							n.Value = strings.Join(parts, ".")
-						}
+						parts[i] = child.Value
+
+						headComments = append(headComments, child.HeadComment)
+						lineComments = append(lineComments, child.LineComment)
+						footComments = append(footComments, child.FootComment)
+					}
 
-						n.HeadComment = mergeComments(headComments)
-						n.LineComment = mergeComments(lineComments)
-						n.FootComment = mergeComments(footComments)
+					if allScalar {
+						n.Content = []*yaml.Node{}
+						n.Kind = yaml.ScalarNode
+						n.Value = strings.Join(parts, ".")
 					}
 
-					break
+					n.HeadComment = mergeComments(headComments)
+					n.LineComment = mergeComments(lineComments)
+					n.FootComment = mergeComments(footComments)
 				}
 			}
 		}
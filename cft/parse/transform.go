@@ -56,33 +56,29 @@ func NormalizeNode(n *yaml.Node) error {
 	}
 
 	// Convert tag-style intrinsics into map-style
-	for tag, funcName := range cft.Tags {
-		if n.ShortTag() == tag {
-			body := node.Clone(n)
-
-			// Fix empty Fn values (should never be null)
-			if body.Tag == "!!null" {
-				body.Tag = "!!str"
-			} else {
-				body.Tag = ""
-			}
+	if funcName, ok := cft.FuncName(n.ShortTag()); ok {
+		body := node.Clone(n)
+
+		// Fix empty Fn values (should never be null)
+		if body.Tag == "!!null" {
+			body.Tag = "!!str"
+		} else {
+			body.Tag = ""
+		}
 
-			// Wrap in a map
-			*n = yaml.Node{
-				Kind: yaml.MappingNode,
-				Tag:  "!!map",
-				Content: []*yaml.Node{
-					{
-						Kind:  yaml.ScalarNode,
-						Style: 0,
-						Tag:   "!!str",
-						Value: funcName,
-					},
-					body,
+		// Wrap in a map
+		*n = yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
+				{
+					Kind:  yaml.ScalarNode,
+					Style: 0,
+					Tag:   "!!str",
+					Value: funcName,
 				},
-			}
-
-			break
+				body,
+			},
 		}
 	}
 
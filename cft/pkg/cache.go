@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/internal/config"
+)
+
+// CacheDir is where downloaded modules and packages are stored between runs.
+// Content is stored by its hash, so a cached copy of a URI is only used when
+// rain.lock says which hash to expect, when the URI is known to be immutable,
+// like a GitHub release asset, or when running with Offline.
+// Set it to an empty string to disable the cache.
+var CacheDir string
+
+// Offline prevents rain from downloading modules and packages.
+// Everything must already be in the cache.
+var Offline bool
+
+// blobPath returns the path to cached content with the given hash
+func blobPath(hash string) string {
+	return filepath.Join(CacheDir, "blobs", strings.Replace(hash, ":", "-", 1))
+}
+
+// githubImmutable matches GitHub URLs that can't change once they exist:
+// release assets, and archives or raw files at a commit or tag
+var githubImmutable = regexp.MustCompile(`^https://(` +
+	`github\.com/[^/]+/[^/]+/releases/download/[^/]+/[^/]+|` +
+	`github\.com/[^/]+/[^/]+/archive/([0-9a-f]{40}|refs/tags/[^/]+)\.(zip|tar\.gz)|` +
+	`raw\.githubusercontent\.com/[^/]+/[^/]+/([0-9a-f]{40}|refs/tags/[^/]+)/.+)$`)
+
+// isImmutable returns true if uri refers to content that is not expected
+// to change, like a git source pinned to a commit or a GitHub release asset.
+// Anything else is checked against rain.lock before a cached copy is used.
+func isImmutable(uri string) bool {
+	if isGitSource(uri) {
+		src, err := parseGitSource(uri)
+		return err == nil && commitSha.MatchString(src.Ref)
+	}
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	return githubImmutable.MatchString(uri)
+}
+
+// uriPath returns the path to the file that stores the
+// hash of the content that was last downloaded from uri
+func uriPath(uri string) string {
+	return filepath.Join(CacheDir, "uris", fmt.Sprintf("%x", sha256.Sum256([]byte(uri))))
+}
+
+// readBlob returns cached content, verifying that it still matches its hash
+func readBlob(hash string) ([]byte, bool) {
+	content, err := os.ReadFile(blobPath(hash))
+	if err != nil {
+		return nil, false
+	}
+	if fmt.Sprintf("sha256:%x", sha256.Sum256(content)) != hash {
+		config.Debugf("Ignoring corrupt cache entry %s", blobPath(hash))
+		return nil, false
+	}
+	return content, true
+}
+
+// writeCache stores content downloaded from uri
+func writeCache(uri string, content []byte) error {
+	hash := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+
+	for _, dir := range []string{filepath.Dir(blobPath(hash)), filepath.Dir(uriPath(uri))} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	// Write to a temp file first so that a concurrent
+	// run never sees a partially written blob
+	tmp, err := os.CreateTemp(filepath.Dir(blobPath(hash)), "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), blobPath(hash)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.WriteFile(uriPath(uri), []byte(hash), 0644)
+}
+
+// fetch returns the content of a remote module or package from the cache,
+// or calls download and stores the result in the cache
+func fetch(uri string, download func() ([]byte, error)) ([]byte, error) {
+	if CacheDir == "" {
+		if Offline {
+			return nil, fmt.Errorf("unable to get %s: the cache is disabled in offline mode", uri)
+		}
+		return download()
+	}
+
+	// The lock file says exactly which content we need,
+	// unless we are trying to pick up a new version
+	if hash := lockedHash(uri); hash != "" && (!UpdateLock || Offline) {
+		if content, ok := readBlob(hash); ok {
+			config.Debugf("Using cached %s (%s)", uri, hash)
+			return content, nil
+		}
+	}
+
+	if Offline || (isImmutable(uri) && !UpdateLock) {
+		// Releases and commits don't change, and offline there is no other
+		// choice, so use whatever we downloaded last time
+		hash, err := os.ReadFile(uriPath(uri))
+		if err == nil {
+			if content, ok := readBlob(string(hash)); ok {
+				config.Debugf("Using cached %s (%s)", uri, hash)
+				return content, nil
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if Offline {
+		return nil, fmt.Errorf("%s is not in the module cache at %s; "+
+			"run once without --offline to download it", uri, CacheDir)
+	}
+
+	content, err := download()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeCache(uri, content); err != nil {
+		// The cache is an optimization, so don't fail the build
+		config.Debugf("Unable to cache %s: %v", uri, err)
+	}
+
+	return content, nil
+}
+
+func init() {
+	dir, err := os.UserCacheDir()
+	if err == nil {
+		CacheDir = filepath.Join(dir, "rain", "modules")
+	}
+}
@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// useCache points CacheDir at an empty directory for a test,
+// and restores the cache settings afterwards
+func useCache(t *testing.T) {
+	savedDir, savedOffline, savedUpdate := CacheDir, Offline, UpdateLock
+	t.Cleanup(func() {
+		CacheDir, Offline, UpdateLock = savedDir, savedOffline, savedUpdate
+		lock = nil
+	})
+	CacheDir = t.TempDir()
+}
+
+func TestFetchCache(t *testing.T) {
+	useCache(t)
+
+	uri := "https://example.com/modules/bucket.yaml"
+	downloads := 0
+	download := func() ([]byte, error) {
+		downloads++
+		return []byte("Resources: {}"), nil
+	}
+
+	// Offline with an empty cache fails
+	Offline = true
+	if _, err := fetch(uri, download); err == nil {
+		t.Fatal("expected an error for a module that is not cached")
+	}
+	Offline = false
+
+	// Without a lock file we always download, to pick up changes
+	for i := 0; i < 2; i++ {
+		if _, err := fetch(uri, download); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if downloads != 2 {
+		t.Errorf("expected 2 downloads, got %d", downloads)
+	}
+
+	// Offline uses the last download
+	Offline = true
+	content, err := fetch(uri, func() ([]byte, error) {
+		return nil, errors.New("should not download")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Resources: {}" {
+		t.Errorf("unexpected content: %s", content)
+	}
+	Offline = false
+
+	// With a lock file, the pinned hash comes from the cache
+	if err := loadLock(filepath.Join(t.TempDir(), LockFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLock(uri, content); err != nil {
+		t.Fatal(err)
+	}
+	lock.locked.Modules = lock.fetched
+	if _, err := fetch(uri, download); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 2 {
+		t.Errorf("expected the locked module to come from the cache")
+	}
+}
+
+func TestFetchImmutable(t *testing.T) {
+	useCache(t)
+
+	downloads := 0
+	download := func() ([]byte, error) {
+		downloads++
+		return []byte("Resources: {}"), nil
+	}
+
+	// Releases and commits are only downloaded once, even without a lock file
+	release := "https://github.com/org/repo/releases/download/v1.2.0/modules.zip"
+	for _, uri := range []string{
+		release,
+		"https://github.com/org/repo/archive/refs/tags/v1.2.0.zip",
+		"https://raw.githubusercontent.com/org/repo/0123456789abcdef0123456789abcdef01234567/bucket.yaml",
+	} {
+		downloads = 0
+		for i := 0; i < 2; i++ {
+			if _, err := fetch(uri, download); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if downloads != 1 {
+			t.Errorf("%s: expected 1 download, got %d", uri, downloads)
+		}
+	}
+
+	// Anything else might change, even if it looks like a version
+	for _, uri := range []string{
+		"s3://bucket/1.0.0/module.yaml",
+		"https://host/v2.0.0/latest.yaml",
+		"https://example.com/main/bucket.yaml?version=1.0.0",
+		"https://github.com/org/repo/archive/main.zip",
+		"https://raw.githubusercontent.com/org/repo/main/bucket.yaml",
+		"git::https://example.com/repo.git//bucket.yaml?ref=v1.0.0",
+	} {
+		if isImmutable(uri) {
+			t.Errorf("expected %s to be mutable", uri)
+		}
+	}
+	if !isImmutable("git::https://example.com/repo.git//bucket.yaml?ref=0123456789abcdef0123456789abcdef01234567") {
+		t.Error("expected a git source pinned to a commit to be immutable")
+	}
+
+	// Updating the lock file downloads again
+	UpdateLock = true
+	downloads = 0
+	if _, err := fetch(release, download); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 1 {
+		t.Errorf("expected --update-lock to download again, got %d downloads", downloads)
+	}
+}
@@ -17,6 +17,9 @@ type ModuleContent struct {
 	Content    []byte
 	NewRootDir string
 	BaseUri    string
+
+	// Path is where the content came from, for source maps
+	Path string
 }
 
 func isHttpsUrl(uri string) bool {
@@ -57,6 +60,7 @@ func getModuleContent(
 	var content []byte
 	var err error
 	var newRootDir string
+	var source string
 
 	// Check to see if this is an alias like "$alias/foo.yaml" (new format)
 	isZip := false
@@ -76,9 +80,10 @@ func getModuleContent(
 						if err != nil {
 							return nil, err
 						}
+						source = zipLocation + "/" + path
 					} else {
 						// Replace the alias with the actual location
-						uri = packageAlias.Location + "/" + path
+						uri = packagePath(packageAlias.Location, path)
 					}
 				} else {
 					config.Debugf("Package alias not found: %s", alias)
@@ -91,7 +96,7 @@ func getModuleContent(
 
 	// Look for a zip path where we already fixed the $alias
 	// getModuleContent: root=cft/pkg/tmpl/awscli-modules, baseUri=, uri=package.zip/zip-module.yaml
-	if strings.Contains(uri, ".zip/") {
+	if strings.Contains(uri, ".zip/") && !isGitSource(uri) {
 		isZip = true
 
 		// Extract the zip location and path within the zip
@@ -108,6 +113,7 @@ func getModuleContent(
 			if err != nil {
 				return nil, err
 			}
+			source = zipLocation + "/" + zipPath
 		}
 	}
 
@@ -124,8 +130,9 @@ func getModuleContent(
 				if err != nil {
 					return nil, err
 				}
+				source = zipLocation + "/" + path
 			} else {
-				uri = strings.Replace(uri, packageAlias.Alias, packageAlias.Location, 1)
+				uri = packagePath(packageAlias.Location, path)
 			}
 		}
 	}
@@ -133,12 +140,22 @@ func getModuleContent(
 	// Is this a local file or a URL or did we already unzip a package?
 	if isZip {
 		config.Debugf("Using content from a zipped module package (length: %d bytes)", len(content))
+	} else if isGitSource(uri) {
+		config.Debugf("Checking out from git: %s", uri)
+
+		// Relative paths in the module are resolved in the checkout
+		content, newRootDir, err = getGitContent(uri)
+		if err != nil {
+			return nil, err
+		}
+		source = uri
 	} else if isHttpsUrl(uri) || isS3URI(uri) {
 		config.Debugf("Downloading from URL: %s", uri)
 		content, err = downloadModule(uri)
 		if err != nil {
 			return nil, err
 		}
+		source = uri
 
 		// Once we see a URL instead of a relative local path,
 		// we need to remember the base URL so that we can
@@ -157,6 +174,7 @@ func getModuleContent(
 			if err != nil {
 				return nil, err
 			}
+			source = uri
 		} else if templateFiles != nil {
 			// Read from the embedded file system (for the build -r command)
 			// We have to hack this since embed doesn't understand "path/../"
@@ -168,6 +186,7 @@ func getModuleContent(
 				return nil, err
 			}
 			newRootDir = filepath.Dir(embeddedPath)
+			source = embeddedPath
 		} else {
 			// Read the local file
 			path := uri
@@ -190,10 +209,11 @@ func getModuleContent(
 				return nil, err
 			}
 			newRootDir = filepath.Dir(path)
+			source = path
 		}
 	}
 
-	retval := &ModuleContent{content, newRootDir, baseUri}
+	retval := &ModuleContent{content, newRootDir, baseUri, source}
 	contentCache[cacheKey] = retval
 	return retval, nil
 }
@@ -35,6 +35,7 @@ type s3Options struct {
 	Format         s3Format `yaml:"Format"`
 	Run            string   `yaml:"Run"`
 	Extension      string   `yaml:"Extension"`
+	Exclude        []string `yaml:"Exclude"`
 }
 
 type directiveContext struct {
@@ -156,7 +157,7 @@ func handleS3(root string, options s3Options) (*yaml.Node, error) {
 		}
 	}
 
-	s, err := upload(root, options.Path, options.Zip, options.Extension)
+	s, err := upload(root, options.Path, options.Zip, options.Extension, options.Exclude)
 	if err != nil {
 		return nil, err
 	}
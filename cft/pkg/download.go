@@ -54,30 +54,12 @@ func DownloadFromZip(uriString string, verifyHash string, path string) ([]byte,
 	isS3 := isS3URI(uriString)
 
 	// Check if it's an S3 URI, HTTPS URL, or local file
-	if isS3 {
-		// Download from S3
-		config.Debugf("Downloading from S3: %s", uriString)
-		zipData, err = downloadS3(uriString)
+	if isS3 || isUrl {
+		zipData, err = fetch(uriString, func() ([]byte, error) {
+			return download(uriString)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to download zip from S3: %v", err)
-		}
-	} else if isUrl {
-		// Download from URL
-		config.Debugf("Downloading %s", uriString)
-		resp, err := http.Get(uriString)
-		if err != nil {
-			return nil, err
-		}
-		defer func(Body io.ReadCloser) {
-			err := Body.Close()
-			if err != nil {
-				config.Debugf("Error closing body: %v", err)
-			}
-		}(resp.Body)
-
-		zipData, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to download zip: %v", err)
 		}
 	} else {
 		// Read local file
@@ -88,6 +70,10 @@ func DownloadFromZip(uriString string, verifyHash string, path string) ([]byte,
 		}
 	}
 
+	if err := checkLock(uriString, zipData); err != nil {
+		return nil, err
+	}
+
 	// Save the zip data to a temp file
 	pFile, err := os.CreateTemp("", "rain-package-*.zip")
 	if err != nil {
@@ -247,11 +233,28 @@ func downloadS3(uri string) ([]byte, error) {
 }
 
 // downloadModule downloads the file from the given URI and returns its content as a byte slice.
+// The content comes from the module cache if it is already there.
 func downloadModule(uri string) ([]byte, error) {
+	content, err := fetch(uri, func() ([]byte, error) {
+		return download(uri)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkLock(uri, content); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// download gets the content of an S3 or HTTPS URI
+func download(uri string) ([]byte, error) {
 	config.Debugf("Downloading %s", uri)
 
 	// If it's an S3 uri, use the s3 package to download the file
-	if strings.HasPrefix(uri, "s3://") {
+	if isS3URI(uri) {
 		return downloadS3(uri)
 	}
 
@@ -266,10 +269,9 @@ func downloadModule(uri string) ([]byte, error) {
 		}
 	}(resp.Body)
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download %s: %s", uri, resp.Status)
 	}
 
-	return content, nil
+	return io.ReadAll(resp.Body)
 }
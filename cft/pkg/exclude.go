@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// excludePattern is one line of a .gitignore-style list of patterns
+type excludePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// excluder decides which files to leave out of a zip archive
+type excluder []excludePattern
+
+// newExcluder compiles .gitignore-style patterns. Patterns without a slash
+// match at any depth, patterns that end with a slash only match directories,
+// ** matches any number of directories, and ! re-includes a path that was
+// excluded by an earlier pattern.
+func newExcluder(patterns []string) (excluder, error) {
+	ex := make(excluder, 0)
+
+	for _, line := range patterns {
+		p := strings.TrimSpace(line)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		pattern := excludePattern{}
+		if strings.HasPrefix(p, "!") {
+			pattern.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			pattern.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+
+		// A slash anywhere but the end anchors the pattern to the root
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			return nil, fmt.Errorf("invalid exclude pattern: %q", line)
+		}
+
+		prefix := "^(?:.*/)?"
+		if anchored {
+			prefix = "^"
+		}
+		re, err := regexp.Compile(prefix + globToRegexp(p) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %v", line, err)
+		}
+		pattern.re = re
+
+		ex = append(ex, pattern)
+	}
+
+	return ex, nil
+}
+
+// globToRegexp converts a glob with * ? [] and ** to a regular expression
+func globToRegexp(glob string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			out.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			out.WriteString(".*")
+			i++
+		case c == '*':
+			out.WriteString("[^/]*")
+		case c == '?':
+			out.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				out.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			out.WriteString("[" + class + "]")
+			i += end
+		default:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return out.String()
+}
+
+// excluded returns true if the slash-separated path, which is relative
+// to the root of the archive, should be left out. The last pattern
+// that matches wins.
+func (ex excluder) excluded(path string, isDir bool) bool {
+	retval := false
+	for _, pattern := range ex {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.re.MatchString(path) {
+			retval = !pattern.negate
+		}
+	}
+	return retval
+}
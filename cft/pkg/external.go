@@ -0,0 +1,212 @@
+package pkg
+
+// This file implements directives that are defined by a project, like
+// !Rain::Custom::Ami, which run an executable to produce their output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/cft/visitor"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// Directives is the name of the entry in the Rain section that maps
+// the names of custom directives to executables
+const Directives = "Directives"
+
+// DirectivesFile is the path to a YAML file that maps the names of custom
+// directives to executables, in the same format as Directives in the Rain section
+var DirectivesFile string
+
+// StackName is the name of the stack that the template will be deployed
+// to, if it is known. It is passed to custom directives.
+var StackName string
+
+// customDirectives are the directives defined for the template being packaged
+var customDirectives map[string]directiveFunc
+
+// directiveInput is written as YAML to the stdin of a custom directive
+type directiveInput struct {
+	// Directive is the name of the directive, like Rain::Custom::Ami
+	Directive string `yaml:"Directive"`
+
+	// Value is the node that the directive was applied to
+	Value *yaml.Node `yaml:"Value"`
+
+	// RootDir is the directory of the file that contains the directive
+	RootDir string `yaml:"RootDir"`
+
+	StackName string                `yaml:"StackName,omitempty"`
+	Constants map[string]*yaml.Node `yaml:"Constants,omitempty"`
+}
+
+// loadDirectives reads custom directives from DirectivesFile
+// and from the Rain section of the template
+func loadDirectives(t *cft.Template, rootDir string) error {
+	customDirectives = make(map[string]directiveFunc)
+
+	if DirectivesFile != "" {
+		content, err := os.ReadFile(DirectivesFile)
+		if err != nil {
+			return err
+		}
+		var n yaml.Node
+		err = yaml.Unmarshal(content, &n)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %v", DirectivesFile, err)
+		}
+		if len(n.Content) > 0 {
+			err = addDirectives(n.Content[0], filepath.Dir(DirectivesFile))
+			if err != nil {
+				return fmt.Errorf("%s: %v", DirectivesFile, err)
+			}
+		}
+	}
+
+	rainNode, err := t.GetSection(cft.Rain)
+	if err != nil {
+		// This is okay, not all templates have a Rain section
+		return nil
+	}
+	_, d, _ := s11n.GetMapValue(rainNode, Directives)
+	if d == nil {
+		return nil
+	}
+	err = addDirectives(d, rootDir)
+	if err != nil {
+		return err
+	}
+	node.RemoveFromMap(rainNode, Directives)
+
+	return nil
+}
+
+// addDirectives adds a mapping of directive names to executables.
+// Relative paths to executables are relative to rootDir.
+func addDirectives(n *yaml.Node, rootDir string) error {
+	if n.Kind != yaml.MappingNode {
+		return errors.New("expected Directives to be a mapping")
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		name := n.Content[i].Value
+		run := n.Content[i+1]
+
+		if _, ok := registry["**/*|"+name]; ok {
+			return fmt.Errorf("directive %s is already defined by rain", name)
+		}
+		if !strings.HasPrefix(name, cft.CustomDirectivePrefix) || name == cft.CustomDirectivePrefix {
+			return fmt.Errorf("directive %s must start with %s", name, cft.CustomDirectivePrefix)
+		}
+		if run.Kind != yaml.ScalarNode || run.Value == "" {
+			return fmt.Errorf("expected directive %s to be the path to an executable", name)
+		}
+
+		path := run.Value
+		if !filepath.IsAbs(path) {
+			abs, err := filepath.Abs(filepath.Join(rootDir, path))
+			if err != nil {
+				return err
+			}
+			path = abs
+		}
+
+		config.Debugf("Adding directive %s: %s", name, path)
+		customDirectives["**/*|"+name] = runDirective(name, path)
+	}
+
+	return nil
+}
+
+// checkDirectives returns an error if a Rain:: directive is left in the
+// template after it has been transformed, which means nothing defines it
+func checkDirectives(t *cft.Template) error {
+	var err error
+	vf := func(v *visitor.Visitor) {
+		n := v.GetYamlNode()
+		if err != nil {
+			return
+		}
+		// Tags that parse does not know about are left on the node
+		if strings.HasPrefix(n.Tag, "!"+cft.DirectivePrefix) {
+			err = fmt.Errorf("unknown directive %s (line %d)", n.Tag, n.Line)
+			return
+		}
+		if n.Kind != yaml.MappingNode || len(n.Content) != 2 {
+			return
+		}
+		key := n.Content[0]
+		if strings.HasPrefix(key.Value, cft.DirectivePrefix) {
+			err = fmt.Errorf("unknown directive %s (line %d)", key.Value, key.Line)
+		}
+	}
+	visitor.NewVisitor(t.Node).Visit(vf)
+	return err
+}
+
+// runDirective returns a directive that runs the executable at path. The
+// node and its context are written to stdin as YAML, and the YAML that the
+// executable writes to stdout replaces the node.
+func runDirective(name string, path string) directiveFunc {
+	return func(ctx *directiveContext) (bool, error) {
+		if len(ctx.n.Content) != 2 {
+			return false, fmt.Errorf("expected %s to have exactly one key", name)
+		}
+
+		input := directiveInput{
+			Directive: name,
+			Value:     ctx.n.Content[1],
+			RootDir:   ctx.rootDir,
+			StackName: StackName,
+		}
+		if ctx.t != nil {
+			input.Constants = ctx.t.Constants
+		}
+		in, err := yaml.Marshal(input)
+		if err != nil {
+			return false, err
+		}
+
+		cmd := exec.Command(path)
+		var stdout strings.Builder
+		var stderr strings.Builder
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		cmd.Dir = ctx.rootDir
+		err = cmd.Run()
+		if err != nil {
+			return false, fmt.Errorf("directive %s: %s failed with %v: %s",
+				name, path, err, strings.TrimSpace(stderr.String()))
+		}
+
+		var out yaml.Node
+		err = yaml.Unmarshal([]byte(stdout.String()), &out)
+		if err != nil {
+			return false, fmt.Errorf("directive %s: unable to parse output: %v", name, err)
+		}
+		if len(out.Content) == 0 {
+			return false, fmt.Errorf("directive %s: no output from %s", name, path)
+		}
+
+		// The output can use intrinsic functions and other directives
+		err = parse.NormalizeNode(&out)
+		if err != nil {
+			return false, err
+		}
+
+		*ctx.n = *out.Content[0]
+		return true, nil
+	}
+}
@@ -0,0 +1,105 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestCustomDirective(t *testing.T) {
+	runTest("directive", t)
+}
+
+func TestCustomDirectiveFail(t *testing.T) {
+	runFailTest("directive-fail", t)
+}
+
+func TestDirectivesFile(t *testing.T) {
+	dir := t.TempDir()
+
+	script, err := filepath.Abs("tmpl/directive-ami.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	directives := filepath.Join(dir, "directives.yaml")
+	err = os.WriteFile(directives, []byte("Rain::Custom::Ami: "+script+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := filepath.Join(dir, "template.yaml")
+	err = os.WriteFile(template, []byte(`
+Resources:
+  Instance:
+    Type: AWS::EC2::Instance
+    Properties:
+      ImageId: !Rain::Custom::Ami al2023
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg.DirectivesFile = directives
+	defer func() { pkg.DirectivesFile = "" }()
+
+	packaged, err := pkg.File(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource, err := packaged.GetResource("Instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resource.Content[3].Content[1].Value; got != "ami-0a1b2c3d4e5f67890" {
+		t.Errorf("unexpected ImageId: %s", got)
+	}
+}
+
+func TestCustomDirectiveBuiltin(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "template.yaml")
+	err := os.WriteFile(template, []byte(`
+Rain:
+  Directives:
+    Rain::Env: ./env.sh
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pkg.File(template)
+	if err == nil {
+		t.Error("expected an error for a directive that rain already defines")
+	}
+}
+
+func TestUnknownDirective(t *testing.T) {
+	for _, value := range []string{
+		"!Rain::Embedd embed.txt",
+		"!Rain::Custom::Missing x",
+		"{Rain::Other: x}",
+	} {
+		template := filepath.Join(t.TempDir(), "template.yaml")
+		err := os.WriteFile(template, []byte(`
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: `+value+`
+`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = pkg.File(template)
+		if err == nil || !strings.Contains(err.Error(), "unknown directive") {
+			t.Errorf("%s: expected an unknown directive error, got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/internal/config"
+)
+
+// GitPrefix marks a module source or package location that is in a git repository:
+//
+//	git::<url>//path/to/module.yaml?ref=<tag|branch|sha>
+const GitPrefix = "git::"
+
+var commitSha = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// gitSource is a parsed git:: URI
+type gitSource struct {
+	Repo string
+	Path string
+	Ref  string
+}
+
+func isGitSource(uri string) bool {
+	return strings.HasPrefix(uri, GitPrefix)
+}
+
+// parseGitSource parses git::<url>//<path>?ref=<ref>
+func parseGitSource(uri string) (*gitSource, error) {
+	if !isGitSource(uri) {
+		return nil, fmt.Errorf("not a git source: %s", uri)
+	}
+	s := strings.TrimPrefix(uri, GitPrefix)
+
+	src := &gitSource{}
+
+	if i := strings.LastIndex(s, "?"); i >= 0 {
+		query := s[i+1:]
+		s = s[:i]
+		for _, param := range strings.Split(query, "&") {
+			k, v, _ := strings.Cut(param, "=")
+			if k != "ref" {
+				return nil, fmt.Errorf("unexpected parameter %s in %s", k, uri)
+			}
+			src.Ref = v
+		}
+	}
+
+	// The path inside the repository starts at the first // after the scheme
+	start := 0
+	if i := strings.Index(s, "://"); i >= 0 {
+		start = i + 3
+	}
+	if i := strings.Index(s[start:], "//"); i >= 0 {
+		src.Repo = s[:start+i]
+		src.Path = s[start+i+2:]
+	} else {
+		src.Repo = s
+	}
+
+	if src.Repo == "" {
+		return nil, fmt.Errorf("missing repository in %s", uri)
+	}
+
+	// Don't let a template pass options to git
+	if strings.HasPrefix(src.Repo, "-") {
+		return nil, fmt.Errorf("invalid repository in %s", uri)
+	}
+
+	// Don't let a module read files outside of the checkout
+	if src.Path != "" {
+		clean := path.Clean(src.Path)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("path %s is outside of the repository in %s", src.Path, uri)
+		}
+	}
+
+	return src, nil
+}
+
+// String returns the source as a git:: URI
+func (src *gitSource) String() string {
+	s := GitPrefix + src.Repo
+	if src.Path != "" {
+		s += "//" + src.Path
+	}
+	if src.Ref != "" {
+		s += "?ref=" + src.Ref
+	}
+	return s
+}
+
+// lockKey is the key for the resolved commit in rain.lock
+func (src *gitSource) lockKey() string {
+	key := GitPrefix + src.Repo
+	if src.Ref != "" {
+		key += "?ref=" + src.Ref
+	}
+	return key
+}
+
+// packagePath returns the location of path inside a package
+func packagePath(location string, p string) string {
+	if isGitSource(location) {
+		src, err := parseGitSource(location)
+		if err == nil {
+			src.Path = path.Join(src.Path, p)
+			return src.String()
+		}
+	}
+	return location + "/" + p
+}
+
+// gitDir returns the directory where git checkouts are stored
+func gitDir() string {
+	if CacheDir == "" {
+		return filepath.Join(os.TempDir(), "rain-git")
+	}
+	return filepath.Join(CacheDir, "git")
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	config.Debugf("git %s", strings.Join(args, " "))
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// resolveRef returns the commit for the source's ref, and whether the commit
+// was pinned by the source or the lock file, in which case the ref might
+// have moved on from it
+func (src *gitSource) resolveRef(repoDir string) (string, bool, error) {
+	if commitSha.MatchString(src.Ref) {
+		return src.Ref, true, nil
+	}
+
+	// The lock file pins the commit, unless we are updating it
+	if locked := lockedHash(src.lockKey()); locked != "" && (!UpdateLock || Offline) {
+		sha := strings.TrimPrefix(locked, "git:")
+		if !commitSha.MatchString(sha) {
+			return "", false, fmt.Errorf("invalid commit %s for %s in the lock file", locked, src.lockKey())
+		}
+		return sha, true, nil
+	}
+
+	// Remember which commit each ref pointed to, for offline mode
+	refName := src.Ref
+	if refName == "" {
+		refName = "HEAD"
+	}
+	refFile := filepath.Join(repoDir, "refs", fmt.Sprintf("%x", sha256.Sum256([]byte(refName))))
+
+	if Offline {
+		sha, err := os.ReadFile(refFile)
+		if err != nil {
+			return "", false, fmt.Errorf("%s is not in the module cache at %s; "+
+				"run once without --offline to download it", src.lockKey(), gitDir())
+		}
+		return string(sha), false, nil
+	}
+
+	out, err := runGit("", "ls-remote", "--", src.Repo, refName)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Annotated tags have a peeled entry ending in ^{} with the commit
+	sha := ""
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if sha == "" || strings.HasSuffix(fields[1], "^{}") {
+			sha = fields[0]
+		}
+	}
+	if !commitSha.MatchString(sha) {
+		return "", false, fmt.Errorf("ref %s not found in %s", refName, src.Repo)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(refFile), 0755); err == nil {
+		os.WriteFile(refFile, []byte(sha), 0644)
+	}
+
+	return sha, false, nil
+}
+
+// checkout makes a shallow checkout of the source's commit in the
+// module cache and returns the path to the checkout and the commit
+func (src *gitSource) checkout() (string, string, error) {
+	repoDir := filepath.Join(gitDir(), fmt.Sprintf("%x", sha256.Sum256([]byte(src.Repo))))
+
+	sha, pinned, err := src.resolveRef(repoDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	dir := filepath.Join(repoDir, sha)
+	if _, err := os.Stat(dir); err == nil {
+		config.Debugf("Using cached checkout of %s at %s", src.Repo, sha)
+		return dir, sha, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+
+	if Offline {
+		return "", "", fmt.Errorf("%s at %s is not in the module cache at %s; "+
+			"run once without --offline to download it", src.Repo, sha, gitDir())
+	}
+
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return "", "", err
+	}
+	tmp, err := os.MkdirTemp(repoDir, "tmp-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := runGit(tmp, "init", "--quiet"); err != nil {
+		return "", "", err
+	}
+
+	// Not all servers allow fetching a commit by its sha, so fetch the ref
+	// if we have one. If the ref has moved on from a pinned commit, fetch the
+	// commit, and fall back to fetching everything.
+	fetches := make([][]string, 0)
+	if src.Ref != "" && !commitSha.MatchString(src.Ref) {
+		fetches = append(fetches, []string{"--depth", "1", "--", src.Repo, src.Ref})
+	}
+	fetches = append(fetches,
+		[]string{"--depth", "1", "--", src.Repo, sha},
+		[]string{"--tags", "--", src.Repo, "+refs/heads/*:refs/remotes/origin/*"})
+
+	for i, args := range fetches {
+		if i == len(fetches)-1 {
+			// A later fetch does not deepen what an earlier one fetched
+			if shallow, _ := runGit(tmp, "rev-parse", "--is-shallow-repository"); shallow == "true" {
+				args = append([]string{"--unshallow"}, args...)
+			}
+		}
+		if _, err = runGit(tmp, append([]string{"fetch", "--quiet"}, args...)...); err != nil {
+			config.Debugf("Unable to fetch %s: %v", sha, err)
+			continue
+		}
+		_, err = runGit(tmp, "-c", "advice.detachedHead=false", "checkout", "--quiet", sha)
+		if err == nil {
+			break
+		}
+		config.Debugf("%s is not in what was fetched: %v", sha, err)
+	}
+	if err != nil {
+		if !pinned {
+			// The ref moved after we resolved it
+			return "", "", fmt.Errorf("%s changed while it was being fetched, try again", src.lockKey())
+		}
+		return "", "", err
+	}
+
+	os.RemoveAll(filepath.Join(tmp, ".git"))
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another process might have finished the same checkout first
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return "", "", err
+		}
+	}
+
+	return dir, sha, nil
+}
+
+// getGitContent returns the content of a module in a git repository,
+// along with the directory it was checked out to, so that relative
+// paths to other modules in the same repository can be resolved
+func getGitContent(uri string) ([]byte, string, error) {
+	src, err := parseGitSource(uri)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir, sha, err := src.checkout()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := checkGitLock(src.lockKey(), sha); err != nil {
+		return nil, "", err
+	}
+
+	p := filepath.Join(dir, filepath.FromSlash(src.Path))
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read %s from %s at %s: %v", src.Path, src.Repo, sha, err)
+	}
+
+	return content, filepath.Dir(p), nil
+}
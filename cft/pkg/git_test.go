@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGitSource(t *testing.T) {
+	cases := map[string]gitSource{
+		"git::https://github.com/org/repo.git//modules/bucket.yaml?ref=v1.0.0": {
+			Repo: "https://github.com/org/repo.git", Path: "modules/bucket.yaml", Ref: "v1.0.0"},
+		"git::file:///tmp/repo.git//bucket.yaml": {
+			Repo: "file:///tmp/repo.git", Path: "bucket.yaml"},
+		"git::git@github.com:org/repo.git?ref=main": {
+			Repo: "git@github.com:org/repo.git", Ref: "main"},
+	}
+	for uri, expected := range cases {
+		src, err := parseGitSource(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *src != expected {
+			t.Errorf("%s: expected %+v, got %+v", uri, expected, *src)
+		}
+		if src.String() != uri {
+			t.Errorf("expected %s, got %s", uri, src.String())
+		}
+	}
+
+	for _, uri := range []string{
+		"git::--upload-pack=touch /tmp/x//bucket.yaml",
+		"git::-c//bucket.yaml",
+		"git::https://example.com/repo.git//../../etc/passwd",
+		"git::https://example.com/repo.git//modules/../../secret.yaml",
+		"git::https://example.com/repo.git///etc/passwd",
+	} {
+		if _, err := parseGitSource(uri); err == nil {
+			t.Errorf("expected %s to be rejected", uri)
+		}
+	}
+
+	joined := packagePath("git::https://example.com/repo.git//modules?ref=v1", "bucket.yaml")
+	if joined != "git::https://example.com/repo.git//modules/bucket.yaml?ref=v1" {
+		t.Errorf("unexpected package path %s", joined)
+	}
+}
+
+// makeRepo creates a bare repository with a module that references
+// another module in the same repository, tagged as v1
+func makeRepo(t *testing.T) string {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	bare := filepath.Join(dir, "repo.git")
+
+	files := map[string]string{
+		"modules/bucket.yaml": `
+Modules:
+  Inner:
+    Source: ./sub/inner.yaml
+`,
+		"modules/sub/inner.yaml": `
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+`,
+	}
+	for name, content := range files {
+		p := filepath.Join(work, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := func(dir string, args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git(work, "init", "--quiet")
+	git(work, "add", ".")
+	git(work, "commit", "--quiet", "-m", "modules")
+	git(work, "tag", "-a", "v1", "-m", "v1")
+	git(dir, "clone", "--quiet", "--bare", work, bare)
+
+	return "file://" + filepath.ToSlash(bare)
+}
+
+// useGit sets up packaging with git sources and a temporary cache for a
+// test, and restores the package settings afterwards
+func useGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	useCache(t)
+	savedExperimental, savedLockFile := Experimental, LockFile
+	t.Cleanup(func() {
+		Experimental, LockFile = savedExperimental, savedLockFile
+	})
+	Experimental = true
+}
+
+func TestGitModule(t *testing.T) {
+	useGit(t)
+	dir := t.TempDir()
+	LockFile = filepath.Join(dir, LockFileName)
+
+	repo := makeRepo(t)
+	template := filepath.Join(dir, "template.yaml")
+	err := os.WriteFile(template, []byte(`
+Packages:
+  shared:
+    Source: git::`+repo+`//modules?ref=v1
+Modules:
+  A:
+    Source: $shared/bucket.yaml
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packaged, err := File(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := packaged.GetResource("AInnerBucket"); err != nil {
+		t.Errorf("expected the nested module to be resolved: %v", err)
+	}
+
+	lockContent, err := os.ReadFile(LockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(lockContent), "git::"+repo+"?ref=v1: git:") {
+		t.Errorf("expected the commit in the lock file:\n%s", lockContent)
+	}
+
+	// The checkout is cached, so this works offline
+	Offline = true
+	if _, err := File(template); err != nil {
+		t.Fatalf("offline: %v", err)
+	}
+}
+
+func TestGitLockedBranch(t *testing.T) {
+	useGit(t)
+	dir := t.TempDir()
+	LockFile = filepath.Join(dir, LockFileName)
+
+	repo := makeRepo(t)
+	bare := strings.TrimPrefix(repo, "file://")
+	work := filepath.Join(t.TempDir(), "work")
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	if err := os.MkdirAll(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("clone", "--quiet", bare, ".")
+	git("checkout", "--quiet", "-b", "release")
+	git("push", "--quiet", "origin", "release")
+
+	template := filepath.Join(dir, "template.yaml")
+	err := os.WriteFile(template, []byte(`
+Modules:
+  A:
+    Source: git::`+repo+`//modules/bucket.yaml?ref=release
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := File(template); err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch moves on after it was locked
+	if err := os.WriteFile(filepath.Join(work, "modules", "sub", "inner.yaml"),
+		[]byte("Resources:\n  Changed:\n    Type: AWS::S3::Bucket\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("commit", "--quiet", "-a", "-m", "changed")
+	git("push", "--quiet", "origin", "release")
+
+	// With an empty cache, the locked commit is still checked out
+	CacheDir = t.TempDir()
+	packaged, err := File(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := packaged.GetResource("AInnerBucket"); err != nil {
+		t.Errorf("expected the locked commit: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package pkg
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// ModuleInfo describes the interface of a module: what the parent
+// template can pass in, what it can reference, and what it can override
+type ModuleInfo struct {
+	Description string
+	Parameters  []ModuleParameter
+	Outputs     []ModuleOutput
+	Resources   []ModuleResource
+	Modules     []ModuleReference
+}
+
+// ModuleParameter is a module parameter, set with Properties in the parent
+type ModuleParameter struct {
+	Name          string
+	Type          string
+	Description   string
+	Default       string
+	HasDefault    bool
+	AllowedValues []string
+}
+
+// ModuleOutput is a module output, referenced with GetAtt or Sub in the parent
+type ModuleOutput struct {
+	Name        string
+	Description string
+}
+
+// ModuleResource is a resource that the module creates.
+// Properties are the top level properties that can be set with Overrides.
+type ModuleResource struct {
+	Name       string
+	Type       string
+	Condition  string
+	Properties []string
+}
+
+// ModuleReference is a submodule that the module includes
+type ModuleReference struct {
+	Name   string
+	Source string
+}
+
+// LoadModule returns the content of the module at source, which can be a
+// local path, a URL, a git:: URI, or a package alias like $alias/module.yaml.
+// Aliases are resolved using the Packages defined in the template at
+// templatePath, and relative paths are resolved from the template's
+// directory, or the current directory if templatePath is empty.
+func LoadModule(source string, templatePath string) ([]byte, error) {
+	t := &cft.Template{}
+	rootDir := "."
+
+	if templatePath != "" {
+		var err error
+		t, err = parse.File(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		rootDir = filepath.Dir(templatePath)
+
+		if err := processRainSection(t); err != nil {
+			return nil, err
+		}
+		if err := processPackages(t, t.Node.Content[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := getModuleContent(rootDir, t, nil, "", source)
+	if err != nil {
+		return nil, err
+	}
+
+	return content.Content, nil
+}
+
+// InspectModule parses the content of a module and describes its interface
+func InspectModule(content []byte) (*ModuleInfo, error) {
+	parsed, err := parseModule(content, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	n := parsed.Node
+
+	info := &ModuleInfo{
+		Description: s11n.GetValue(n, "Description"),
+	}
+
+	_, params, _ := s11n.GetMapValue(n, string(cft.Parameters))
+	eachPair(params, func(name string, param *yaml.Node) {
+		p := ModuleParameter{
+			Name:        name,
+			Type:        s11n.GetValue(param, "Type"),
+			Description: s11n.GetValue(param, "Description"),
+		}
+		if _, def, _ := s11n.GetMapValue(param, Default); def != nil {
+			p.HasDefault = true
+			p.Default = inlineValue(def)
+		}
+		if _, allowed, _ := s11n.GetMapValue(param, "AllowedValues"); allowed != nil {
+			p.AllowedValues = node.SequenceToStrings(allowed)
+		}
+		info.Parameters = append(info.Parameters, p)
+	})
+
+	_, outputs, _ := s11n.GetMapValue(n, string(cft.Outputs))
+	eachPair(outputs, func(name string, output *yaml.Node) {
+		info.Outputs = append(info.Outputs, ModuleOutput{
+			Name:        name,
+			Description: s11n.GetValue(output, "Description"),
+		})
+	})
+
+	_, resources, _ := s11n.GetMapValue(n, string(cft.Resources))
+	eachPair(resources, func(name string, resource *yaml.Node) {
+		_, typ, _ := s11n.GetMapValue(resource, "Type")
+		if typ == nil {
+			return
+		}
+
+		// Resources with a module type are submodules
+		if typ.Kind == yaml.MappingNode {
+			_, source, _ := s11n.GetMapValue(typ, "Rain::Module")
+			if source != nil {
+				info.Modules = append(info.Modules, ModuleReference{name, source.Value})
+			}
+			return
+		}
+
+		r := ModuleResource{
+			Name:      name,
+			Type:      typ.Value,
+			Condition: s11n.GetValue(resource, Condition),
+		}
+		_, props, _ := s11n.GetMapValue(resource, Properties)
+		eachPair(props, func(prop string, _ *yaml.Node) {
+			r.Properties = append(r.Properties, prop)
+		})
+		slices.Sort(r.Properties)
+		info.Resources = append(info.Resources, r)
+	})
+
+	_, modules, _ := s11n.GetMapValue(n, string(cft.Modules))
+	eachPair(modules, func(name string, m *yaml.Node) {
+		info.Modules = append(info.Modules, ModuleReference{name, s11n.GetValue(m, Source)})
+	})
+
+	return info, nil
+}
+
+// eachPair calls fn for each key and value in a mapping node
+func eachPair(n *yaml.Node, fn func(string, *yaml.Node)) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fn(n.Content[i].Value, n.Content[i+1])
+	}
+}
+
+// inlineValue formats a value on a single line
+func inlineValue(n *yaml.Node) string {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value
+	}
+	c := node.Clone(n)
+	c.Style = yaml.FlowStyle
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,77 @@
+package pkg_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestInspectModule(t *testing.T) {
+	content, err := os.ReadFile("tmpl/validate-module.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := pkg.InspectModule(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Parameters) != 4 {
+		t.Fatalf("expected 4 parameters, got %d", len(info.Parameters))
+	}
+	name := info.Parameters[0]
+	if name.Name != "Name" || name.Type != "String" || name.HasDefault {
+		t.Errorf("unexpected parameter %+v", name)
+	}
+	env := info.Parameters[1]
+	if env.Default != "dev" || !slices.Equal(env.AllowedValues, []string{"dev", "prod"}) {
+		t.Errorf("unexpected parameter %+v", env)
+	}
+	if ports := info.Parameters[3]; ports.Default != "[80]" {
+		t.Errorf("expected the list default to be inline, got %s", ports.Default)
+	}
+
+	if len(info.Resources) != 1 {
+		t.Fatalf("expected 1 resource, got %d", len(info.Resources))
+	}
+	bucket := info.Resources[0]
+	if bucket.Type != "AWS::S3::Bucket" || !slices.Equal(bucket.Properties, []string{"BucketName", "Tags"}) {
+		t.Errorf("unexpected resource %+v", bucket)
+	}
+}
+
+func TestInspectSubmodules(t *testing.T) {
+	content, err := os.ReadFile("tmpl/modinmod-module.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := pkg.InspectModule(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Modules) != 1 || info.Modules[0].Source != "./modinmod-sub-module.yaml" {
+		t.Errorf("unexpected submodules %+v", info.Modules)
+	}
+}
+
+func TestLoadModuleAlias(t *testing.T) {
+	content, err := pkg.LoadModule("$abc/zip-module.yaml",
+		"tmpl/awscli-modules/zip-template.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := pkg.InspectModule(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Resources) != 1 || info.Resources[0].Type != "A::B::C" {
+		t.Errorf("unexpected resources %+v", info.Resources)
+	}
+}
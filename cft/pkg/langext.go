@@ -0,0 +1,412 @@
+// Client-side expansion of the AWS::LanguageExtensions transform
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/cft/visitor"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// ExpandLanguageExtensions enables client-side expansion of
+// Fn::ForEach, Fn::Length, Fn::ToJsonString, and intrinsic functions in
+// DeletionPolicy and UpdateReplacePolicy, when their inputs are static.
+var ExpandLanguageExtensions bool
+
+const (
+	LanguageExtensions = "AWS::LanguageExtensions"
+	FnForEachPrefix    = "Fn::ForEach::"
+	FnLength           = "Fn::Length"
+	FnToJsonString     = "Fn::ToJsonString"
+	FnFindInMap        = "Fn::FindInMap"
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// expandLanguageExtensions expands everything in the template that the
+// AWS::LanguageExtensions transform would expand, as long as it does not
+// depend on values that are only known at deploy time. If nothing is left
+// for the transform to do, it is removed from the template.
+func expandLanguageExtensions(t *cft.Template) error {
+	root := t.Node.Content[0]
+
+	if err := expandForEach(root); err != nil {
+		return err
+	}
+
+	fnLength(root)
+
+	if err := fnToJsonString(root); err != nil {
+		return err
+	}
+
+	resolvePolicies(t)
+
+	if usesLanguageExtensions(root) {
+		config.Debugf("Not removing %s, some functions could not be expanded", LanguageExtensions)
+		return nil
+	}
+
+	removeTransform(t, LanguageExtensions)
+
+	return nil
+}
+
+// expandForEach replaces each static Fn::ForEach loop in mapping nodes
+// with the key-value pairs it would produce
+func expandForEach(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := expandForEach(c); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		content := make([]*yaml.Node, 0, len(n.Content))
+		for i := 0; i < len(n.Content); i += 2 {
+			key := n.Content[i]
+			val := n.Content[i+1]
+
+			if !strings.HasPrefix(key.Value, FnForEachPrefix) {
+				content = append(content, key, val)
+				continue
+			}
+
+			expanded, err := expandLoop(key.Value, val)
+			if err != nil {
+				return err
+			}
+			if expanded == nil {
+				// Not static, leave it for the transform
+				content = append(content, key, val)
+				continue
+			}
+			content = append(content, expanded...)
+		}
+
+		// Check for keys that were generated more than once
+		seen := make(map[string]bool)
+		for i := 0; i < len(content); i += 2 {
+			if strings.HasPrefix(content[i].Value, FnForEachPrefix) {
+				// A loop that could not be expanded is
+				// handled by the caller or the transform
+				continue
+			}
+			if seen[content[i].Value] {
+				return fmt.Errorf("Fn::ForEach created a duplicate key %s on line %d",
+					content[i].Value, content[i].Line)
+			}
+			seen[content[i].Value] = true
+		}
+		n.Content = content
+
+		// Loops in the output can contain more loops
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandForEach(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandLoop returns the key-value pairs produced by a single Fn::ForEach,
+// or nil if the collection cannot be resolved client-side
+func expandLoop(name string, loop *yaml.Node) ([]*yaml.Node, error) {
+	if loop.Kind != yaml.SequenceNode || len(loop.Content) != 3 {
+		return nil, fmt.Errorf("invalid %s on line %d, expected [Identifier, Collection, Output]",
+			name, loop.Line)
+	}
+
+	identifier := loop.Content[0]
+	collection := loop.Content[1]
+	output := loop.Content[2]
+
+	if identifier.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("invalid %s on line %d, the identifier must be a string",
+			name, loop.Line)
+	}
+	if output.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid %s on line %d, expected OutputKey: OutputValue",
+			name, loop.Line)
+	}
+
+	// Only literal lists of strings are static. A Ref to a parameter
+	// might have a different value when the stack is deployed.
+	if collection.Kind != yaml.SequenceNode {
+		config.Debugf("%s collection is not static", name)
+		return nil, nil
+	}
+	for _, item := range collection.Content {
+		if item.Kind != yaml.ScalarNode {
+			config.Debugf("%s collection is not static", name)
+			return nil, nil
+		}
+	}
+
+	retval := make([]*yaml.Node, 0)
+	for _, item := range collection.Content {
+		for i := 0; i < len(output.Content); i += 2 {
+			key := node.Clone(output.Content[i])
+			key.Value = replaceLoopIdentifier(key.Value, identifier.Value, item.Value)
+			val := node.Clone(output.Content[i+1])
+			substituteIdentifier(val, identifier.Value, item.Value)
+			retval = append(retval, key, val)
+		}
+	}
+
+	// Expand nested loops now, since each iteration produces a copy of
+	// the inner loop with the same name
+	expanded := &yaml.Node{Kind: yaml.MappingNode, Content: retval}
+	if err := expandForEach(expanded); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(expanded.Content); i += 2 {
+		if strings.HasPrefix(expanded.Content[i].Value, FnForEachPrefix) {
+			config.Debugf("%s contains a loop that is not static", name)
+			return nil, nil
+		}
+	}
+	return expanded.Content, nil
+}
+
+// replaceLoopIdentifier replaces ${Identifier} with the value and
+// &{Identifier} with the value stripped of non-alphanumeric characters
+func replaceLoopIdentifier(s string, identifier string, value string) string {
+	s = strings.ReplaceAll(s, "${"+identifier+"}", value)
+	s = strings.ReplaceAll(s, "&{"+identifier+"}",
+		nonAlphanumeric.ReplaceAllString(value, ""))
+	return s
+}
+
+// substituteIdentifier replaces references to the loop identifier in the
+// output of a loop: Refs, Fn::Sub strings, and keys in nested mappings
+func substituteIdentifier(n *yaml.Node, identifier string, value string) {
+	vf := func(v *visitor.Visitor) {
+		vn := v.GetYamlNode()
+		if vn.Kind != yaml.MappingNode {
+			return
+		}
+		if len(vn.Content) == 2 {
+			switch vn.Content[0].Value {
+			case string(cft.Ref):
+				if vn.Content[1].Value == identifier {
+					*vn = *node.MakeScalar(value)
+					return
+				}
+			case string(cft.Sub):
+				sub := vn.Content[1]
+				if sub.Kind == yaml.SequenceNode && len(sub.Content) > 0 {
+					sub = sub.Content[0]
+				}
+				if sub.Kind == yaml.ScalarNode {
+					sub.Value = replaceLoopIdentifier(sub.Value, identifier, value)
+					if vn.Content[1].Kind == yaml.ScalarNode && !parse.IsSubNeeded(sub.Value) {
+						*vn = *node.MakeScalar(sub.Value)
+						return
+					}
+				}
+			}
+		}
+		for i := 0; i < len(vn.Content); i += 2 {
+			vn.Content[i].Value = replaceLoopIdentifier(vn.Content[i].Value, identifier, value)
+		}
+	}
+	visitor.NewVisitor(n).Visit(vf)
+}
+
+// fnLength replaces Fn::Length of a literal list with the number of items
+func fnLength(n *yaml.Node) {
+	vf := func(v *visitor.Visitor) {
+		vn := v.GetYamlNode()
+		if vn.Kind != yaml.MappingNode || len(vn.Content) != 2 {
+			return
+		}
+		if vn.Content[0].Value != FnLength {
+			return
+		}
+		list := vn.Content[1]
+		if list.Kind != yaml.SequenceNode {
+			return
+		}
+		length := node.MakeScalar(strconv.Itoa(len(list.Content)))
+		length.Tag = "!!int"
+		*vn = *length
+	}
+	visitor.NewVisitor(n).Visit(vf)
+}
+
+// fnToJsonString replaces Fn::ToJsonString with a string, as long as
+// the object does not contain any intrinsic functions
+func fnToJsonString(n *yaml.Node) error {
+	var err error
+	vf := func(v *visitor.Visitor) {
+		vn := v.GetYamlNode()
+		if vn.Kind != yaml.MappingNode || len(vn.Content) != 2 {
+			return
+		}
+		if vn.Content[0].Value != FnToJsonString {
+			return
+		}
+		obj := vn.Content[1]
+		if hasIntrinsics(obj) {
+			return
+		}
+		var decoded any
+		if decodeErr := obj.Decode(&decoded); decodeErr != nil {
+			err = fmt.Errorf("invalid %s on line %d: %v", FnToJsonString, vn.Line, decodeErr)
+			v.Stop()
+			return
+		}
+		b, marshalErr := json.Marshal(decoded)
+		if marshalErr != nil {
+			err = fmt.Errorf("invalid %s on line %d: %v", FnToJsonString, vn.Line, marshalErr)
+			v.Stop()
+			return
+		}
+		*vn = *node.MakeScalar(string(b))
+	}
+	visitor.NewVisitor(n).Visit(vf)
+	return err
+}
+
+// hasIntrinsics returns true if the node contains a Ref or a Fn:: function
+func hasIntrinsics(n *yaml.Node) bool {
+	found := false
+	vf := func(v *visitor.Visitor) {
+		vn := v.GetYamlNode()
+		if vn.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i < len(vn.Content); i += 2 {
+			k := vn.Content[i].Value
+			if k == string(cft.Ref) || k == Condition || strings.HasPrefix(k, "Fn::") {
+				found = true
+				v.Stop()
+				return
+			}
+		}
+	}
+	visitor.NewVisitor(n).Visit(vf)
+	return found
+}
+
+// resolvePolicies resolves Fn::FindInMap in DeletionPolicy and
+// UpdateReplacePolicy when all of the keys are literal strings
+func resolvePolicies(t *cft.Template) {
+	resources, err := t.GetSection(cft.Resources)
+	if err != nil {
+		return
+	}
+	mappings, _ := t.GetSection(cft.Mappings)
+
+	for i := 1; i < len(resources.Content); i += 2 {
+		resource := resources.Content[i]
+		if resource.Kind != yaml.MappingNode {
+			continue
+		}
+		for _, policy := range []string{DeletionPolicy, UpdateReplacePolicy} {
+			_, p, _ := s11n.GetMapValue(resource, policy)
+			if p == nil || p.Kind != yaml.MappingNode || len(p.Content) != 2 {
+				continue
+			}
+			if p.Content[0].Value != FnFindInMap || mappings == nil {
+				continue
+			}
+			if resolved := findInMap(mappings, p.Content[1]); resolved != nil {
+				*p = *node.Clone(resolved)
+			}
+		}
+	}
+}
+
+// findInMap returns the value from Mappings, or nil if any
+// of the keys are not literal strings or the value is missing
+func findInMap(mappings *yaml.Node, args *yaml.Node) *yaml.Node {
+	if args.Kind != yaml.SequenceNode || len(args.Content) < 3 {
+		return nil
+	}
+	current := mappings
+	for _, key := range args.Content[:3] {
+		if key.Kind != yaml.ScalarNode {
+			return nil
+		}
+		_, current, _ = s11n.GetMapValue(current, key.Value)
+		if current == nil {
+			return nil
+		}
+	}
+	if current.Kind != yaml.ScalarNode {
+		return nil
+	}
+	return current
+}
+
+// usesLanguageExtensions returns true if the template still has
+// anything that needs the AWS::LanguageExtensions transform
+func usesLanguageExtensions(root *yaml.Node) bool {
+	found := false
+	vf := func(v *visitor.Visitor) {
+		vn := v.GetYamlNode()
+		if vn.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i < len(vn.Content); i += 2 {
+			k := vn.Content[i].Value
+			val := vn.Content[i+1]
+			switch {
+			case strings.HasPrefix(k, FnForEachPrefix), k == FnLength, k == FnToJsonString:
+				found = true
+			case k == DeletionPolicy || k == UpdateReplacePolicy:
+				// Policies can only be strings without the transform
+				found = found || val.Kind != yaml.ScalarNode
+			case k == FnFindInMap:
+				// The optional DefaultValue argument is a language extension
+				found = found || (val.Kind == yaml.SequenceNode && len(val.Content) > 3)
+			}
+			if found {
+				v.Stop()
+				return
+			}
+		}
+	}
+	visitor.NewVisitor(root).Visit(vf)
+	return found
+}
+
+// removeTransform removes a transform from the Transform section,
+// removing the section entirely if it is empty
+func removeTransform(t *cft.Template, name string) {
+	transform, err := t.GetSection(cft.Transform)
+	if err != nil {
+		return
+	}
+	switch transform.Kind {
+	case yaml.ScalarNode:
+		if transform.Value == name {
+			t.RemoveSection(cft.Transform)
+		}
+	case yaml.SequenceNode:
+		content := make([]*yaml.Node, 0)
+		for _, c := range transform.Content {
+			if c.Kind == yaml.ScalarNode && c.Value == name {
+				continue
+			}
+			content = append(content, c)
+		}
+		transform.Content = content
+		if len(content) == 0 {
+			t.RemoveSection(cft.Transform)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestExpandLanguageExtensions(t *testing.T) {
+	pkg.ExpandLanguageExtensions = true
+	defer func() { pkg.ExpandLanguageExtensions = false }()
+
+	runTest("langext", t)
+
+	// The transform stays when a collection is not known until deployment
+	runTest("langext-dynamic", t)
+}
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/aws-cloudformation/rain/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// LockFileName is the name of the lock file that rain pkg writes
+// in the same directory as the template
+const LockFileName = "rain.lock"
+
+// LockFile is the path to the lock file. When it is set, the hash of every
+// module and package that is fetched is checked against the lock file, and
+// the lock file is updated after the template is packaged.
+var LockFile string
+
+// LockPath returns the path of the lock file for a template
+func LockPath(template string) string {
+	return filepath.Join(filepath.Dir(template), LockFileName)
+}
+
+// UpdateLock allows the hashes in the lock file to change
+var UpdateLock bool
+
+// CheckLockOnly checks modules and packages against the lock file
+// without creating or updating it
+var CheckLockOnly bool
+
+const lockHeader = "# This file is generated by rain pkg. Do not edit it by hand.\n" +
+	"# Run rain pkg --update-lock to accept changes to remote modules.\n"
+
+// Lock is the content of a lock file
+type Lock struct {
+	Version int
+
+	// Modules maps the resolved URI of each module or package
+	// to the SHA-256 hash of its content, or for git sources,
+	// the repository and ref to the commit it resolved to
+	Modules map[string]string
+}
+
+// lockState tracks the lock file while a template is being packaged
+type lockState struct {
+	mu      sync.Mutex
+	path    string
+	exists  bool
+	locked  Lock
+	fetched map[string]string
+}
+
+var lock *lockState
+
+// loadLock reads the lock file at path, if it exists
+func loadLock(path string) error {
+	lock = &lockState{
+		path:    path,
+		locked:  Lock{Version: 1, Modules: make(map[string]string)},
+		fetched: make(map[string]string),
+	}
+
+	// Fetch everything again so that every module is verified
+	contentCache = make(map[string]*ModuleContent)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if err := yaml.Unmarshal(content, &lock.locked); err != nil {
+		return fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if lock.locked.Modules == nil {
+		lock.locked.Modules = make(map[string]string)
+	}
+	lock.exists = true
+
+	return nil
+}
+
+// lockKey returns the key for uri in the lock file. Local paths are
+// stored relative to the lock file so that it can be committed.
+func lockKey(uri string) string {
+	if isHttpsUrl(uri) || isS3URI(uri) || isGitSource(uri) {
+		return uri
+	}
+	abs, err := filepath.Abs(uri)
+	if err != nil {
+		return uri
+	}
+	dir, err := filepath.Abs(filepath.Dir(lock.path))
+	if err != nil {
+		return uri
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return uri
+	}
+	return filepath.ToSlash(rel)
+}
+
+// lockedHash returns the hash that the lock file expects for uri
+func lockedHash(uri string) string {
+	if lock == nil {
+		return ""
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	return lock.locked.Modules[lockKey(uri)]
+}
+
+// checkLock verifies the content fetched from uri against the lock file
+func checkLock(uri string, content []byte) error {
+	if lock == nil {
+		return nil
+	}
+
+	hash := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	key := lockKey(uri)
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	lock.fetched[key] = hash
+
+	expected, ok := lock.locked.Modules[key]
+	if !ok || expected == hash {
+		return nil
+	}
+
+	if UpdateLock {
+		config.Debugf("Updating %s in %s: %s -> %s", key, lock.path, expected, hash)
+		return nil
+	}
+
+	return fmt.Errorf("%s has changed since it was recorded in %s: expected %s, got %s. "+
+		"Use --update-lock to accept the change", key, lock.path, expected, hash)
+}
+
+// checkGitLock verifies the commit that a git ref resolved to against the lock file
+func checkGitLock(key string, sha string) error {
+	if lock == nil {
+		return nil
+	}
+
+	resolved := "git:" + sha
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	lock.fetched[key] = resolved
+
+	expected, ok := lock.locked.Modules[key]
+	if !ok || expected == resolved || UpdateLock {
+		return nil
+	}
+
+	return fmt.Errorf("%s has moved since it was recorded in %s: expected %s, got %s. "+
+		"Use --update-lock to accept the change", key, lock.path, expected, resolved)
+}
+
+// saveLock writes the lock file if anything was fetched
+// and the recorded hashes are different
+func saveLock() error {
+	if lock == nil {
+		return nil
+	}
+	defer func() { lock = nil }()
+
+	if len(lock.fetched) == 0 || CheckLockOnly {
+		return nil
+	}
+
+	if lock.exists && reflect.DeepEqual(lock.fetched, lock.locked.Modules) {
+		return nil
+	}
+
+	content, err := yaml.Marshal(Lock{Version: 1, Modules: lock.fetched})
+	if err != nil {
+		return err
+	}
+
+	config.Debugf("Writing %s", lock.path)
+
+	return os.WriteFile(lock.path, append([]byte(lockHeader), content...), 0644)
+}
@@ -0,0 +1,83 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLockFile(t *testing.T) {
+	pkg.Experimental = true
+	pkg.LockFile = filepath.Join(t.TempDir(), pkg.LockFileName)
+	defer func() {
+		pkg.LockFile = ""
+		pkg.UpdateLock = false
+	}()
+
+	template := "./tmpl/awscli-modules/zip-template.yaml"
+
+	// The first run records the hash of the package
+	if _, err := pkg.File(template); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(pkg.LockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock pkg.Lock
+	if err := yaml.Unmarshal(content, &lock); err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Modules) != 1 {
+		t.Fatalf("expected 1 locked module, got %v", lock.Modules)
+	}
+	var key string
+	for k, v := range lock.Modules {
+		key = k
+		if !strings.HasSuffix(k, "awscli-modules/package.zip") || !strings.HasPrefix(v, "sha256:") {
+			t.Errorf("unexpected lock entry %s: %s", k, v)
+		}
+	}
+
+	// A different hash should fail
+	lock.Modules[key] = "sha256:0000"
+	content, _ = yaml.Marshal(lock)
+	if err := os.WriteFile(pkg.LockFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkg.File(template); err == nil {
+		t.Fatal("expected a hash mismatch")
+	}
+
+	// Unless we are updating the lock file
+	pkg.UpdateLock = true
+	if _, err := pkg.File(template); err != nil {
+		t.Fatal(err)
+	}
+	pkg.UpdateLock = false
+	if _, err := pkg.File(template); err != nil {
+		t.Fatalf("expected the lock file to be updated: %v", err)
+	}
+}
+
+func TestCheckLockOnly(t *testing.T) {
+	experimental, lockFile := pkg.Experimental, pkg.LockFile
+	t.Cleanup(func() {
+		pkg.Experimental, pkg.LockFile, pkg.CheckLockOnly = experimental, lockFile, false
+	})
+	pkg.Experimental = true
+	pkg.CheckLockOnly = true
+	pkg.LockFile = filepath.Join(t.TempDir(), pkg.LockFileName)
+
+	if _, err := pkg.File("./tmpl/awscli-modules/zip-template.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pkg.LockFile); err == nil {
+		t.Error("expected the lock file not to be written")
+	}
+}
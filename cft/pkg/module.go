@@ -124,6 +124,7 @@ func processModulesSection(t *cft.Template, n *yaml.Node,
 		if err != nil {
 			return err
 		}
+		parsed.Path = moduleContent.Path
 
 		// Transform the parsed module content
 		outputNode := node.MakeMapping()
@@ -205,7 +206,12 @@ func processModule(
 
 	m.InitNodes()
 
-	err := m.ProcessConditions()
+	err := m.ValidateProperties()
+	if err != nil {
+		return err
+	}
+
+	err = m.ProcessConditions()
 	if err != nil {
 		return err
 	}
@@ -409,6 +415,8 @@ func (module *Module) ProcessResources(outputNode *yaml.Node) error {
 
 		outputNode.Content = append(outputNode.Content, clonedResource)
 
+		module.recordOrigin(name, moduleResource, clonedResource)
+
 		// We already resolved this resource, so skip its children
 		// if we try to resolve it again later.
 		module.ParentTemplate.AddResolvedModuleNode(clonedResource)
@@ -478,6 +486,9 @@ type ParsedModule struct {
 	AsTemplate *cft.Template
 	RootDir    string
 	FS         *embed.FS
+
+	// Path is the module file, for source maps
+	Path string
 }
 
 // parseModule parses module content and converts it to a yaml node
@@ -542,6 +553,7 @@ func module(ctx *directiveContext) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	parsed.Path = moduleContent.Path
 	moduleNode := parsed.Node
 	moduleAsTemplate := parsed.AsTemplate
 
@@ -49,7 +49,7 @@ func processPackages(t *cft.Template, n *yaml.Node) error {
 
 							if packageAlias, ok := t.Packages[alias]; ok {
 								// Replace the alias with the actual location
-								sourceNode.Value = packageAlias.Location + "/" + path
+								sourceNode.Value = packagePath(packageAlias.Location, path)
 							}
 						}
 					}
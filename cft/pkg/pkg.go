@@ -29,6 +29,10 @@
 //	Name of returned property that will contain the object version
 //
 // `Rain::Module`: Supply a URL to a rain module
+//
+// Custom directives like `Rain::Custom::Ami` can be defined in the Directives
+// entry of the Rain section, or in DirectivesFile. Each one runs an executable
+// that reads the node as YAML on stdin and writes the replacement to stdout.
 package pkg
 
 import (
@@ -86,18 +90,21 @@ type transformContext struct {
 func transform(ctx *transformContext) (bool, error) {
 	changed := false
 
-	// registry is a map of functions defined in rain.go
-	for path, fn := range registry {
-		for found := range s11n.MatchAll(ctx.nodeToTransform, path) {
-			nodeParent := node.GetParent(found, ctx.nodeToTransform, nil)
-			nodeParent.Parent = ctx.parent
-			c, err := fn(&directiveContext{found, ctx.rootDir, ctx.t, nodeParent, ctx.fs, ctx.baseUri})
-			if err != nil {
-				config.Debugf("Error packaging template: %s\n", err)
-				return false, err
+	// registry is a map of functions defined in directives.go,
+	// and customDirectives are the ones defined by the template
+	for _, directives := range []map[string]directiveFunc{registry, customDirectives} {
+		for path, fn := range directives {
+			for found := range s11n.MatchAll(ctx.nodeToTransform, path) {
+				nodeParent := node.GetParent(found, ctx.nodeToTransform, nil)
+				nodeParent.Parent = ctx.parent
+				c, err := fn(&directiveContext{found, ctx.rootDir, ctx.t, nodeParent, ctx.fs, ctx.baseUri})
+				if err != nil {
+					config.Debugf("Error packaging template: %s\n", err)
+					return false, err
+				}
+
+				changed = changed || c
 			}
-
-			changed = changed || c
 		}
 	}
 
@@ -136,8 +143,35 @@ func processRainSection(t *cft.Template) error {
 // and any Rain:: functions used.
 // rootDir must be passed in so that any included assets can be loaded from the same directory
 func Template(t *cft.Template, rootDir string, fs *embed.FS) (*cft.Template, error) {
+	// Assets are uploaded in the background while the template is transformed
+	startUploads()
+
+	packaged, err := transformTemplate(t, rootDir, fs)
+
+	uploadErr := waitForUploads()
+	if err != nil {
+		return nil, err
+	}
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	return packaged, nil
+}
+
+// transformTemplate does the work of Template
+func transformTemplate(t *cft.Template, rootDir string, fs *embed.FS) (*cft.Template, error) {
 	var err error
 
+	// Remember where resources come from, since modules move them around
+	trackTemplate(t)
+
+	// Custom directives have to be loaded before the Rain section is removed
+	err = loadDirectives(t, rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load directives: %v", err)
+	}
+
 	// First look for a Rain section and store constants
 	err = processRainSection(t)
 	if err != nil {
@@ -187,6 +221,12 @@ func Template(t *cft.Template, rootDir string, fs *embed.FS) (*cft.Template, err
 		}
 	}
 
+	// Anything that is left is a typo or a directive that was not declared
+	err = checkDirectives(t)
+	if err != nil {
+		return nil, err
+	}
+
 	// Collect Anchors & Replace Alias Nodes
 	//
 	// 1. find alias nodes and save them in map with anchor name as key
@@ -216,6 +256,13 @@ func Template(t *cft.Template, rootDir string, fs *embed.FS) (*cft.Template, err
 	v.Visit(collectAnchors)
 	v.Visit(replaceAnchors)
 
+	if ExpandLanguageExtensions {
+		err = expandLanguageExtensions(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	//// Look for ${Rain::ConstantName} and ${Const::ConstantName}
 	//if t.HasSection(cft.Rain) || t.HasSection(cft.Constants) {
 	//	// Note that this rewrites all Subs and might have side effects
@@ -225,6 +272,9 @@ func Template(t *cft.Template, rootDir string, fs *embed.FS) (*cft.Template, err
 	//	}
 	//}
 
+	// This has to happen before the nodes are replaced below
+	collectSources(t)
+
 	// Marshal and Unmarshal to resolve new line/column numbers
 
 	serialized, err := yaml.Marshal(t.Node)
@@ -302,5 +352,23 @@ func File(path string) (*cft.Template, error) {
 		}
 	}
 
-	return Template(t, filepath.Dir(path), nil)
+	if LockFile != "" {
+		err = loadLock(LockFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	packaged, err := Template(t, filepath.Dir(path), nil)
+	if err != nil {
+		lock = nil
+		return nil, err
+	}
+
+	err = saveLock()
+	if err != nil {
+		return nil, fmt.Errorf("unable to write %s: %v", LockFile, err)
+	}
+
+	return packaged, nil
 }
@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// Origin is the place in a source file that part of a packaged template came from
+type Origin struct {
+	// File is the template or module file
+	File string `json:"file"`
+
+	// Line is the line number in File
+	Line int `json:"line"`
+
+	// Module is the name of the module instance, like Content, or
+	// Content/Policy for a module inside of another module.
+	// It is empty for resources that were defined in the template itself.
+	Module string `json:"module,omitempty"`
+}
+
+// ResourceSource is the origin of a resource in a packaged template,
+// along with the origins of its properties
+type ResourceSource struct {
+	Origin
+	Properties map[string]Origin `json:"properties,omitempty"`
+}
+
+// SourceMap maps the logical ids of resources in a packaged template
+// to the files and lines where they were written
+type SourceMap map[string]*ResourceSource
+
+// Sources is the source map for the last template packaged by Template
+var Sources SourceMap
+
+// origins tracks where resource nodes came from while modules are processed.
+// Modules clone resource nodes, so each clone is recorded separately.
+var origins map[*yaml.Node]*ResourceSource
+
+// Write saves the source map to a JSON file
+func (sm SourceMap) Write(path string) error {
+	content, err := json.MarshalIndent(sm, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Location returns the file and line for a logical id, formatted like file:line
+func (sm SourceMap) Location(logicalId string) string {
+	source, ok := sm[logicalId]
+	if !ok {
+		return ""
+	}
+	return source.Location()
+}
+
+// Location returns the origin formatted like file:line
+func (o Origin) Location() string {
+	return fmt.Sprintf("%s:%d", o.File, o.Line)
+}
+
+// trackTemplate starts a new source map for t, recording
+// the resources that are defined in the template itself
+func trackTemplate(t *cft.Template) {
+	origins = make(map[*yaml.Node]*ResourceSource)
+	Sources = nil
+
+	resources, err := t.GetSection(cft.Resources)
+	if err != nil {
+		return
+	}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		origins[resources.Content[i+1]] = newResourceSource(t.FileName,
+			resources.Content[i], resources.Content[i+1], "")
+	}
+}
+
+// newResourceSource records the lines of a resource and its properties
+func newResourceSource(file string, name *yaml.Node, resource *yaml.Node, module string) *ResourceSource {
+	source := &ResourceSource{
+		Origin:     Origin{File: file, Line: name.Line, Module: module},
+		Properties: make(map[string]Origin),
+	}
+	_, props, _ := s11n.GetMapValue(resource, Properties)
+	if props != nil && props.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(props.Content); i += 2 {
+			key := props.Content[i]
+			source.Properties[key.Value] = Origin{File: file, Line: key.Line, Module: module}
+		}
+	}
+	return source
+}
+
+// recordOrigin records where a resource that the module emits came from.
+// Resources from sub-modules keep their original location, with this
+// module's name prepended to the module instance name.
+func (module *Module) recordOrigin(name string, moduleResource *yaml.Node, clonedResource *yaml.Node) {
+	if origins == nil {
+		return
+	}
+
+	instance := module.Config.Name
+
+	var source *ResourceSource
+	if inner, ok := origins[moduleResource]; ok && inner.Module != "" {
+		source = &ResourceSource{
+			Origin:     inner.Origin,
+			Properties: make(map[string]Origin),
+		}
+		source.Module = instance + "/" + inner.Module
+		for k, v := range inner.Properties {
+			v.Module = instance + "/" + v.Module
+			source.Properties[k] = v
+		}
+	} else {
+		key, _, _ := s11n.GetMapValue(module.ResourcesNode, name)
+		if key == nil {
+			key = &yaml.Node{}
+		}
+		source = newResourceSource(module.Parsed.Path, key, moduleResource, instance)
+	}
+
+	// Properties that the parent overrides come from the parent
+	parentFile := module.ParentTemplate.FileName
+	if module.ParentModule != nil {
+		parentFile = module.ParentModule.Parsed.Path
+	}
+	_, overrides, _ := s11n.GetMapValue(module.Config.ResourceOverridesNode(name), Properties)
+	if overrides != nil && overrides.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(overrides.Content); i += 2 {
+			source.Properties[overrides.Content[i].Value] = Origin{
+				File:   parentFile,
+				Line:   overrides.Content[i].Line,
+				Module: instance,
+			}
+		}
+	}
+
+	origins[clonedResource] = source
+}
+
+// collectSources builds the source map for the resources in a packaged template
+func collectSources(t *cft.Template) {
+	Sources = make(SourceMap)
+
+	resources, err := t.GetSection(cft.Resources)
+	if err == nil {
+		for i := 0; i+1 < len(resources.Content); i += 2 {
+			if source, ok := origins[resources.Content[i+1]]; ok {
+				Sources[resources.Content[i].Value] = source
+			}
+		}
+	}
+
+	origins = nil
+}
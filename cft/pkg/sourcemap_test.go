@@ -0,0 +1,57 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestSourceMap(t *testing.T) {
+	_, err := pkg.File("tmpl/awscli-modules/basic-template.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, ok := pkg.Sources["OtherResource"]
+	if !ok {
+		t.Fatal("expected OtherResource in the source map")
+	}
+	if other.File != "tmpl/awscli-modules/basic-template.yaml" || other.Line != 11 || other.Module != "" {
+		t.Errorf("unexpected origin for OtherResource: %+v", other.Origin)
+	}
+
+	bucket, ok := pkg.Sources["ContentBucket"]
+	if !ok {
+		t.Fatal("expected ContentBucket in the source map")
+	}
+	if got := bucket.Location(); got != "tmpl/awscli-modules/basic-module.yaml:5" {
+		t.Errorf("unexpected location for ContentBucket: %s", got)
+	}
+	if bucket.Module != "Content" {
+		t.Errorf("unexpected module for ContentBucket: %s", bucket.Module)
+	}
+
+	// Overridden properties point at the parent template
+	if got := bucket.Properties["OverrideMe"].Location(); got != "tmpl/awscli-modules/basic-template.yaml:9" {
+		t.Errorf("unexpected location for OverrideMe: %s", got)
+	}
+	if got := bucket.Properties["BucketName"].Location(); got != "tmpl/awscli-modules/basic-module.yaml:8" {
+		t.Errorf("unexpected location for BucketName: %s", got)
+	}
+}
+
+func TestSourceMapNested(t *testing.T) {
+	_, err := pkg.File("tmpl/awscli-modules/modinmod-template.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, ok := pkg.Sources["MySubInDirSubSubZ"]
+	if !ok {
+		t.Fatal("expected MySubInDirSubSubZ in the source map")
+	}
+	if source.Module != "My/SubInDir/SubSub" ||
+		source.Location() != "tmpl/awscli-modules/sub/subsub.yaml:2" {
+		t.Errorf("unexpected origin for MySubInDirSubSubZ: %+v", source.Origin)
+	}
+}
@@ -0,0 +1,15 @@
+#!/bin/sh
+# A custom directive for tests that looks up an AMI id by name
+input=$(cat)
+case "$input" in
+*"Value: al2023"*)
+    echo "ami-0a1b2c3d4e5f67890"
+    ;;
+*"Value: tagged"*)
+    echo "!Sub 'ami-\${AWS::Region}'"
+    ;;
+*)
+    echo "unknown image" >&2
+    exit 1
+    ;;
+esac
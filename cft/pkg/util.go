@@ -16,16 +16,20 @@
 //	`KeyProperty`: Name of returned property that will contain the object key
 //	`VersionProperty`: (optional) Name of returned property that will contain the object version
 //	`Extension`: (optional) Extension appended to the end of the Object Key in S3
+//	`Exclude`: (optional) .gitignore-style patterns for files to leave out of a zipped directory
 package pkg
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws-cloudformation/rain/internal/aws"
 	"github.com/aws-cloudformation/rain/internal/aws/s3"
@@ -49,7 +53,140 @@ func (s *s3Path) HTTP() string {
 
 var uploads = map[string]*s3Path{}
 
-func zipPath(root string) (string, error) {
+// UploadConcurrency is the number of assets that are uploaded to S3 at the same time
+var UploadConcurrency = 8
+
+// UploadSummary counts the assets that were uploaded while packaging a template
+type UploadSummary struct {
+	// Uploaded is the number of assets that were put into the bucket
+	Uploaded int
+
+	// Reused is the number of assets that were already in the bucket
+	Reused int
+}
+
+// String returns a summary like "Uploaded 2 assets to S3, reused 3"
+func (s UploadSummary) String() string {
+	noun := "assets"
+	if s.Uploaded == 1 {
+		noun = "asset"
+	}
+	return fmt.Sprintf("Uploaded %d %s to S3, reused %d", s.Uploaded, noun, s.Reused)
+}
+
+// Assets summarizes the uploads for the last template packaged by Template
+var Assets UploadSummary
+
+// NoUpload computes the S3 locations of assets without uploading them
+// or creating the artifact bucket
+var NoUpload bool
+
+// putAsset uploads content to the bucket, unless it is already there
+var putAsset = s3.UploadIfMissing
+
+// assetQueue uploads assets in the background with a bounded number of
+// workers. Object keys are based on the hash of the content, so they are
+// known before the uploads finish.
+type assetQueue struct {
+	// bucket is looked up once, the first time it is needed
+	bucket string
+
+	wg      sync.WaitGroup
+	sem     chan struct{}
+	mu      sync.Mutex
+	errs    []error
+	summary UploadSummary
+}
+
+var queue *assetQueue
+
+// startUploads starts a new queue of uploads for a template
+func startUploads() {
+	queue = &assetQueue{sem: make(chan struct{}, max(1, UploadConcurrency))}
+	Assets = UploadSummary{}
+}
+
+// add uploads content in the background
+func (q *assetQueue) add(name string, bucket string, content []byte, extension string) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+
+		q.sem <- struct{}{}
+		defer func() { <-q.sem }()
+
+		_, uploaded, err := putAsset(bucket, content, extension)
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if err != nil {
+			q.errs = append(q.errs, fmt.Errorf("unable to upload %s: %v", name, err))
+		} else if uploaded {
+			q.summary.Uploaded++
+		} else {
+			q.summary.Reused++
+		}
+	}()
+}
+
+// rainBucket returns the name of the artifact bucket. Looking it up is slow,
+// so it is only done once for each template.
+func rainBucket() string {
+	if queue != nil && queue.bucket != "" {
+		return queue.bucket
+	}
+
+	var bucket string
+	if NoUpload {
+		var err error
+		bucket, err = s3.RainBucketName()
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		bucket = s3.RainBucket(false)
+	}
+
+	if queue != nil {
+		queue.bucket = bucket
+	}
+	return bucket
+}
+
+// waitForUploads blocks until every upload in the queue has finished
+func waitForUploads() error {
+	if queue == nil {
+		return nil
+	}
+
+	queue.wg.Wait()
+	Assets = queue.summary
+	err := errors.Join(queue.errs...)
+	queue = nil
+
+	// Don't reuse the keys of uploads that failed
+	if err != nil {
+		uploads = map[string]*s3Path{}
+	}
+
+	return err
+}
+
+// zipEpoch is the modification time of every file in a zip archive, so that
+// the same files always produce the same archive. It is the earliest time
+// that a zip file can store.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// zipPath zips a file or directory into a temporary file. Entries are sorted,
+// and timestamps and permissions are normalised, so that the same content
+// always produces a byte-identical archive. Paths that match the
+// .gitignore-style exclude patterns are left out.
+func zipPath(root string, exclude []string) (string, error) {
+	ex, err := newExcluder(exclude)
+	if err != nil {
+		return "", err
+	}
+
 	tmpFile, err := os.CreateTemp(os.TempDir(), "*.zip")
 	if err != nil {
 		return "", err
@@ -68,27 +205,41 @@ func zipPath(root string) (string, error) {
 		zRoot = filepath.Dir(zRoot)
 	}
 
-	err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+	// WalkDir visits entries in lexical order
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.Mode().IsRegular() {
+		zPath, err := filepath.Rel(zRoot, path)
+		if err != nil {
+			return err
+		}
+
+		zPath = filepath.ToSlash(zPath)
+
+		if zPath != "." && ex.excluded(zPath, d.IsDir()) {
+			config.Debugf("Excluding %s from %s", zPath, root)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		in, err := os.Open(path)
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-		defer in.Close()
 
-		zPath, err := filepath.Rel(zRoot, path)
+		in, err := os.Open(path)
 		if err != nil {
 			return err
 		}
-
-		zPath = filepath.ToSlash(zPath)
+		defer in.Close()
 
 		fh, err := zip.FileInfoHeader(info)
 		if err != nil {
@@ -97,6 +248,15 @@ func zipPath(root string) (string, error) {
 
 		fh.Name = zPath
 		fh.Method = zip.Deflate
+		fh.Modified = zipEpoch
+
+		// Keep the executable bit, which matters for things like Lambda
+		// custom runtimes, but nothing else about the local permissions
+		mode := fs.FileMode(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		fh.SetMode(mode)
 
 		out, err := w.CreateHeader(fh)
 		if err != nil {
@@ -112,7 +272,7 @@ func zipPath(root string) (string, error) {
 
 // Upload a file or directory to S3.
 // If path is a directory, it will be zipped first.
-func upload(root, path string, force bool, extension string) (*s3Path, error) {
+func upload(root, path string, force bool, extension string, exclude []string) (*s3Path, error) {
 	if !filepath.IsAbs(path) {
 		path = filepath.Join(root, path)
 		if abs, err := filepath.Abs(path); err == nil {
@@ -124,6 +284,9 @@ func upload(root, path string, force bool, extension string) (*s3Path, error) {
 	if force {
 		artifactName = "zip:" + artifactName
 	}
+	if len(exclude) > 0 {
+		artifactName += "|exclude:" + strings.Join(exclude, ",")
+	}
 
 	if result, ok := uploads[artifactName]; ok {
 		config.Debugf("Using existing upload for: %s\n", path)
@@ -137,7 +300,7 @@ func upload(root, path string, force bool, extension string) (*s3Path, error) {
 
 	if info.IsDir() || force {
 		// Zip it!
-		zipped, err := zipPath(path)
+		zipped, err := zipPath(path, exclude)
 		if err != nil {
 			return nil, err
 		}
@@ -152,8 +315,26 @@ func upload(root, path string, force bool, extension string) (*s3Path, error) {
 		return nil, err
 	}
 
-	bucket := s3.RainBucket(false)
-	key, err := s3.Upload(bucket, content, extension)
+	bucket := rainBucket()
+	key := s3.Key(content, extension)
+
+	if NoUpload {
+		config.Debugf("Not uploading %s to %s", path, key)
+		return &s3Path{
+			bucket: bucket,
+			key:    key,
+			region: aws.Config().Region,
+		}, nil
+	}
+
+	if queue != nil {
+		queue.add(artifactName, bucket, content, extension)
+	} else {
+		_, _, err = putAsset(bucket, content, extension)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	uploads[artifactName] = &s3Path{
 		bucket: bucket,
@@ -161,7 +342,7 @@ func upload(root, path string, force bool, extension string) (*s3Path, error) {
 		region: aws.Config().Region,
 	}
 
-	return uploads[artifactName], err
+	return uploads[artifactName], nil
 }
 
 func expectString(n *yaml.Node) (string, error) {
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadQueue(t *testing.T) {
+	defer func(put func(string, []byte, string) (string, bool, error), n int) {
+		putAsset = put
+		UploadConcurrency = n
+	}(putAsset, UploadConcurrency)
+
+	var mu sync.Mutex
+	running := 0
+	maxRunning := 0
+	release := make(chan struct{})
+	full := make(chan struct{})
+	var fullOnce sync.Once
+
+	putAsset = func(bucket string, content []byte, extension string) (string, bool, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		if running == 2 {
+			fullOnce.Do(func() { close(full) })
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		// Pretend that odd numbered assets are already in the bucket
+		return "", content[0]%2 == 0, nil
+	}
+
+	UploadConcurrency = 2
+	startUploads()
+	for i := 0; i < 5; i++ {
+		queue.add(fmt.Sprintf("asset%d", i), "bucket", []byte{byte(i)}, "")
+	}
+
+	// Hold the uploads until two of them are running at the same time
+	select {
+	case <-full:
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("expected 2 uploads to run at the same time")
+	}
+	close(release)
+
+	err := waitForUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected 2 uploads at the same time, got %d", maxRunning)
+	}
+	if Assets.Uploaded != 3 || Assets.Reused != 2 {
+		t.Errorf("unexpected summary: %s", Assets)
+	}
+}
+
+func TestUploadQueueError(t *testing.T) {
+	defer func(put func(string, []byte, string) (string, bool, error)) {
+		putAsset = put
+	}(putAsset)
+
+	putAsset = func(bucket string, content []byte, extension string) (string, bool, error) {
+		return "", false, errors.New("access denied")
+	}
+
+	startUploads()
+	queue.add("lambda.zip", "bucket", []byte("code"), "")
+
+	err := waitForUploads()
+	if err == nil || err.Error() != "unable to upload lambda.zip: access denied" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// writeFiles creates files in dir with the given permissions
+func writeFiles(t *testing.T, dir string, files map[string]os.FileMode) {
+	for name, mode := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content of "+name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// zipNames returns the names and modes of the files in a zip archive
+func zipNames(t *testing.T, path string) map[string]os.FileMode {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	names := make(map[string]os.FileMode)
+	for _, f := range r.File {
+		names[f.Name] = f.Mode()
+	}
+	return names
+}
+
+func TestZipPathDeterministic(t *testing.T) {
+	files := map[string]os.FileMode{
+		"index.js":          0644,
+		"bootstrap":         0755,
+		"lib/util.js":       0600,
+		"lib/deep/thing.js": 0664,
+	}
+
+	a := t.TempDir()
+	writeFiles(t, a, files)
+
+	// The same files with different timestamps and permissions
+	b := t.TempDir()
+	writeFiles(t, b, files)
+	if err := os.Chmod(filepath.Join(b, "lib/util.js"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(b, "index.js"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	zipA, err := zipPath(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(zipA)
+	zipB, err := zipPath(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(zipB)
+
+	contentA, err := os.ReadFile(zipA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentB, err := os.ReadFile(zipB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contentA, contentB) {
+		t.Error("expected the same files to produce identical zips")
+	}
+
+	names := zipNames(t, zipA)
+	if names["bootstrap"] != 0755 || names["lib/util.js"] != 0644 {
+		t.Errorf("unexpected modes: %v", names)
+	}
+}
+
+func TestZipPathExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]os.FileMode{
+		"index.js":                  0644,
+		"index.test.js":             0644,
+		"README.md":                 0644,
+		"node_modules/a/index.js":   0644,
+		"build/out.js":              0644,
+		"src/build/keep.js":         0644,
+		"docs/guide.md":             0644,
+		"docs/important.md":         0644,
+		"src/__pycache__/x.pyc":     0644,
+		"src/handler/__init__.py":   0644,
+		"src/handler/handler.pyc":   0644,
+		"src/handler/data/skip.txt": 0644,
+	})
+
+	zipped, err := zipPath(dir, []string{
+		"# Comments are ignored",
+		"*.test.js",
+		"node_modules/",
+		"/build",
+		"docs/*.md",
+		"!docs/important.md",
+		"**/__pycache__",
+		"*.pyc",
+		"src/**/data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(zipped)
+
+	names := zipNames(t, zipped)
+	expected := []string{
+		"README.md",
+		"docs/important.md",
+		"index.js",
+		"src/build/keep.js",
+		"src/handler/__init__.py",
+	}
+	got := make([]string, 0)
+	for name := range names {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,240 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/visitor"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidateProperties checks the Properties that the parent template passes
+// to the module against the module's Parameters, so that mistakes are
+// reported during packaging instead of at deploy time.
+//
+// Every parameter without a Default must be set, with one exception: a
+// parameter that the module never refers to with Ref or Fn::Sub is optional,
+// since leaving it out is how IfParam and IfNotParam are switched, and
+// Fn::Invoke sets parameters after the parent's Properties are checked.
+//
+// Only literal values are checked. Intrinsic functions are resolved
+// by CloudFormation, so their values are not known here.
+func (module *Module) ValidateProperties() error {
+	if module.ParametersNode == nil || module.ParametersNode.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	props := module.Config.PropertiesNode
+	optional := module.optionalParameters()
+
+	for i := 0; i < len(module.ParametersNode.Content); i += 2 {
+		name := module.ParametersNode.Content[i].Value
+		param := module.ParametersNode.Content[i+1]
+		if param.Kind != yaml.MappingNode {
+			continue
+		}
+
+		key, val, _ := s11n.GetMapValue(props, name)
+		if val == nil {
+			_, def, _ := s11n.GetMapValue(param, Default)
+			if def == nil && !optional[name] {
+				return module.propertyError(name, module.Config.Node,
+					"is required because the module parameter has no Default")
+			}
+			continue
+		}
+
+		if err := checkParameterValue(param, val); err != nil {
+			line := val
+			if key != nil {
+				line = key
+			}
+			return module.propertyError(name, line, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// optionalParameters returns the parameters without a Default that can be
+// left out of the parent's Properties, because the module does not refer
+// to them with Ref or Fn::Sub
+func (module *Module) optionalParameters() map[string]bool {
+	refs := module.referencedParameters()
+	optional := make(map[string]bool)
+	for i := 0; i+1 < len(module.ParametersNode.Content); i += 2 {
+		name := module.ParametersNode.Content[i].Value
+		if !refs[name] {
+			optional[name] = true
+		}
+	}
+	return optional
+}
+
+var subParameter = regexp.MustCompile(`\$\{([^!][^}.]*)[^}]*\}`)
+
+// referencedParameters returns the names that the module refers
+// to with Ref or Fn::Sub, outside of the Parameters section
+func (module *Module) referencedParameters() map[string]bool {
+	refs := make(map[string]bool)
+	for i := 0; i+1 < len(module.Node.Content); i += 2 {
+		if module.Node.Content[i].Value == string(cft.Parameters) {
+			continue
+		}
+		vf := func(v *visitor.Visitor) {
+			n := v.GetYamlNode()
+			if n.Kind != yaml.MappingNode || len(n.Content) != 2 {
+				return
+			}
+			switch n.Content[0].Value {
+			case "Ref":
+				refs[n.Content[1].Value] = true
+			case "Fn::Sub":
+				sub := n.Content[1]
+				if sub.Kind == yaml.SequenceNode && len(sub.Content) > 0 {
+					sub = sub.Content[0]
+				}
+				for _, m := range subParameter.FindAllStringSubmatch(sub.Value, -1) {
+					refs[m[1]] = true
+				}
+			}
+		}
+		visitor.NewVisitor(module.Node.Content[i+1]).Visit(vf)
+	}
+	return refs
+}
+
+// propertyError returns an error that points at the parent template
+func (module *Module) propertyError(name string, n *yaml.Node, msg string) error {
+	s := fmt.Sprintf("module %s: property %s %s", module.Config.Name, name, msg)
+	if n != nil && n.Line > 0 {
+		s += fmt.Sprintf(" (line %d)", n.Line)
+	}
+	return fmt.Errorf("%s", s)
+}
+
+// isLiteral returns true if the value can be checked before deployment
+func isLiteral(n *yaml.Node) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	if n.Tag != "" && !strings.HasPrefix(n.Tag, "!!") {
+		return false
+	}
+	// Rain constants and ForEach identifiers are replaced later
+	return !strings.Contains(n.Value, "${") && !strings.Contains(n.Value, "&{")
+}
+
+// checkParameterValue checks a property value against the constraints of
+// a module parameter, using the same rules as CloudFormation
+func checkParameterValue(param *yaml.Node, val *yaml.Node) error {
+	paramType := "String"
+	if _, t, _ := s11n.GetMapValue(param, "Type"); t != nil {
+		paramType = t.Value
+	}
+
+	var values []string
+	isList := paramType == "CommaDelimitedList" || strings.HasPrefix(paramType, "List<")
+
+	switch {
+	case isList && val.Kind == yaml.SequenceNode:
+		for _, item := range val.Content {
+			if !isLiteral(item) {
+				return nil
+			}
+			values = append(values, item.Value)
+		}
+	case !isLiteral(val):
+		return nil
+	case isList:
+		for _, item := range strings.Split(val.Value, ",") {
+			values = append(values, strings.TrimSpace(item))
+		}
+	case val.Kind == yaml.ScalarNode:
+		values = []string{val.Value}
+	}
+
+	isNumber := paramType == "Number" || paramType == "List<Number>"
+
+	for _, v := range values {
+		if err := checkConstraints(param, v, isNumber); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkConstraints(param *yaml.Node, v string, isNumber bool) error {
+	if isNumber {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("value %q is not a Number", v)
+		}
+		if limit, ok, err := numberAttribute(param, "MinValue"); err != nil {
+			return err
+		} else if ok && n < limit {
+			return fmt.Errorf("value %s is less than MinValue %v", v, limit)
+		}
+		if limit, ok, err := numberAttribute(param, "MaxValue"); err != nil {
+			return err
+		} else if ok && n > limit {
+			return fmt.Errorf("value %s is greater than MaxValue %v", v, limit)
+		}
+	} else {
+		length := utf8.RuneCountInString(v)
+		if limit, ok, err := numberAttribute(param, "MinLength"); err != nil {
+			return err
+		} else if ok && float64(length) < limit {
+			return fmt.Errorf("value %q is shorter than MinLength %v", v, limit)
+		}
+		if limit, ok, err := numberAttribute(param, "MaxLength"); err != nil {
+			return err
+		} else if ok && float64(length) > limit {
+			return fmt.Errorf("value %q is longer than MaxLength %v", v, limit)
+		}
+		if _, pattern, _ := s11n.GetMapValue(param, "AllowedPattern"); pattern != nil {
+			// CloudFormation matches the pattern against the whole value
+			re, err := regexp.Compile("^(?:" + pattern.Value + ")$")
+			if err != nil {
+				return fmt.Errorf("has an invalid AllowedPattern %q: %v", pattern.Value, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("value %q does not match AllowedPattern %q", v, pattern.Value)
+			}
+		}
+	}
+
+	if _, allowed, _ := s11n.GetMapValue(param, "AllowedValues"); allowed != nil &&
+		allowed.Kind == yaml.SequenceNode {
+		var options []string
+		for _, a := range allowed.Content {
+			options = append(options, a.Value)
+		}
+		if !slices.Contains(options, v) {
+			return fmt.Errorf("value %q is not one of the AllowedValues [%s]",
+				v, strings.Join(options, ", "))
+		}
+	}
+
+	return nil
+}
+
+// numberAttribute returns the value of a numeric parameter attribute like MaxLength
+func numberAttribute(param *yaml.Node, name string) (float64, bool, error) {
+	_, n, _ := s11n.GetMapValue(param, name)
+	if n == nil {
+		return 0, false, nil
+	}
+	f, err := strconv.ParseFloat(n.Value, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("has an invalid %s %q", name, n.Value)
+	}
+	return f, true, nil
+}
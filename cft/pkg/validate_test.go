@@ -0,0 +1,109 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestValidateProperties(t *testing.T) {
+	runTest("validate", t)
+}
+
+func TestValidatePropertiesFail(t *testing.T) {
+	pkg.Experimental = true
+
+	module, err := filepath.Abs("tmpl/validate-module.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		props  string
+		expect string
+	}{
+		{"Env: prod", "module M: property Name is required because the module parameter has no Default (line 3)"},
+		{"Name: ab", `module M: property Name value "ab" is shorter than MinLength 3 (line 5)`},
+		{"Name: abcdefghijk", `property Name value "abcdefghijk" is longer than MaxLength 10`},
+		{"Name: ABC", `property Name value "ABC" does not match AllowedPattern "[a-z]+"`},
+		{"{Name: abc, Env: test}", `property Env value "test" is not one of the AllowedValues [dev, prod]`},
+		{"{Name: abc, Count: many}", `property Count value "many" is not a Number`},
+		{"{Name: abc, Count: 6}", "property Count value 6 is greater than MaxValue 5"},
+		{"{Name: abc, Count: 0}", "property Count value 0 is less than MinValue 1"},
+		{"{Name: abc, Ports: [80, http]}", `property Ports value "http" is not a Number`},
+		{"{Name: abc, Ports: '80,x'}", `property Ports value "x" is not a Number`},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "template.yaml")
+		source := "Modules:\n  M:\n    Source: " + module + "\n" +
+			"    Properties:\n      " + c.props + "\n"
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := pkg.File(path)
+		if err == nil {
+			t.Errorf("expected %s to fail", c.props)
+		} else if !strings.Contains(err.Error(), c.expect) {
+			t.Errorf("expected error to contain %q, got %q", c.expect, err.Error())
+		}
+	}
+}
+
+func TestValidateOptionalParameters(t *testing.T) {
+	pkg.Experimental = true
+
+	dir := t.TempDir()
+	module := filepath.Join(dir, "module.yaml")
+	err := os.WriteFile(module, []byte(`
+Parameters:
+  Name:
+    Type: String
+  Extra:
+    Type: String
+  Switch:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub ${Name}-${Extra}
+  Optional:
+    Type: AWS::S3::Bucket
+    Metadata:
+      Rain:
+        IfParam: Switch
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		// Switch is only used by IfParam, so it can be left out
+		"{Name: a, Extra: b}": "",
+		"{Name: a}":           "property Extra is required",
+		"{Extra: b}":          "property Name is required",
+	}
+	for props, expect := range cases {
+		path := filepath.Join(dir, "template.yaml")
+		source := "Modules:\n  M:\n    Source: " + module + "\n" +
+			"    Properties: " + props + "\n"
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := pkg.File(path)
+		switch {
+		case expect == "" && err != nil:
+			t.Errorf("%s: %v", props, err)
+		case expect != "" && err == nil:
+			t.Errorf("expected %s to fail", props)
+		case expect != "" && !strings.Contains(err.Error(), expect):
+			t.Errorf("expected error to contain %q, got %q", expect, err.Error())
+		}
+	}
+}
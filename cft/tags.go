@@ -1,5 +1,7 @@
 package cft
 
+import "strings"
+
 // Tags is a mapping from YAML short tags to full instrincic function names
 var Tags = map[string]string{
 	"!And":            "Fn::And",
@@ -30,3 +32,39 @@ var Tags = map[string]string{
 	"!InsertFile":     "Fn::InsertFile",
 	"!Merge":          "Fn::Merge",
 }
+
+// DirectivePrefix is the prefix of rain directives
+const DirectivePrefix = "Rain::"
+
+// CustomDirectivePrefix is the prefix of directives that projects define
+// themselves. Tags with this prefix are accepted even if they are not in Tags.
+const CustomDirectivePrefix = DirectivePrefix + "Custom::"
+
+// isCustomDirective returns true if name is in the custom directive namespace
+func isCustomDirective(name string) bool {
+	return strings.HasPrefix(name, CustomDirectivePrefix) && len(name) > len(CustomDirectivePrefix)
+}
+
+// FuncName returns the full function name for a short tag like !Sub
+func FuncName(tag string) (string, bool) {
+	if funcName, ok := Tags[tag]; ok {
+		return funcName, true
+	}
+	if strings.HasPrefix(tag, "!") && isCustomDirective(tag[1:]) {
+		return tag[1:], true
+	}
+	return "", false
+}
+
+// ShortTag returns the short tag for a full function name like Fn::Sub
+func ShortTag(funcName string) (string, bool) {
+	for tag, name := range Tags {
+		if name == funcName {
+			return tag, true
+		}
+	}
+	if isCustomDirective(funcName) {
+		return "!" + funcName, true
+	}
+	return "", false
+}
@@ -0,0 +1,32 @@
+package cft
+
+import "testing"
+
+func TestFuncName(t *testing.T) {
+	cases := map[string]string{
+		"!Sub":                 "Fn::Sub",
+		"!Rain::Embed":         "Rain::Embed",
+		"!Rain::Custom::Ami":   "Rain::Custom::Ami",
+		"!Rain::Embedd":        "",
+		"!Rain::Custom::":      "",
+		"!Rain::CustomThing":   "",
+		"!Unknown":             "",
+		"Rain::Custom::NoBang": "",
+	}
+	for tag, expected := range cases {
+		name, ok := FuncName(tag)
+		if name != expected || ok != (expected != "") {
+			t.Errorf("%s: expected %q, got %q, %v", tag, expected, name, ok)
+		}
+		if expected == "" {
+			continue
+		}
+		if short, ok := ShortTag(expected); !ok || short != tag {
+			t.Errorf("%s: expected the short tag to be %s, got %s", expected, tag, short)
+		}
+	}
+
+	if _, ok := ShortTag("Rain::Other"); ok {
+		t.Error("expected Rain::Other to stay a map key")
+	}
+}
@@ -6,14 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/aws-cloudformation/rain/internal/aws/replay"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console"
 	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	smithymiddleware "github.com/aws/smithy-go/middleware"
 )
@@ -33,6 +37,10 @@ func MFAProvider() (string, error) {
 var awsCfg *aws.Config
 var creds aws.Credentials
 
+// cfgMu guards awsCfg and creds so that clients can be created
+// from several goroutines at once
+var cfgMu sync.Mutex
+
 var defaultSessionName = fmt.Sprintf("%s-%s", config.NAME, config.VERSION)
 var lastSessionName = defaultSessionName
 
@@ -66,6 +74,21 @@ func loadConfig(ctx context.Context, sessionName string) *aws.Config {
 		config.Profile = p
 	}
 
+	// Serve recorded responses instead of calling AWS
+	var replayer *replay.Replayer
+	if config.ReplayDir != "" {
+		var err error
+		replayer, err = replay.NewReplayer(config.ReplayDir)
+		if err != nil {
+			panic(fmt.Errorf("unable to load recording: %v", err))
+		}
+		configs = append(configs, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider("replay", "replay", "")))
+		if config.Region == "" {
+			config.Region = replayer.Session.Region
+		}
+	}
+
 	// Supplied region
 	if config.Region != "" {
 		configs = append(configs, awsconfig.WithRegion(config.Region))
@@ -89,6 +112,23 @@ func loadConfig(ctx context.Context, sessionName string) *aws.Config {
 		panic(errors.New("could not establish AWS credentials; please run 'aws configure' or choose a profile"))
 	}
 
+	// The HTTP client is replaced after loading, since the SDK only
+	// allows custom CA bundles to be used with its own HTTP client
+	if replayer != nil {
+		cfg.HTTPClient = replayer
+	} else if config.RecordDir != "" {
+		// Save each request and response so they can be replayed later
+		next := cfg.HTTPClient
+		if next == nil {
+			next = awshttp.NewBuildableClient()
+		}
+		recorder, err := replay.NewRecorder(config.RecordDir, cfg.Region, next)
+		if err != nil {
+			panic(fmt.Errorf("unable to record to %s: %v", config.RecordDir, err))
+		}
+		cfg.HTTPClient = recorder
+	}
+
 	return &cfg
 }
 
@@ -100,6 +140,9 @@ func Config() aws.Config {
 // NamedConfig loads an aws.Config based on current settings
 // with configurable session name
 func NamedConfig(sessionName string) aws.Config {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+
 	message := "Loading AWS config"
 
 	if creds.CanExpire && time.Until(creds.Expires) < time.Minute {
@@ -122,5 +165,7 @@ func NamedConfig(sessionName string) aws.Config {
 
 // SetRegion is used to set the current AWS region
 func SetRegion(region string) {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
 	awsCfg.Region = region
 }
@@ -3,8 +3,10 @@ package ccapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/appscode/jsonpatch"
 	"github.com/aws-cloudformation/rain/cft/format"
@@ -14,14 +16,121 @@ import (
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	"github.com/aws/aws-sdk-go-v2/service/cloudcontrol"
 	"github.com/aws/aws-sdk-go-v2/service/cloudcontrol/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
+// PollInterval is how long to wait between checks on the status of a request
+var PollInterval = 2 * time.Second
+
 func getClient() *cloudcontrol.Client {
 	return cloudcontrol.NewFromConfig(aws.Config())
 }
 
+// HandlerError is returned when a resource handler reports that an operation failed
+type HandlerError struct {
+	Code    types.HandlerErrorCode
+	Message string
+}
+
+func (e *HandlerError) Error() string {
+	return e.Message
+}
+
+// retryableHandlerErrors are failures that might succeed if the operation is tried again
+var retryableHandlerErrors = []types.HandlerErrorCode{
+	types.HandlerErrorCodeThrottling,
+	types.HandlerErrorCodeResourceConflict,
+	types.HandlerErrorCodeServiceInternalError,
+	types.HandlerErrorCodeNetworkFailure,
+	types.HandlerErrorCodeInternalFailure,
+}
+
+// retryableAPIErrors are Cloud Control API errors for requests that were
+// rejected before anything was changed, and might succeed if made again
+var retryableAPIErrors = []string{
+	"ThrottlingException",
+	"ConcurrentOperationException",
+	"ServiceInternalErrorException",
+	"NetworkFailureException",
+	"HandlerInternalFailureException",
+}
+
+// RequestError is returned when Cloud Control API rejects a request, so no
+// operation was started and there is no request token to check
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// rejectedAPIErrors are the RequestError codes that mean the request can be
+// made again without any chance of repeating an operation
+var rejectedAPIErrors = []string{
+	"ThrottlingException",
+	"ConcurrentOperationException",
+}
+
+// IsRejected returns true if the request was throttled or conflicted with
+// another operation before Cloud Control API accepted it
+func IsRejected(err error) bool {
+	var re *RequestError
+	var ae smithy.APIError
+	if !errors.As(err, &re) || !errors.As(re.Err, &ae) {
+		return false
+	}
+	for _, code := range rejectedAPIErrors {
+		if ae.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound returns true if GetResource did not find the resource
+func IsNotFound(err error) bool {
+	var nf *types.ResourceNotFoundException
+	return errors.As(err, &nf)
+}
+
+// isThrottling returns true if the request was throttled
+func isThrottling(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && ae.ErrorCode() == "ThrottlingException"
+}
+
+// IsRetryable returns true if an error from CreateResource, UpdateResource,
+// or DeleteResource means the operation can be tried again
+func IsRetryable(err error) bool {
+	var he *HandlerError
+	if errors.As(err, &he) {
+		for _, code := range retryableHandlerErrors {
+			if he.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		for _, code := range retryableAPIErrors {
+			if ae.ErrorCode() == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // Returns true if the resource already exists
 func ResourceExists(typeName string, identifier []string) bool {
 
@@ -71,8 +180,8 @@ func printProgress(p *types.ProgressEvent) string {
 }
 
 // CreateResource creates a resource based on the YAML node from the template,
-// and blocks until resource creation is complete.
-func CreateResource(logicalId string, resource *yaml.Node) (identifier string, model string, err error) {
+// and blocks until resource creation is complete or the context is done.
+func CreateResource(ctx context.Context, logicalId string, resource *yaml.Node) (identifier string, model string, err error) {
 
 	clientToken := uuid.New().String()
 
@@ -91,16 +200,16 @@ func CreateResource(logicalId string, resource *yaml.Node) (identifier string, m
 		DesiredState: &props,
 		TypeName:     &typeName,
 	}
-	output, err := getClient().CreateResource(context.Background(), &input)
+	output, err := getClient().CreateResource(ctx, &input)
 
 	if err != nil {
-		return identifier, model, err
+		return identifier, model, &RequestError{Err: err}
 	}
 
 	config.Debugf("CreateResource output:\n%v", printProgress(output.ProgressEvent))
 
 	progress := output.ProgressEvent
-	identifier, model, err = pollForCompletion(progress)
+	identifier, model, err = pollForCompletion(ctx, progress)
 	if err != nil {
 		return identifier, model, err
 	}
@@ -134,8 +243,9 @@ func GetResource(identifier string, typeName string) (string, error) {
 
 }
 
-// pollForCompletion checks for progress until the operation is complete or fails
-func pollForCompletion(progress *types.ProgressEvent) (string, string, error) {
+// pollForCompletion checks for progress until the operation is complete or fails.
+// It stops waiting if the context is done, which does not cancel the operation.
+func pollForCompletion(ctx context.Context, progress *types.ProgressEvent) (string, string, error) {
 
 	var identifier string
 	var model string
@@ -166,7 +276,7 @@ func pollForCompletion(progress *types.ProgressEvent) (string, string, error) {
 			if progress.StatusMessage != nil {
 				msg = *progress.StatusMessage
 			}
-			return identifier, model, fmt.Errorf("%v", msg)
+			return identifier, model, &HandlerError{Code: progress.ErrorCode, Message: msg}
 		case "CANCEL_IN_PROGRESS":
 			done = false
 		case "CANCEL_COMPLETE":
@@ -176,10 +286,21 @@ func pollForCompletion(progress *types.ProgressEvent) (string, string, error) {
 		}
 
 		if !done {
-			status, statusErr := getClient().GetResourceRequestStatus(context.Background(),
+			select {
+			case <-ctx.Done():
+				return identifier, model, ctx.Err()
+			case <-time.After(PollInterval):
+			}
+
+			status, statusErr := getClient().GetResourceRequestStatus(ctx,
 				&cloudcontrol.GetResourceRequestStatusInput{
 					RequestToken: progress.RequestToken,
 				})
+			if isThrottling(statusErr) {
+				// The operation is still running, so check again later
+				config.Debugf("GetResourceRequestStatus throttled: %v", statusErr)
+				continue
+			}
 			if statusErr != nil {
 				return identifier, model, statusErr // Is this terminal?
 				// This is not a deployment failure. Network issue?
@@ -233,8 +354,9 @@ func CreatePatch(props *yaml.Node, priorJson string) (string, error) {
 }
 
 // UpdateResource updates a resource based on the YAML node from the template,
-// and blocks until resource update is complete.
+// and blocks until resource update is complete or the context is done.
 func UpdateResource(
+	ctx context.Context,
 	logicalId string,
 	identifier string,
 	resource *yaml.Node,
@@ -280,7 +402,7 @@ func UpdateResource(
 		TypeName:      &typeName,
 		Identifier:    &identifier,
 	}
-	output, err := getClient().UpdateResource(context.Background(), &input)
+	output, err := getClient().UpdateResource(ctx, &input)
 	if err != nil {
 		return model, err
 	}
@@ -288,7 +410,7 @@ func UpdateResource(
 	config.Debugf("UpdateResource output:\n%v", printProgress(output.ProgressEvent))
 
 	progress := output.ProgressEvent
-	_, model, err = pollForCompletion(progress)
+	_, model, err = pollForCompletion(ctx, progress)
 	if err != nil {
 		return model, err
 	}
@@ -304,7 +426,8 @@ func UpdateResource(
 }
 
 // DeleteResource deletes a resource and blocks until the operation is complete
-func DeleteResource(logicalId string, identifier string, resource *yaml.Node) error {
+// or the context is done
+func DeleteResource(ctx context.Context, logicalId string, identifier string, resource *yaml.Node) error {
 	if logicalId == "" {
 		return fmt.Errorf("logicalId is required for DeleteResource")
 	}
@@ -328,7 +451,7 @@ func DeleteResource(logicalId string, identifier string, resource *yaml.Node) er
 		TypeName:    &typeName,
 		Identifier:  &identifier,
 	}
-	output, err := getClient().DeleteResource(context.Background(), &input)
+	output, err := getClient().DeleteResource(ctx, &input)
 
 	if err != nil {
 		return err
@@ -337,7 +460,7 @@ func DeleteResource(logicalId string, identifier string, resource *yaml.Node) er
 	config.Debugf("DeleteResource output:\n%v", printProgress(output.ProgressEvent))
 
 	progress := output.ProgressEvent
-	_, _, err = pollForCompletion(progress)
+	_, _, err = pollForCompletion(ctx, progress)
 	if err != nil {
 		return err
 	}
@@ -1,10 +1,14 @@
 package ccapi
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/aws-cloudformation/rain/cft/parse"
 	"github.com/aws-cloudformation/rain/internal/s11n"
+	"github.com/aws/aws-sdk-go-v2/service/cloudcontrol/types"
+	"github.com/aws/smithy-go"
 )
 
 func TestPatch(t *testing.T) {
@@ -73,3 +77,40 @@ Resources:
 	}
 
 }
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{&HandlerError{Code: types.HandlerErrorCodeThrottling, Message: "slow down"}, true},
+		{&HandlerError{Code: types.HandlerErrorCodeInternalFailure, Message: "oops"}, true},
+		{&HandlerError{Code: types.HandlerErrorCodeAccessDenied, Message: "denied"}, false},
+		{fmt.Errorf("wrapped: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}), true},
+		{&smithy.GenericAPIError{Code: "ValidationException"}, false},
+		{errors.New("something else"), false},
+	}
+	for _, c := range cases {
+		if got := IsRetryable(c.err); got != c.expected {
+			t.Errorf("IsRetryable(%v): expected %v, got %v", c.err, c.expected, got)
+		}
+	}
+}
+
+func TestIsRejected(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{&RequestError{Err: &smithy.GenericAPIError{Code: "ThrottlingException"}}, true},
+		{&RequestError{Err: &smithy.GenericAPIError{Code: "ConcurrentOperationException"}}, true},
+		{&RequestError{Err: &smithy.GenericAPIError{Code: "ServiceInternalErrorException"}}, false},
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, false},
+		{&HandlerError{Code: types.HandlerErrorCodeThrottling, Message: "slow down"}, false},
+	}
+	for _, c := range cases {
+		if got := IsRejected(c.err); got != c.expected {
+			t.Errorf("IsRejected(%v): expected %v, got %v", c.err, c.expected, got)
+		}
+	}
+}
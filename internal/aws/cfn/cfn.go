@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/smithy-go"
@@ -55,6 +56,10 @@ const WaitPeriodInSeconds = 2
 
 var Schemas map[string]string
 
+// schemasMu guards Schemas, since schemas can be requested from
+// several goroutines at once (for example by rain forecast)
+var schemasMu sync.RWMutex
+
 //go:embed all-types.txt
 var AllTypes string
 
@@ -481,7 +486,9 @@ func WaitUntilStackCreateComplete(stackName string) error {
 func GetTypeSchema(name string, cacheUsage ResourceCacheUsage) (string, error) {
 
 	// Check for a schema in memory
+	schemasMu.RLock()
 	schema, exists := Schemas[name]
+	schemasMu.RUnlock()
 	if exists && cacheUsage != DoNotUseCache {
 		return schema, nil
 	}
@@ -494,7 +501,9 @@ func GetTypeSchema(name string, cacheUsage ResourceCacheUsage) (string, error) {
 		b, err := schemaFiles.ReadFile(path)
 		if err == nil {
 			s := string(b)
+			schemasMu.Lock()
 			Schemas[name] = s
+			schemasMu.Unlock()
 			return s, nil
 		} else {
 			config.Debugf("unable to read schema from path %s: %v", path, err)
@@ -513,7 +522,9 @@ func GetTypeSchema(name string, cacheUsage ResourceCacheUsage) (string, error) {
 		config.Debugf("GetTypeSchema SDK error: %v", err)
 		return "", err
 	}
+	schemasMu.Lock()
 	Schemas[name] = *res.Schema
+	schemasMu.Unlock()
 	return *res.Schema, nil
 }
 
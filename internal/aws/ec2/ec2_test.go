@@ -0,0 +1,21 @@
+package ec2
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/internal/config"
+)
+
+// TestCheckKeyPairExists uses a recorded response, created with --record
+func TestCheckKeyPairExists(t *testing.T) {
+	config.ReplayDir = "testdata/replay"
+	defer func() { config.ReplayDir = "" }()
+
+	exists, err := CheckKeyPairExists("my-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Errorf("expected my-key to exist")
+	}
+}
@@ -10,7 +10,6 @@ import (
 
 	"github.com/aws-cloudformation/rain/internal/aws"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	awsgo "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -57,78 +56,58 @@ func convertAssumeRoleToRole(stsResArn string) string {
 	return fmt.Sprintf("arn:aws:iam::%v:role/%v", accountId, actualRoleName)
 }
 
-// Simulate actions on a resource.
-// The role arg is optional, if not provided, the current aws config will be used.
-func Simulate(
-	actions []string,
-	resource string,
-	roleArn string,
-	spinnerCallback func(string)) (bool, []string) {
+// SimulateAction simulates a single action on a resource.
+// The role arg is the principal whose policies are simulated.
+// The returned messages describe each evaluation that was not allowed.
+func SimulateAction(action string, resource string, roleArn string) (bool, []string, error) {
 
-	awsConfig := aws.Config()
-	client := iam.NewFromConfig(awsConfig)
 	input := &iam.SimulatePrincipalPolicyInput{}
 	input.ResourceArns = []string{resource}
-
-	messages := make([]string, 0)
-
 	input.PolicySourceArn = &roleArn
+	input.ActionNames = []string{action}
 
-	// Return value
-	allowed := true
+	res, err := getClient().SimulatePrincipalPolicy(context.Background(), input)
+	if err != nil {
+		/*
+			Policy simulation failed operation error IAM:
+			SimulatePrincipalPolicy, https response error StatusCode: 400,
+			RequestID: 2d02e533-05ae-4202-acad-caeefa16757e,
+			InvalidInput: Invalid Entity Arn:
+			arn:aws:sts::755952356119:assumed-role/Admin/ezbeard-Isengard
+			does not clearly define entity type and name.
+
+			This is the actual role: arn:aws:iam::755952356119:role/Admin
+
+			(Correcting for this in getCallerArn)
+
+		*/
+
+		/*
+			Policy simulation failed operation error IAM:
+			SimulatePrincipalPolicy, https response error StatusCode: 400,
+			RequestID: 0f38824c-7f07-491b-a156-b5fb9fdd03fc,
+			InvalidInput: Invalid Input Actions:
+			[s3:CreateBucket,s3:PutBucketTagging,s3:PutAnalyticsConfiguration,s3:PutEncryptionConfiguration,s3:PutBucketCORS,s3:PutInventoryConfiguration,s3:PutLifecycleConfiguration,s3:PutMetricsConfiguration,s3:PutBucketNotification,s3:PutBucketWebsite,s3:PutAccelerateConfiguration,s3:PutBucketPublicAccessBlock,s3:PutReplicationConfiguration,s3:PutObjectAcl,s3:PutBucketObjectLockConfiguration,s3:GetBucketAcl,s3:ListBucket,iam:PassRole,s3:DeleteObject,s3:PutBucketLogging,s3:PutBucketVersioning,s3:PutBucketOwnershipControls]
+			and
+			[s3:PutBucketReplication,s3:PutObjectLockConfiguration,s3:PutBucketIntelligentTieringConfiguration]
+			require different authorization information.
+			Please refer to the documentation for more details: https://docs.aws.amazon.com/IAM/latest/APIReference/API_SimulatePrincipalPolicy.html
+
+			(The docs don't have any more details...)
+			Checking them one at a time to get around this.
+		*/
+		return false, nil, err
+	}
 
-	// We have to check these one at a time since we can't easily predict
-	// which of the actions we get from the type description schema have
-	// different authorization types
-	for _, action := range actions {
-		input.ActionNames = []string{action}
-
-		spinnerCallback(action)
-
-		res, err := client.SimulatePrincipalPolicy(context.Background(), input)
-
-		spinner.Pop()
-
-		if err != nil {
-			/*
-				Policy simulation failed operation error IAM:
-				SimulatePrincipalPolicy, https response error StatusCode: 400,
-				RequestID: 2d02e533-05ae-4202-acad-caeefa16757e,
-				InvalidInput: Invalid Entity Arn:
-				arn:aws:sts::755952356119:assumed-role/Admin/ezbeard-Isengard
-				does not clearly define entity type and name.
-
-				This is the actual role: arn:aws:iam::755952356119:role/Admin
-
-				(Correcting for this in getCallerArn)
-
-			*/
-
-			/*
-				Policy simulation failed operation error IAM:
-				SimulatePrincipalPolicy, https response error StatusCode: 400,
-				RequestID: 0f38824c-7f07-491b-a156-b5fb9fdd03fc,
-				InvalidInput: Invalid Input Actions:
-				[s3:CreateBucket,s3:PutBucketTagging,s3:PutAnalyticsConfiguration,s3:PutEncryptionConfiguration,s3:PutBucketCORS,s3:PutInventoryConfiguration,s3:PutLifecycleConfiguration,s3:PutMetricsConfiguration,s3:PutBucketNotification,s3:PutBucketWebsite,s3:PutAccelerateConfiguration,s3:PutBucketPublicAccessBlock,s3:PutReplicationConfiguration,s3:PutObjectAcl,s3:PutBucketObjectLockConfiguration,s3:GetBucketAcl,s3:ListBucket,iam:PassRole,s3:DeleteObject,s3:PutBucketLogging,s3:PutBucketVersioning,s3:PutBucketOwnershipControls]
-				and
-				[s3:PutBucketReplication,s3:PutObjectLockConfiguration,s3:PutBucketIntelligentTieringConfiguration]
-				require different authorization information.
-				Please refer to the documentation for more details: https://docs.aws.amazon.com/IAM/latest/APIReference/API_SimulatePrincipalPolicy.html
-
-				(The docs don't have any more details...)
-				Checking them one at a time to get around this.
-			*/
-			messages = append(messages, err.Error())
-			return false, messages
-		}
-		for _, evalResult := range res.EvaluationResults {
-			if evalResult.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
-				messages = append(messages, fmt.Sprintf("%v not allowed on %v", *evalResult.EvalActionName, *evalResult.EvalResourceName))
-				allowed = false
-			}
+	allowed := true
+	messages := make([]string, 0)
+	for _, evalResult := range res.EvaluationResults {
+		if evalResult.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
+			messages = append(messages, fmt.Sprintf("%v not allowed on %v", *evalResult.EvalActionName, *evalResult.EvalResourceName))
+			allowed = false
 		}
 	}
-	return allowed, messages
+	return allowed, messages, nil
 }
 
 func GetRoleNameFromArn(roleArn string) (string, error) {
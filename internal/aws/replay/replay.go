@@ -0,0 +1,316 @@
+// Package replay records AWS API requests and responses to a directory,
+// and serves them back later without making any calls to AWS.
+// This makes it possible to test code that calls the SDK, and to reproduce
+// issues from a recording that a user attached to a bug report.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+)
+
+// SessionFile is the name of the file that stores settings for the recording
+const SessionFile = "session.json"
+
+// Session stores settings that are needed to replay a recording
+type Session struct {
+	Region string
+}
+
+// Request is the part of an HTTP request that we record.
+// Credentials and signatures are never recorded.
+type Request struct {
+	Service   string
+	Operation string
+	Method    string
+	URL       string
+	Target    string `json:",omitempty"`
+	BodyHash  string
+	Body      string `json:",omitempty"`
+	Encoding  string `json:",omitempty"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string `json:",omitempty"`
+	Encoding   string `json:",omitempty"`
+}
+
+// Interaction is a single recorded request and its response
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// key is used to match a live request with a recorded interaction
+func (r Request) key() string {
+	return r.Service + "/" + r.Operation
+}
+
+// encode returns the body as a string, using base64 if it is not valid UTF-8
+func encode(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decode(body string, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// readRequest reads the body of the request and replaces it
+// so that it can be sent on to the next client
+func readRequest(req *http.Request) (Request, error) {
+	ctx := req.Context()
+
+	r := Request{
+		Service:   awsmiddleware.GetServiceID(ctx),
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		Target:    req.Header.Get("X-Amz-Target"),
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return r, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	sum := sha256.Sum256(body)
+	r.BodyHash = hex.EncodeToString(sum[:])
+	r.Body, r.Encoding = encode(body)
+
+	return r, nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Recorder is an aws.HTTPClient that saves each interaction to Dir
+type Recorder struct {
+	Dir  string
+	Next aws.HTTPClient
+
+	mu    sync.Mutex
+	count int
+}
+
+// NewRecorder creates a Recorder that writes to dir, creating it if necessary
+func NewRecorder(dir string, region string, next aws.HTTPClient) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	session, err := json.MarshalIndent(Session{Region: region}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, SessionFile), session, 0644); err != nil {
+		return nil, err
+	}
+
+	// Continue numbering after any interactions that were already recorded
+	// in this directory, for example if the config was reloaded
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Name() != SessionFile && strings.HasSuffix(entry.Name(), ".json") {
+			count++
+		}
+	}
+
+	return &Recorder{Dir: dir, Next: next, count: count}, nil
+}
+
+// Do sends the request to the next client and records the result
+func (rec *Recorder) Do(req *http.Request) (*http.Response, error) {
+	recorded, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := rec.Next.Do(req)
+	if err != nil {
+		return res, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     res.Header,
+		},
+	}
+	interaction.Response.Body, interaction.Response.Encoding = encode(body)
+
+	out, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	rec.mu.Lock()
+	rec.count++
+	name := fmt.Sprintf("%04d-%s-%s.json", rec.count,
+		unsafeChars.ReplaceAllString(recorded.Service, ""),
+		unsafeChars.ReplaceAllString(recorded.Operation, ""))
+	rec.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(rec.Dir, name), out, 0644); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Replayer is an aws.HTTPClient that serves recorded interactions
+type Replayer struct {
+	Session Session
+
+	mu           sync.Mutex
+	interactions map[string][]*Interaction
+	used         map[*Interaction]bool
+}
+
+// NewReplayer loads all of the interactions that were recorded in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	rep := &Replayer{
+		interactions: make(map[string][]*Interaction),
+		used:         make(map[*Interaction]bool),
+	}
+
+	session, err := os.ReadFile(filepath.Join(dir, SessionFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s from %s: %v", SessionFile, dir, err)
+	}
+	if err := json.Unmarshal(session, &rep.Session); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// File names start with a sequence number, so this
+	// puts the interactions in the order they were recorded
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == SessionFile || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(b, &interaction); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %v", name, err)
+		}
+		key := interaction.Request.key()
+		rep.interactions[key] = append(rep.interactions[key], &interaction)
+	}
+
+	return rep, nil
+}
+
+// ErrNotRecorded is returned when there is no recorded response for a request
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Do returns the recorded response for the request.
+// Interactions for the same operation are served in the order they were
+// recorded, preferring one with an identical request body. Bodies can differ
+// between runs, for example when they contain a client request token.
+func (rep *Replayer) Do(req *http.Request) (*http.Response, error) {
+	r, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rep.mu.Lock()
+	var found *Interaction
+	for _, candidate := range rep.interactions[r.key()] {
+		if rep.used[candidate] {
+			continue
+		}
+		if candidate.Request.BodyHash == r.BodyHash {
+			found = candidate
+			break
+		}
+		if found == nil {
+			found = candidate
+		}
+	}
+	if found != nil {
+		rep.used[found] = true
+	}
+	rep.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, r.Service, r.Operation)
+	}
+
+	body, err := decode(found.Response.Body, found.Response.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	header := found.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", found.Response.StatusCode, http.StatusText(found.Response.StatusCode)),
+		StatusCode:    found.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const callerIdentity = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::%s:user/test</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>%s</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata>
+    <RequestId>01234567-89ab-cdef-0123-456789abcdef</RequestId>
+  </ResponseMetadata>
+</GetCallerIdentityResponse>`
+
+func newClient(httpClient aws.HTTPClient, endpoint string) *sts.Client {
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", "TOKEN"),
+		HTTPClient:  httpClient,
+	}
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "text/xml")
+		account := fmt.Sprintf("00000000000%d", n)
+		fmt.Fprintf(w, callerIdentity, account, account)
+	}))
+
+	recorder, err := NewRecorder(dir, "us-east-1", awshttp.NewBuildableClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newClient(recorder, server.URL)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The replay should work without the server
+	server.Close()
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayer.Session.Region != "us-east-1" {
+		t.Errorf("unexpected region: %v", replayer.Session.Region)
+	}
+
+	client = newClient(replayer, server.URL)
+
+	// Responses are served in the order they were recorded
+	for _, expected := range []string{"000000000001", "000000000002"} {
+		res, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *res.Account != expected {
+			t.Errorf("expected account %v, got %v", expected, *res.Account)
+		}
+	}
+
+	// Nothing is left to replay
+	_, err = client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, body := range [][]byte{[]byte("plain text"), {0xff, 0xfe, 0x00}} {
+		s, enc := encode(body)
+		decoded, err := decode(s, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != string(body) {
+			t.Errorf("expected %v, got %v", body, decoded)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/ptr"
 
 	"github.com/aws-cloudformation/rain/internal/aws"
@@ -172,27 +173,53 @@ func CreateBucket(bucketName string) error {
 	return err
 }
 
+// Key returns the key that Upload uses for content, which is based on its hash
+func Key(content []byte, extension string) string {
+	key := filepath.Join(BucketKeyPrefix, fmt.Sprintf("%x", sha256.Sum256(content)))
+	if extension != "" {
+		key = fmt.Sprintf("%s.%s", key, extension)
+	}
+	return key
+}
+
 // Upload uploads an artifact to the bucket with a unique name
 func Upload(bucketName string, content []byte, extension string) (string, error) {
+	key, _, err := UploadIfMissing(bucketName, content, extension)
+	return key, err
+}
+
+// UploadIfMissing uploads an artifact to the bucket with a name that is
+// based on its content, unless an object with that name already exists.
+// It returns the key and whether the content was uploaded.
+func UploadIfMissing(bucketName string, content []byte, extension string) (string, bool, error) {
 	isBucketExists, errBucketExists := BucketExists(bucketName)
 
 	if errBucketExists != nil {
-		return "", fmt.Errorf("unable to confirm whether artifact bucket exists: %w", errBucketExists)
+		return "", false, fmt.Errorf("unable to confirm whether artifact bucket exists: %w", errBucketExists)
 	}
 
 	if !isBucketExists {
-		return "", fmt.Errorf("bucket does not exist: '%s'", bucketName)
+		return "", false, fmt.Errorf("bucket does not exist: '%s'", bucketName)
 	}
 
-	key := filepath.Join(BucketKeyPrefix, fmt.Sprintf("%x", sha256.Sum256(content)))
-	if extension != "" {
-		key = fmt.Sprintf("%s.%s", key, extension)
-	}
+	key := Key(content, extension)
 
 	accountId, err := getAccountId()
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+
+	// The key is a hash of the content, so an existing object is the same artifact
+	_, err = getClient().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket:              ptr.String(bucketName),
+		Key:                 ptr.String(key),
+		ExpectedBucketOwner: awssdk.String(accountId),
+	})
+	if err == nil {
+		config.Debugf("Artifact already exists: %s", key)
+		return key, false, nil
 	}
+	config.Debugf("HeadObject %s: %v", key, err)
 
 	_, err = getClient().PutObject(context.Background(), &s3.PutObjectInput{
 		Bucket:              ptr.String(bucketName),
@@ -203,19 +230,15 @@ func Upload(bucketName string, content []byte, extension string) (string, error)
 
 	config.Debugf("Artifact key: %s", key)
 
-	return key, err
+	return key, err == nil, err
 }
 
-// RainBucket returns the name of the rain deployment bucket in the current region
-// and asks the user if they wish it to be created if it does not exist
-// unless forceCreation is true, then it will not ask.
-// If a blank string is passed in, we look for a parameter store key named "rain-bucket".
-// If that doesn't exist, we use "rain-artifacts-accountid-region".
-// If a non-blank string is passed in, we create that bucket if it doesn't exist.
-func RainBucket(forceCreation bool) string {
+// RainBucketName returns the name of the rain artifacts bucket without
+// checking that it exists or creating it
+func RainBucketName() (string, error) {
 	accountID, err := sts.GetAccountID()
 	if err != nil {
-		panic(fmt.Errorf("unable to get account ID: %w", err))
+		return "", fmt.Errorf("unable to get account ID: %w", err)
 	}
 
 	// --bucket-name is passed in as an arg to various commands
@@ -236,6 +259,21 @@ func RainBucket(forceCreation bool) string {
 		}
 	}
 
+	return bucketName, nil
+}
+
+// RainBucket returns the name of the rain deployment bucket in the current region
+// and asks the user if they wish it to be created if it does not exist
+// unless forceCreation is true, then it will not ask.
+// If a blank string is passed in, we look for a parameter store key named "rain-bucket".
+// If that doesn't exist, we use "rain-artifacts-accountid-region".
+// If a non-blank string is passed in, we create that bucket if it doesn't exist.
+func RainBucket(forceCreation bool) string {
+	bucketName, err := RainBucketName()
+	if err != nil {
+		panic(err)
+	}
+
 	config.Debugf("Artifact bucket: %s", bucketName)
 
 	isBucketExists, err := BucketExists(bucketName)
@@ -476,6 +514,134 @@ func PutObject(bucketName string, key string, body []byte) error {
 	return err
 }
 
+// Condition makes a write depend on the current version of an object.
+// IfMatch is the ETag that the object must have, and IfNoneMatch
+// is "*" to only write the object if it does not exist.
+type Condition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// ErrPreconditionFailed is returned by conditional writes
+// when the object has been changed by someone else
+var ErrPreconditionFailed = errors.New("the object was changed by another process")
+
+// conditionError converts the errors S3 returns when a
+// condition is not met to ErrPreconditionFailed
+func conditionError(err error) error {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		switch ae.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+		}
+	}
+	return err
+}
+
+// GetObjectVersion gets an object along with its ETag, which
+// can be passed to PutObjectIf to make sure it has not changed
+func GetObjectVersion(bucketName string, key string) ([]byte, string, error) {
+	accountId, err := getAccountId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := getClient().GetObject(context.Background(),
+		&s3.GetObjectInput{
+			Bucket:              &bucketName,
+			Key:                 &key,
+			ExpectedBucketOwner: awssdk.String(accountId),
+		})
+	if err != nil {
+		return nil, "", err
+	}
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, awssdk.ToString(result.ETag), nil
+}
+
+// PutObjectIf puts an object into a bucket if the condition is met,
+// and returns the ETag of the new object. ErrPreconditionFailed is
+// returned if the condition was not met.
+func PutObjectIf(bucketName string, key string, body []byte, condition Condition) (string, error) {
+	accountId, err := getAccountId()
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:              &bucketName,
+		Key:                 &key,
+		Body:                bytes.NewReader(body),
+		ExpectedBucketOwner: awssdk.String(accountId),
+	}
+	if condition.IfMatch != "" {
+		input.IfMatch = &condition.IfMatch
+	}
+	if condition.IfNoneMatch != "" {
+		input.IfNoneMatch = &condition.IfNoneMatch
+	}
+
+	result, err := getClient().PutObject(context.Background(), input)
+	if err != nil {
+		return "", conditionError(err)
+	}
+	return awssdk.ToString(result.ETag), nil
+}
+
+// DeleteObjectIf deletes an object if it still has the ETag that was
+// passed in. ErrPreconditionFailed is returned if it has changed.
+func DeleteObjectIf(bucketName string, key string, etag string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+	}
+	if etag != "" {
+		input.IfMatch = &etag
+	}
+	_, err := getClient().DeleteObject(context.Background(), input)
+	return conditionError(err)
+}
+
+// ListObjectKeys returns the keys of all objects in a bucket
+// that start with the prefix
+func ListObjectKeys(bucketName string, prefix string) ([]string, error) {
+	accountId, err := getAccountId()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0)
+	input := &s3.ListObjectsV2Input{
+		Bucket:              &bucketName,
+		Prefix:              &prefix,
+		ExpectedBucketOwner: awssdk.String(accountId),
+	}
+	paginator := s3.NewListObjectsV2Paginator(getClient(), input)
+	for paginator.HasMorePages() {
+		res, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range res.Contents {
+			keys = append(keys, awssdk.ToString(item.Key))
+		}
+	}
+	return keys, nil
+}
+
+// IsNotFound returns true if the error means that the object or bucket does not exist
+func IsNotFound(err error) bool {
+	var nk *types.NoSuchKey
+	var nb *types.NoSuchBucket
+	var nf *types.NotFound
+	return errors.As(err, &nk) || errors.As(err, &nb) || errors.As(err, &nf)
+}
+
 // DeleteObject deletes an object from a bucket
 func DeleteObject(bucketName string, key string, version *string) error {
 	_, err := getClient().DeleteObject(context.Background(),
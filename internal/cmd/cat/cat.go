@@ -2,18 +2,29 @@ package cat
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/eval"
 	"github.com/aws-cloudformation/rain/cft/format"
 	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/aws"
 	"github.com/aws-cloudformation/rain/internal/aws/cfn"
 	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/dc"
+	"github.com/aws-cloudformation/rain/internal/s11n"
 	"github.com/aws-cloudformation/rain/internal/ui"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go/ptr"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var transformed = false
 var unformatted = false
 var config = false
+var render = false
+var paramsFile string
 
 // Cmd is the cat command's entrypoint
 var Cmd = &cobra.Command{
@@ -22,12 +33,21 @@ var Cmd = &cobra.Command{
 	Long: `Downloads the template or the configuration file used to deploy <stack> and prints it to stdout.
 
 The  ` + "`" + `--config` + "`" + ` flag can be used to get the rain config file for the stack instead of the template.
+
+The ` + "`" + `--render` + "`" + ` flag evaluates intrinsic functions in the template using the stack's parameter values,
+to show the effective template. Use ` + "`" + `--params-file` + "`" + ` with a config file in the same format used by
+"rain deploy --config" to render it with different parameter values. Use "rain render" to do the same
+for a local template and config file.
 `,
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		stackName := args[0]
 
+		if paramsFile != "" && !render {
+			panic("--params-file can only be used with --render")
+		}
+
 		// Output the config file if requested instead of the template
 		if config {
 			spinner.Push(fmt.Sprintf("Getting config from stack '%s'", stackName))
@@ -53,7 +73,7 @@ The  ` + "`" + `--config` + "`" + ` flag can be used to get the rain config file
 		}
 		spinner.Pop()
 
-		if unformatted {
+		if unformatted && !render {
 			fmt.Println(template)
 		} else {
 			t, err := parse.String(template)
@@ -61,6 +81,31 @@ The  ` + "`" + `--config` + "`" + ` flag can be used to get the rain config file
 				panic(ui.Errorf(err, "failed to parse template for stack '%s'", stackName))
 			}
 
+			if render {
+				spinner.Push(fmt.Sprintf("Getting parameters from stack '%s'", stackName))
+				stack, err := cfn.GetStack(stackName)
+				if err != nil {
+					panic(ui.Errorf(err, "failed to get stack '%s'", stackName))
+				}
+				spinner.Pop()
+
+				opts := stackOptions(t, stack)
+				if paramsFile != "" {
+					parameters, err := dc.ParametersFromFile(paramsFile)
+					if err != nil {
+						panic(err)
+					}
+					for k, v := range parameters {
+						opts.Parameters[k] = v
+					}
+				}
+
+				t, err = eval.Template(t, opts)
+				if err != nil {
+					panic(ui.Errorf(err, "failed to render template for stack '%s'", stackName))
+				}
+			}
+
 			fmt.Print(format.String(t, format.Options{}))
 		}
 	},
@@ -70,4 +115,38 @@ func init() {
 	Cmd.Flags().BoolVarP(&transformed, "transformed", "t", false, "get the template with transformations applied by CloudFormation")
 	Cmd.Flags().BoolVarP(&unformatted, "unformatted", "u", false, "output the template in its raw form; do not attempt to format it")
 	Cmd.Flags().BoolVarP(&config, "config", "c", false, "output the config file for the existing stack")
+	Cmd.Flags().BoolVar(&render, "render", false, "evaluate intrinsic functions using the stack's parameter values")
+	Cmd.Flags().StringVar(&paramsFile, "params-file", "", "YAML or JSON config file with parameter values that override the stack's values for --render")
+}
+
+// stackOptions returns the parameter and pseudo-parameter values of a deployed stack
+func stackOptions(t *cft.Template, stack types.Stack) eval.Options {
+	opts := eval.Options{
+		Parameters:       make(map[string]string),
+		PseudoParameters: make(map[string]string),
+	}
+
+	for _, p := range stack.Parameters {
+		// NoEcho parameters are returned as asterisks
+		if param, err := t.GetParameter(ptr.ToString(p.ParameterKey)); err == nil {
+			if _, noEcho, _ := s11n.GetMapValue(param, "NoEcho"); noEcho != nil && noEcho.Kind == yaml.ScalarNode &&
+				strings.EqualFold(noEcho.Value, "true") {
+				continue
+			}
+		}
+		opts.Parameters[ptr.ToString(p.ParameterKey)] = ptr.ToString(p.ParameterValue)
+	}
+
+	opts.PseudoParameters["AWS::StackName"] = ptr.ToString(stack.StackName)
+	opts.PseudoParameters["AWS::StackId"] = ptr.ToString(stack.StackId)
+	opts.PseudoParameters["AWS::Region"] = aws.Config().Region
+
+	// arn:partition:cloudformation:region:account:stack/name/id
+	arn := strings.Split(ptr.ToString(stack.StackId), ":")
+	if len(arn) > 4 {
+		opts.PseudoParameters["AWS::Partition"] = arn[1]
+		opts.PseudoParameters["AWS::AccountId"] = arn[4]
+	}
+
+	return opts
 }
@@ -18,12 +18,19 @@ func Example_cat_help() {
 	//
 	// The  `--config` flag can be used to get the rain config file for the stack instead of the template.
 	//
+	// The `--render` flag evaluates intrinsic functions in the template using the stack's parameter values,
+	// to show the effective template. Use `--params-file` with a config file in the same format used by
+	// "rain deploy --config" to render it with different parameter values. Use "rain render" to do the same
+	// for a local template and config file.
+	//
 	// Usage:
 	//   cat <stack>
 	//
 	// Flags:
-	//   -c, --config        output the config file for the existing stack
-	//   -h, --help          help for cat
-	//   -t, --transformed   get the template with transformations applied by CloudFormation
-	//   -u, --unformatted   output the template in its raw form; do not attempt to format it
+	//   -c, --config               output the config file for the existing stack
+	//   -h, --help                 help for cat
+	//       --params-file string   YAML or JSON config file with parameter values that override the stack's values for --render
+	//       --render               evaluate intrinsic functions using the stack's parameter values
+	//   -t, --transformed          get the template with transformations applied by CloudFormation
+	//   -u, --unformatted          output the template in its raw form; do not attempt to format it
 }
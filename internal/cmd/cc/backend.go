@@ -0,0 +1,214 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/internal/aws/s3"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// stateBackendURI is set by --state-backend
+var stateBackendURI string
+
+// ErrStateChanged is returned when a conditional write fails
+// because someone else changed the state file or the lock
+var ErrStateChanged = errors.New("the state was changed by another process")
+
+// StateBackend stores state files and the locks that protect them.
+// Each deployment is identified by its name.
+//
+// Versions are opaque strings. Put and Delete only succeed if the state file
+// still has the version that was passed in, and Put with an empty version
+// only succeeds if the state file does not exist yet. Otherwise they return
+// an error that wraps ErrStateChanged.
+type StateBackend interface {
+	// Get returns the state file and its version. The content is nil if
+	// the deployment does not exist.
+	Get(name string) ([]byte, string, error)
+
+	// Put writes the state file and returns its new version
+	Put(name string, content []byte, version string) (string, error)
+
+	// Delete removes the state file
+	Delete(name string, version string) error
+
+	// Lock takes the lock on a deployment. If another process
+	// already holds it, a LockedError is returned.
+	Lock(name string, lock *LockInfo) error
+
+	// Unlock releases a lock that was returned by Lock or ReadLock
+	Unlock(name string, lock *LockInfo) error
+
+	// ReadLock returns the current lock, or nil if the deployment is not locked
+	ReadLock(name string) (*LockInfo, error)
+
+	// Location describes where the state file is stored, for display
+	Location(name string) string
+
+	// List returns the names of all deployments that have a state file
+	List() ([]string, error)
+}
+
+// getBackend returns the backend selected by --state-backend.
+// The default is the rain artifacts bucket, which is created if
+// it does not exist, after asking unless forceCreation is true.
+func getBackend(forceCreation bool) StateBackend {
+	switch {
+	case stateBackendURI == "":
+		return &s3Backend{bucket: s3.RainBucket(forceCreation)}
+	case strings.HasPrefix(stateBackendURI, "file://"):
+		dir := strings.TrimPrefix(stateBackendURI, "file://")
+		if dir == "" {
+			panic(fmt.Errorf("expected a path in --state-backend %s", stateBackendURI))
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			panic(err)
+		}
+		config.Debugf("Using state backend %s", abs)
+		return &fileBackend{dir: abs}
+	default:
+		panic(fmt.Errorf("unsupported --state-backend %s; expected file://path", stateBackendURI))
+	}
+}
+
+// getReadOnlyBackend returns the backend selected by --state-backend,
+// without creating the rain artifacts bucket
+func getReadOnlyBackend() StateBackend {
+	if stateBackendURI != "" {
+		return getBackend(false)
+	}
+	bucket, err := s3.RainBucketName()
+	if err != nil {
+		panic(err)
+	}
+	return &s3Backend{bucket: bucket}
+}
+
+// These are variables so that tests can replace S3 with a local stand-in
+var getObject = s3.GetObjectVersion
+var putObject = s3.PutObjectIf
+var deleteObject = s3.DeleteObjectIf
+var listObjects = s3.ListObjectKeys
+
+// s3Backend stores state in a bucket, using conditional writes
+// for locks and to detect changes to the state file
+type s3Backend struct {
+	bucket string
+}
+
+// Get the object key prefix for deployments in S3
+func getDeploymentsPrefix() string {
+	if s3.BucketKeyPrefix != "" {
+		return fmt.Sprintf("%s/deployments/", s3.BucketKeyPrefix)
+	}
+	return "deployments/"
+}
+
+// Get the object key for the state file in S3
+func getStateFileKey(name string) string {
+	return fmt.Sprintf("%s%v.yaml", getDeploymentsPrefix(), name)
+}
+
+// Get the object key for the lock file in S3
+func getLockFileKey(name string) string {
+	return fmt.Sprintf("%s%v.lock", getDeploymentsPrefix(), name)
+}
+
+// stateChanged converts a failed S3 condition to ErrStateChanged
+func stateChanged(err error) error {
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		return fmt.Errorf("%w: %v", ErrStateChanged, err)
+	}
+	return err
+}
+
+func (b *s3Backend) Get(name string) ([]byte, string, error) {
+	content, etag, err := getObject(b.bucket, getStateFileKey(name))
+	if err != nil {
+		if s3.IsNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	return content, etag, nil
+}
+
+func (b *s3Backend) Put(name string, content []byte, version string) (string, error) {
+	condition := s3.Condition{IfMatch: version}
+	if version == "" {
+		condition.IfNoneMatch = "*"
+	}
+	etag, err := putObject(b.bucket, getStateFileKey(name), content, condition)
+	return etag, stateChanged(err)
+}
+
+func (b *s3Backend) Delete(name string, version string) error {
+	return stateChanged(deleteObject(b.bucket, getStateFileKey(name), version))
+}
+
+func (b *s3Backend) Lock(name string, lock *LockInfo) error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	etag, err := putObject(b.bucket, getLockFileKey(name), content,
+		s3.Condition{IfNoneMatch: "*"})
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		existing, readErr := b.ReadLock(name)
+		if readErr != nil {
+			return readErr
+		}
+		if existing == nil {
+			// The lock was released in the meantime
+			return b.Lock(name, lock)
+		}
+		return &LockedError{Lock: existing}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write lock to bucket: %v", err)
+	}
+
+	lock.version = etag
+	return nil
+}
+
+func (b *s3Backend) Unlock(name string, lock *LockInfo) error {
+	return stateChanged(deleteObject(b.bucket, getLockFileKey(name), lock.version))
+}
+
+func (b *s3Backend) ReadLock(name string) (*LockInfo, error) {
+	content, etag, err := getObject(b.bucket, getLockFileKey(name))
+	if err != nil {
+		if s3.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseLock(content, etag)
+}
+
+func (b *s3Backend) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", b.bucket, getStateFileKey(name))
+}
+
+func (b *s3Backend) List() ([]string, error) {
+	prefix := getDeploymentsPrefix()
+	keys, err := listObjects(b.bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deployments: %v", err)
+	}
+	names := make([]string, 0)
+	for _, key := range keys {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(key, prefix), ".yaml")
+		if ok && name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
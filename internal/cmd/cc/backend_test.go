@@ -0,0 +1,193 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/internal/aws/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// memoryS3 is a local stand-in for S3 that implements conditional writes
+type memoryS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	version int
+}
+
+func newMemoryS3(t *testing.T) *memoryS3 {
+	m := &memoryS3{
+		objects: make(map[string][]byte),
+		etags:   make(map[string]string),
+	}
+
+	origGet, origPut, origDelete, origList := getObject, putObject, deleteObject, listObjects
+	getObject, putObject, deleteObject, listObjects = m.get, m.put, m.delete, m.list
+	t.Cleanup(func() {
+		getObject, putObject, deleteObject, listObjects = origGet, origPut, origDelete, origList
+	})
+
+	return m
+}
+
+func (m *memoryS3) get(bucketName string, key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.objects[bucketName+"/"+key]
+	if !ok {
+		return nil, "", &types.NoSuchKey{}
+	}
+	return content, m.etags[bucketName+"/"+key], nil
+}
+
+func (m *memoryS3) put(bucketName string, key string, body []byte, condition s3.Condition) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := bucketName + "/" + key
+	_, exists := m.objects[k]
+	if condition.IfNoneMatch == "*" && exists {
+		return "", s3.ErrPreconditionFailed
+	}
+	if condition.IfMatch != "" && (!exists || m.etags[k] != condition.IfMatch) {
+		return "", s3.ErrPreconditionFailed
+	}
+
+	m.version++
+	m.objects[k] = body
+	m.etags[k] = fmt.Sprintf("\"%d\"", m.version)
+	return m.etags[k], nil
+}
+
+func (m *memoryS3) delete(bucketName string, key string, etag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := bucketName + "/" + key
+	if etag != "" && m.etags[k] != etag {
+		return s3.ErrPreconditionFailed
+	}
+	delete(m.objects, k)
+	delete(m.etags, k)
+	return nil
+}
+
+func (m *memoryS3) list(bucketName string, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0)
+	for k := range m.objects {
+		if key, ok := strings.CutPrefix(k, bucketName+"/"); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// testBackends returns each kind of state backend, backed by local storage
+func testBackends(t *testing.T) map[string]StateBackend {
+	newMemoryS3(t)
+	return map[string]StateBackend{
+		"s3":   &s3Backend{bucket: "bucket"},
+		"file": &fileBackend{dir: t.TempDir()},
+	}
+}
+
+func TestBackendVersions(t *testing.T) {
+	for kind, backend := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			content, _, err := backend.Get("test")
+			if err != nil || content != nil {
+				t.Fatalf("expected no state, got %s, %v", content, err)
+			}
+
+			v1, err := backend.Put("test", []byte("a"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := backend.Put("test", []byte("b"), ""); !errors.Is(err, ErrStateChanged) {
+				t.Errorf("expected creating an existing state file to fail, got %v", err)
+			}
+
+			// Someone else writes the state file
+			v2, err := backend.Put("test", []byte("c"), v1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Our write is based on a stale version
+			if _, err := backend.Put("test", []byte("d"), v1); !errors.Is(err, ErrStateChanged) {
+				t.Errorf("expected a write with a stale version to fail, got %v", err)
+			}
+			if err := backend.Delete("test", v1); !errors.Is(err, ErrStateChanged) {
+				t.Errorf("expected a delete with a stale version to fail, got %v", err)
+			}
+
+			content, version, err := backend.Get("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "c" || version != v2 {
+				t.Errorf("expected c at %s, got %s at %s", v2, content, version)
+			}
+
+			if err := backend.Delete("test", v2); err != nil {
+				t.Fatal(err)
+			}
+			if content, _, _ := backend.Get("test"); content != nil {
+				t.Errorf("expected the state file to be deleted")
+			}
+		})
+	}
+}
+
+func TestGetBackend(t *testing.T) {
+	stateBackendURI = "file://testdata/state"
+	defer func() { stateBackendURI = "" }()
+
+	backend, ok := getBackend(false).(*fileBackend)
+	if !ok {
+		t.Fatalf("expected a file backend")
+	}
+	if backend.Location("test") != backend.dir+"/test.yaml" {
+		t.Errorf("unexpected location %s", backend.Location("test"))
+	}
+}
+
+func TestBackendList(t *testing.T) {
+	for kind, backend := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			names, err := backend.List()
+			if err != nil || len(names) != 0 {
+				t.Fatalf("expected no deployments, got %v, %v", names, err)
+			}
+
+			for _, name := range []string{"b", "a"} {
+				if _, err := backend.Put(name, []byte(name), ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := backend.Lock("c", newLockInfo("test")); err != nil {
+				t.Fatal(err)
+			}
+
+			// Locks without a state file are not deployments
+			names, err = backend.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, []string{"a", "b"}) {
+				t.Errorf("expected [a b], got %v", names)
+			}
+		})
+	}
+}
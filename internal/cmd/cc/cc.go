@@ -1,6 +1,8 @@
 package cc
 
 import (
+	"time"
+
 	"github.com/aws-cloudformation/rain/cft"
 	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
@@ -16,6 +18,8 @@ var Experimental bool
 var yes bool
 var ignoreUnknownParams bool
 var unlock string
+var parallelism int
+var resourceTimeout time.Duration
 
 // Globals (seems bad..? but cumbersome to pass them around)
 var deployedTemplate *cft.Template
@@ -32,16 +36,29 @@ var Cmd = &cobra.Command{
 func addCommonParams(c *cobra.Command) {
 	c.Flags().StringVarP(&config.Profile, "profile", "p", "", "AWS profile name; read from the AWS CLI configuration file")
 	c.Flags().StringVarP(&config.Region, "region", "r", "", "AWS region to use")
+	c.Flags().StringVar(&config.RecordDir, "record", "", "Record AWS API calls to a directory so they can be replayed later")
+	c.Flags().StringVar(&config.ReplayDir, "replay", "", "Serve AWS API calls from a directory created with --record instead of calling AWS")
 
 	c.Flags().StringVar(&s3.BucketName, "s3-bucket", "", "Name of the S3 bucket that is used to upload assets")
 	c.Flags().StringVar(&s3.BucketKeyPrefix, "s3-prefix", "", "Prefix to add to objects uploaded to S3 bucket")
+	c.Flags().StringVar(&stateBackendURI, "state-backend", "", "Where to store state files, like file://path; defaults to the rain artifacts bucket")
 	c.Flags().BoolVar(&config.Debug, "debug", false, "Output debugging information")
 	c.Flags().BoolVarP(&Experimental, "experimental", "x", false, "Acknowledge that this is an experimental feature")
 }
 
+// addSchedulerParams adds the flags that control how resources are deployed
+func addSchedulerParams(c *cobra.Command) {
+	c.Flags().IntVar(&parallelism, "parallelism", 10, "maximum number of resources to deploy at the same time")
+	c.Flags().DurationVar(&resourceTimeout, "resource-timeout", time.Hour, "give up on a resource that takes longer than this, including retries")
+}
+
 func init() {
 	Cmd.AddCommand(CCDeployCmd)
 	Cmd.AddCommand(CCRmCmd)
 	Cmd.AddCommand(CCStateCmd)
 	Cmd.AddCommand(CCDriftCmd)
+	Cmd.AddCommand(CCPlanCmd)
+	Cmd.AddCommand(CCUnlockCmd)
+	Cmd.AddCommand(CCImportCmd)
+	Cmd.AddCommand(CCOutputsCmd)
 }
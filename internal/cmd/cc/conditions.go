@@ -0,0 +1,162 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/eval"
+	"github.com/aws-cloudformation/rain/cft/visitor"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// conditionContext returns an eval.Context that knows the parameter values
+// in templateConfig and the pseudo-parameters that the Conditions section
+// refers to
+func conditionContext(template *cft.Template, section *yaml.Node) (*eval.Context, error) {
+	opts := eval.Options{
+		Parameters:       make(map[string]string),
+		PseudoParameters: make(map[string]string),
+	}
+
+	if templateConfig != nil {
+		for _, p := range templateConfig.Params {
+			if val, ok := templateConfig.GetParam(*p.ParameterKey); ok {
+				opts.Parameters[*p.ParameterKey] = val
+			}
+		}
+	}
+
+	var err error
+	visitor.NewVisitor(section).Visit(func(v *visitor.Visitor) {
+		n := v.GetYamlNode()
+		if err != nil || n.Kind != yaml.MappingNode || len(n.Content) != 2 || n.Content[0].Value != "Ref" {
+			return
+		}
+		name := n.Content[1].Value
+		if _, ok := opts.PseudoParameters[name]; ok || !strings.HasPrefix(name, AWS_PREFIX) {
+			return
+		}
+		opts.PseudoParameters[name], err = resolvePseudoParam(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eval.NewContext(template, opts), nil
+}
+
+// resolveIfs replaces each Fn::If in n with the value that its condition
+// chooses, and removes values that are a Ref to AWS::NoValue.
+// It returns nil if n itself is AWS::NoValue.
+func resolveIfs(n *yaml.Node, conditions map[string]bool) (*yaml.Node, error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 2 {
+			key, args := n.Content[0].Value, n.Content[1]
+			if key == "Ref" && args.Value == AWS_PREFIX+"NoValue" {
+				return nil, nil
+			}
+			if key == "Fn::If" {
+				if args.Kind != yaml.SequenceNode || len(args.Content) != 3 {
+					return nil, errors.New("expected Fn::If to have three elements")
+				}
+				val, ok := conditions[args.Content[0].Value]
+				if !ok {
+					return nil, fmt.Errorf("condition %s not found", args.Content[0].Value)
+				}
+				if val {
+					return resolveIfs(args.Content[1], conditions)
+				}
+				return resolveIfs(args.Content[2], conditions)
+			}
+		}
+		content := make([]*yaml.Node, 0, len(n.Content))
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			val, err := resolveIfs(n.Content[i+1], conditions)
+			if err != nil {
+				return nil, err
+			}
+			if val != nil {
+				content = append(content, n.Content[i], val)
+			}
+		}
+		n.Content = content
+	case yaml.SequenceNode:
+		content := make([]*yaml.Node, 0, len(n.Content))
+		for _, item := range n.Content {
+			val, err := resolveIfs(item, conditions)
+			if err != nil {
+				return nil, err
+			}
+			if val != nil {
+				content = append(content, val)
+			}
+		}
+		n.Content = content
+	}
+	return n, nil
+}
+
+// applyConditions evaluates the Conditions section of the template and
+// removes resources and outputs whose condition is false, so that they
+// are not deployed and are left out of the dependency graph. It also
+// replaces Fn::If with the value that is chosen, so that references in
+// the value that is not chosen are left out of the graph too.
+func applyConditions(template *cft.Template) error {
+	conditions := make(map[string]bool)
+
+	if section, err := template.GetSection(cft.Conditions); err == nil {
+		ctx, err := conditionContext(template, section)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i+1 < len(section.Content); i += 2 {
+			name := section.Content[i].Value
+			val, known, err := ctx.Condition(name)
+			if err != nil {
+				return err
+			}
+			if !known {
+				return fmt.Errorf("unable to evaluate condition %s", name)
+			}
+			conditions[name] = val
+		}
+
+		config.Debugf("conditions: %v", conditions)
+	}
+
+	for _, section := range []cft.Section{cft.Resources, cft.Outputs} {
+		n, err := template.GetSection(section)
+		if err != nil {
+			continue
+		}
+		content := make([]*yaml.Node, 0, len(n.Content))
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			name := n.Content[i].Value
+			_, cond, _ := s11n.GetMapValue(n.Content[i+1], "Condition")
+			if cond != nil {
+				val, ok := conditions[cond.Value]
+				if !ok {
+					return fmt.Errorf("%s refers to unknown condition %s", name, cond.Value)
+				}
+				if !val {
+					config.Debugf("Skipping %s because condition %s is false", name, cond.Value)
+					continue
+				}
+			}
+			decl, err := resolveIfs(n.Content[i+1], conditions)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			content = append(content, n.Content[i], decl)
+		}
+		n.Content = content
+	}
+
+	return nil
+}
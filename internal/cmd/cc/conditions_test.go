@@ -0,0 +1,179 @@
+package cc
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/graph"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+)
+
+const conditionsSource = `
+Parameters:
+    Env:
+        Type: String
+        Default: dev
+Conditions:
+    IsProd: !Equals [!Ref Env, prod]
+    IsDev: !Not [!Condition IsProd]
+    IsDevOrTest: !Or [!Condition IsDev, !Equals [!Ref Env, test]]
+    Both: !And [!Condition IsProd, !Condition IsDev]
+Resources:
+    Logs:
+        Type: AWS::S3::Bucket
+        Condition: IsProd
+    Bucket:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !If [IsProd, prod-bucket, dev-bucket]
+            LoggingConfiguration: !If
+              - IsProd
+              - DestinationBucketName: !Ref Logs
+              - !Ref AWS::NoValue
+            Tags:
+              - Key: env
+                Value: !Ref Env
+              - !If [IsDev, {Key: dev, Value: "true"}, !Ref AWS::NoValue]
+Outputs:
+    LogsName:
+        Condition: IsProd
+        Value: !Ref Logs
+`
+
+func TestApplyConditions(t *testing.T) {
+	template := setTestTemplate(t, conditionsSource, []string{})
+	if err := applyConditions(template); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := template.GetResource("Logs"); err == nil {
+		t.Error("expected Logs to be removed")
+	}
+	outputs, _ := template.GetSection(cft.Outputs)
+	if len(outputs.Content) != 0 {
+		t.Errorf("expected LogsName to be removed, got %s", node.ToSJson(outputs))
+	}
+
+	// The skipped resource must not be in the dependency graph
+	g := graph.New(template)
+	for _, n := range g.Nodes() {
+		if n.Name == "Logs" {
+			t.Error("expected Logs to be left out of the graph")
+		}
+	}
+
+	// Resolve Fn::If and AWS::NoValue
+	deployedTemplate = template
+	bucketNode, _ := template.GetResource("Bucket")
+	resolved, err := Resolve(NewResource("Bucket", "AWS::S3::Bucket", Waiting, bucketNode))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, props, _ := s11n.GetMapValue(resolved, "Properties")
+	_, name, _ := s11n.GetMapValue(props, "BucketName")
+	if name == nil || name.Value != "dev-bucket" {
+		t.Errorf("expected BucketName to be dev-bucket, got %s", node.ToSJson(name))
+	}
+	if _, logging, _ := s11n.GetMapValue(props, "LoggingConfiguration"); logging != nil {
+		t.Errorf("expected LoggingConfiguration to be removed, got %s", node.ToSJson(logging))
+	}
+	_, tags, _ := s11n.GetMapValue(props, "Tags")
+	if tags == nil || len(tags.Content) != 2 {
+		t.Fatalf("expected two tags, got %s", node.ToSJson(tags))
+	}
+	_, key, _ := s11n.GetMapValue(tags.Content[1], "Key")
+	if key == nil || key.Value != "dev" {
+		t.Errorf("expected the second tag to be dev, got %s", node.ToSJson(tags.Content[1]))
+	}
+}
+
+func TestApplyConditionsProd(t *testing.T) {
+	template := setTestTemplate(t, conditionsSource, []string{"Env=prod"})
+	if err := applyConditions(template); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := template.GetResource("Logs"); err != nil {
+		t.Errorf("expected Logs to be kept: %v", err)
+	}
+
+	// Bucket depends on Logs through the Fn::If
+	deployedTemplate = template
+	logsNode, _ := template.GetResource("Logs")
+	logs := NewResource("Logs", "AWS::S3::Bucket", Waiting, logsNode)
+	logs.Identifier = "logs-bucket"
+
+	bucketNode, _ := template.GetResource("Bucket")
+	resolved, err := Resolve(NewResource("Bucket", "AWS::S3::Bucket", Waiting, bucketNode))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, props, _ := s11n.GetMapValue(resolved, "Properties")
+	_, logging, _ := s11n.GetMapValue(props, "LoggingConfiguration")
+	if logging == nil {
+		t.Fatal("expected LoggingConfiguration")
+	}
+	_, dest, _ := s11n.GetMapValue(logging, "DestinationBucketName")
+	if dest == nil || dest.Value != "logs-bucket" {
+		t.Errorf("expected DestinationBucketName to be logs-bucket, got %s", node.ToSJson(dest))
+	}
+	_, tags, _ := s11n.GetMapValue(props, "Tags")
+	if tags == nil || len(tags.Content) != 1 {
+		t.Errorf("expected one tag, got %s", node.ToSJson(tags))
+	}
+}
+
+func TestConditionBecomesFalse(t *testing.T) {
+	fake := useFakeClient(t, 10)
+
+	// The first deployment creates Logs and refers to it from Bucket
+	template := setTestTemplate(t, conditionsSource, []string{"Env=prod"})
+	if err := applyConditions(template); err != nil {
+		t.Fatal(err)
+	}
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected the first deployment to succeed")
+	}
+	state, err := resultState(nil, template, results, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored template does not refer to the branch that was not chosen
+	bucket, _ := state.GetResource("Bucket")
+	if s := node.ToSJson(bucket); strings.Contains(s, "Fn::If") || strings.Contains(s, "NoValue") {
+		t.Errorf("expected Fn::If to be resolved in the state, got %s", s)
+	}
+
+	// Without the condition, Logs is deleted. Bucket gets a new
+	// BucketName, so it is replaced as well.
+	template = setTestTemplate(t, conditionsSource, []string{"Env=dev"})
+	if err := applyConditions(template); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := update(state, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployedTemplate = changes
+	fake.ops = nil
+	results, err = DeployTemplate(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected the second deployment to succeed")
+	}
+	if deletes := deleteOps(fake); !slices.Contains(deletes, "Delete Logs") {
+		t.Errorf("expected Logs to be deleted, got %v", deletes)
+	}
+}
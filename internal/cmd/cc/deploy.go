@@ -9,7 +9,6 @@ import (
 	"github.com/aws-cloudformation/rain/cft/format"
 	"github.com/aws-cloudformation/rain/cft/pkg"
 	"github.com/aws-cloudformation/rain/internal/aws/cfn"
-	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/cmd/forecast"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console"
@@ -24,6 +23,9 @@ import (
 // before deployment. The rain bucket will be created if it does not already exist.
 func PackageTemplate(fn string, yes bool) *cft.Template {
 
+	// Make sure remote modules have not changed since they were locked
+	pkg.LockFile = pkg.LockPath(fn)
+
 	t, err := pkg.File(fn)
 	if err != nil {
 		panic(ui.Errorf(err, "error packaging template '%s'", fn))
@@ -32,18 +34,53 @@ func PackageTemplate(fn string, yes bool) *cft.Template {
 	return t
 }
 
+// abandonState unlocks the deployment when nothing was deployed, removing
+// the state file if checkState created it
+func abandonState(backend StateBackend, name string, stateResult *StateResult) error {
+	if !stateResult.IsUpdate {
+		if err := deleteState(name, backend, stateResult); err != nil {
+			return fmt.Errorf("unable to remove state file: %v", err)
+		}
+		return nil
+	}
+	if err := releaseLock(backend, name, stateResult.Lock); err != nil {
+		return fmt.Errorf("unable to unlock state file: %v", err)
+	}
+	return nil
+}
+
 func deploy(cmd *cobra.Command, args []string) {
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	// A plan file replaces the template, name, parameters, and tags
+	var plan *Plan
+	if planFile != "" {
+		if len(args) > 0 {
+			panic("Do not pass <template> and <name> with --plan")
+		}
+		var err error
+		plan, err = readPlan(planFile)
+		if err != nil {
+			panic(err)
+		}
+		args = []string{plan.TemplatePath, plan.Name}
+		params = plan.Params
+		tags = plan.Tags
+		configFilePath = plan.ConfigFile
+	} else if len(args) != 2 {
+		panic("Expected <template> and <name>")
+	}
+
 	fn := args[0]
 	name := args[1]
 	base := filepath.Base(fn)
 	absPath, _ := filepath.Abs(fn)
 
-	if !Experimental {
-		panic("Please add the --experimental arg to use this feature")
-	}
-
-	// Call RainBucket for side-effects in case we want to force bucket creation
-	bucketName := s3.RainBucket(yes)
+	// For the default backend, this calls RainBucket for side-effects
+	// in case we want to force bucket creation
+	backend := getBackend(yes)
 
 	// Package template
 	spinner.Push(fmt.Sprintf("Preparing template '%s'", base))
@@ -60,6 +97,16 @@ func deploy(cmd *cobra.Command, args []string) {
 	}
 	templateConfig = dc
 
+	// Leave out resources whose condition is false
+	if err := applyConditions(template); err != nil {
+		panic(err)
+	}
+
+	// Make sure DeletionPolicy and UpdateReplacePolicy are supported
+	if err := checkPolicies(template); err != nil {
+		panic(err)
+	}
+
 	// Before we do anything else, make sure that all types in the template
 	// are fully supported by Cloud Control API
 	types, err := template.GetTypes()
@@ -82,12 +129,68 @@ func deploy(cmd *cobra.Command, args []string) {
 		panic("Unable to deploy this template due to unsupported resources")
 	}
 
+	// Make sure the template did not change since the plan was made
+	if plan != nil {
+		if err := checkPlan(plan, template); err != nil {
+			panic(err)
+		}
+	}
+
+	// Find the exports that this template declares and the ones it imports
+	// from other deployments. Their names can only refer to parameters.
+	deployedTemplate = template
+	exportNames, err := templateExports(template)
+	if err != nil {
+		panic(err)
+	}
+	imports, err := templateImports(template)
+	if err != nil {
+		panic(err)
+	}
+	deploymentExports = nil
+	if len(exportNames) > 0 || len(imports) > 0 {
+		spinner.Push("Checking exports")
+		deploymentExports, err = loadExports(backend, name)
+		spinner.Pop()
+		if err != nil {
+			panic(err)
+		}
+		if err := checkExports(deploymentExports, exportNames, imports); err != nil {
+			panic(err)
+		}
+	}
+
 	// Compare against the current state to see what has changed, if this is an update
-	stateResult, stateError := checkState(name, template, bucketName, "", absPath, unlock)
+	stateResult, stateError := checkState(name, template, backend, absPath, unlock, cmd.CommandPath())
 	if stateError != nil {
 		panic(stateError)
 	}
 
+	// Now that the deployment is locked, make sure that
+	// the state file did not change since the plan was made
+	if plan != nil && stateResult.StateHash != plan.StateHash {
+		if err := abandonState(backend, name, stateResult); err != nil {
+			panic(err)
+		}
+		panic(errors.New("the state file has changed since the plan was made; run cc plan again"))
+	}
+
+	// Other deployments might import exports that this update would remove
+	if stateResult.IsUpdate {
+		if removed := removedExports(stateResult.StateFile, exportNames); len(removed) > 0 {
+			if deploymentExports == nil {
+				deploymentExports, err = loadExports(backend, name)
+			}
+			if err == nil {
+				err = checkExportsInUse(deploymentExports, removed)
+			}
+			if err != nil {
+				releaseLock(backend, name, stateResult.Lock)
+				panic(err)
+			}
+		}
+	}
+
 	config.Debugf("StateFile:\n%v", format.String(stateResult.StateFile,
 		format.Options{JSON: false, Unsorted: false}))
 
@@ -108,18 +211,10 @@ func deploy(cmd *cobra.Command, args []string) {
 
 	summarizeChanges(changes)
 
-	if !console.Confirm(true, "Do you wish to continue?") {
-		// Unlock the state file
-		if !stateResult.IsUpdate {
-			err := deleteState(name, bucketName)
-			if err != nil {
-				panic(fmt.Errorf("unable to remove state file: %v", err))
-			}
-		} else {
-			err := writeState(template, nil, bucketName, name, absPath)
-			if err != nil {
-				panic(fmt.Errorf("unable to unlock state file: %v", err))
-			}
+	// The plan was already reviewed
+	if plan == nil && !console.Confirm(true, "Do you wish to continue?") {
+		if err := abandonState(backend, name, stateResult); err != nil {
+			panic(err)
 		}
 
 		// Exit
@@ -145,28 +240,73 @@ func deploy(cmd *cobra.Command, args []string) {
 	results.Summarize()
 
 	if !results.Succeeded {
-		panic("Deployment failed! The state file is locked and will need to be resolved manually.")
+		var rolledBack *DeploymentResults
+		if !noRollback {
+			fmt.Println("Deployment failed, rolling back")
+			spinner.StartTimer(fmt.Sprintf("Rolling back %v", name))
+			rolledBack, err = rollback(changes, results)
+			spinner.StopTimer()
+			if err != nil {
+				console.Errorf("unable to roll back: %v", err)
+			}
+			rolledBack.Summarize()
+		}
+
+		// Record what actually exists and unlock the state file
+		err := writeResultState(stateResult.StateFile, template, results, rolledBack,
+			backend, name, absPath, stateResult)
+		if err != nil {
+			panic(fmt.Errorf("unable to write state file (lock: %s): %v", stateResult.Lock.Id, err))
+		}
 
-		// Leave the state file locked. Needs to be resolved manually.
+		for _, orphan := range orphanedReplacements(results, rolledBack) {
+			console.Errorf("Replaced resource %s was not deleted and is no longer managed by cc", orphan)
+		}
+		for _, orphan := range orphanedCreates(results) {
+			console.Errorf("Resource %s might have been created by a failed deployment and is not managed by cc", orphan)
+		}
+
+		switch {
+		case rolledBack == nil:
+			panic("Deployment failed! Resources that were created or updated have been kept, and are recorded in the state file.")
+		case !rolledBack.Succeeded:
+			panic("Deployment failed, and the rollback did not complete. The state file records the resources that still exist.")
+		default:
+			panic("Deployment failed and was rolled back.")
+		}
 	} else {
 		fmt.Println("Deployment completed successfully!")
 
+		// Resolve outputs now that everything has been deployed. The state
+		// file is written even if this fails, since the resources exist.
+		outputs, outputErr := resolveOutputs(changes)
+		if outputErr != nil {
+			outputs = nil
+		}
+
 		// Unlock the state file and record current values
-		err := writeState(template, results, bucketName, name, absPath)
+		err := writeState(template, results, outputs, imports, backend, name, absPath, stateResult)
 		if err != nil {
 			panic(fmt.Errorf("unable to write state file: %v", err))
 		}
+		if outputErr != nil {
+			panic(fmt.Errorf("unable to resolve outputs: %v", outputErr))
+		}
 	}
 
 }
 
 var CCDeployCmd = &cobra.Command{
-	Use:   "deploy <template> <name>",
+	Use:   "deploy <template> <name> | --plan <file>",
 	Short: "Deploy a local template directly using the Cloud Control API (Experimental!)",
 	Long: `Creates or updates resources directly using Cloud Control API from the template file <template>.
+
+Use --plan to deploy a plan file written by cc plan instead of passing <template> and <name>.
+The plan is only deployed if the template and the state file have not changed since it was made.
+
 You must pass the --experimental (-x) flag to use this command, to acknowledge that it is experimental and likely to be unstable!
 `,
-	Args:                  cobra.ExactArgs(2),
+	Args:                  cobra.MaximumNArgs(2),
 	DisableFlagsInUseLine: true,
 	Run:                   deploy,
 }
@@ -178,8 +318,12 @@ func init() {
 	CCDeployCmd.Flags().StringSliceVar(&params, "params", []string{}, "set parameter values; use the format key1=value1,key2=value2")
 	CCDeployCmd.Flags().StringVarP(&configFilePath, "config", "c", "", "YAML or JSON file to set tags and parameters")
 	CCDeployCmd.Flags().StringVarP(&unlock, "unlock", "u", "", "Unlock <lockid> and continue")
+	CCDeployCmd.Flags().StringVar(&planFile, "plan", "", "deploy a plan file written by cc plan")
 	CCDeployCmd.Flags().BoolVarP(&ignoreUnknownParams, "ignore-unknown-params", "", false, "Ignore unknown parameters")
+	CCDeployCmd.Flags().BoolVar(&pkg.UpdateLock, "update-lock", false, "Accept changes to remote modules and packages and update "+pkg.LockFileName)
+	CCDeployCmd.Flags().BoolVar(&noRollback, "no-rollback", false, "keep created and updated resources after a failure instead of rolling back")
 
+	addSchedulerParams(CCDeployCmd)
 	addCommonParams(CCDeployCmd)
 
 	resMap = make(map[string]*Resource)
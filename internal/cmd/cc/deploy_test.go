@@ -21,11 +21,11 @@ func TestReady(t *testing.T) {
 	ar := NewResource(a.Name, "AWS::S3::Bucket", Waiting, nil)
 	br := NewResource(b.Name, "AWS::S3::Bucket", Waiting, nil)
 
-	if ready(ar, &g) {
+	if ready(ar, &g, resMap) {
 		t.Errorf("ar should not be ready")
 	}
 
-	if !ready(br, &g) {
+	if !ready(br, &g, resMap) {
 		t.Errorf("br should be ready")
 	}
 
@@ -35,11 +35,11 @@ func TestReady(t *testing.T) {
 	cr := NewResource(c.Name, "AWS::S3::Bucket", Waiting, nil)
 	g.Link(b, c)
 
-	if !ready(cr, &g) {
+	if !ready(cr, &g, resMap) {
 		t.Errorf("cr should be ready")
 	}
 
-	if ready(ar, &g) {
+	if ready(ar, &g, resMap) {
 		t.Errorf("ar should not be ready after adding c")
 	}
 
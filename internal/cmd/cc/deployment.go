@@ -1,10 +1,9 @@
 package cc
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"time"
 
 	"github.com/aws-cloudformation/rain/cft"
 	"github.com/aws-cloudformation/rain/cft/diff"
@@ -13,7 +12,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/ccapi"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/node"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	"github.com/aws-cloudformation/rain/internal/table"
@@ -24,6 +22,7 @@ import (
 var createFormat table.Formatter
 var updateFormat table.Formatter
 var deleteFormat table.Formatter
+var replaceFormat table.Formatter
 var failFormat table.Formatter
 var successFormat table.Formatter
 
@@ -46,14 +45,12 @@ func getTemplateResource(template *cft.Template, logicalId string) (*yaml.Node,
 	return nil, fmt.Errorf("could not find Resource %v", logicalId)
 }
 
-// deployResource calls the Cloud Control API to deploy the resource
-func deployResource(resource *Resource) {
+// deployResource calls the Cloud Control API to deploy the resource.
+// It records the identifier and model on the resource, and returns an
+// error if the deployment failed. The scheduler sets the resource State.
+func deployResource(ctx context.Context, resource *Resource) error {
 	config.Debugf("Deploying %v...", resource)
 
-	resource.State = Deploying
-	resource.Start = time.Now()
-	defer func() { resource.End = time.Now() }()
-
 	// Resolve instrinsics before creating the resource.
 	// This depends on the post-deployment state of dependencies
 	var resolvedNode *yaml.Node
@@ -65,75 +62,73 @@ func deployResource(resource *Resource) {
 		resolvedNode, err = Resolve(resource)
 		if err != nil {
 			config.Debugf("deployResource resolve failed: %v", err)
-			resource.State = Failed
-			resource.Message = fmt.Sprintf("%v", err)
-			return
+			return err
 		}
 	}
 
 	switch resource.Action {
-	case diff.Create:
+	case diff.Create, Replace:
 
-		// Get the properties and call ccapi
+		// Get the properties and call ccapi. A replacement is created
+		// alongside the resource it replaces, which is deleted later.
 		var identifier string
 		var model string
-		identifier, model, err = ccapi.CreateResource(resource.Name, resolvedNode)
+		identifier, model, err = client.Create(ctx, resource.Name, resolvedNode)
+		if identifier != "" {
+			// Keep the identifier so a resource that failed or
+			// timed out can be found
+			resource.Identifier = identifier
+		}
 		if err != nil {
 			config.Debugf("deployResource create failed: %v", err)
-			resource.State = Failed
-			resource.Message = fmt.Sprintf("%v", err)
-		} else {
-			resource.State = Deployed
-			resource.Message = "Success"
-			resource.Identifier = identifier
-			resource.Model = model
+			return err
 		}
+		resource.Model = model
 	case diff.Update:
 
 		priorJson := resource.PriorJson
 
+		resource.AppliedJson = ccapi.ToJsonProps(resolvedNode)
+
 		var model string
-		model, err = ccapi.UpdateResource(resource.Name,
+		model, err = client.Update(ctx, resource.Name,
 			resource.Identifier, resolvedNode, priorJson)
 		if err != nil {
 			config.Debugf("deployResource update failed: %v", err)
-			resource.State = Failed
-			resource.Message = fmt.Sprintf("%v", err)
-		} else {
-			config.Debugf("deployResource update succeeded: %v", model)
-			resource.State = Deployed
-			resource.Message = "Success"
-			resource.Model = model
+			return err
 		}
+		config.Debugf("deployResource update succeeded: %v", model)
+		resource.Model = model
 
 	case diff.Delete:
 
-		err = ccapi.DeleteResource(resource.Name, resource.Identifier, resolvedNode)
+		if resource.Retain {
+			config.Debugf("deployResource retaining %v %v", resource.Name, resource.Identifier)
+			return nil
+		}
+
+		err = client.Delete(ctx, resource.Name, resource.Identifier, resolvedNode)
 		if err != nil {
 			config.Debugf("deployResource delete failed: %v", err)
-			resource.State = Failed
-			resource.Message = fmt.Sprintf("%v", err)
-		} else {
-			resource.State = Deployed
-			resource.Message = "Success"
+			return err
 		}
 
 	default:
 		// None means this is an update with no change to the model
 		config.Debugf("deployResource not deploying unchanged %v. Identifier: %v, Model: %v",
 			resource.Name, resource.Identifier, resource.Model)
-		resource.State = Deployed
-		resource.Message = "Success"
 
 		// TODO: Are we missing the Model here?
 	}
 
+	return nil
 }
 
 // ready returns true if the resource has no undeployed dependencies,
-// TODO: unless the Action is Delete, in which case it returns true if it has
-// no undeleted dependents
-func ready(resource *Resource, g *graph.Graph) bool {
+// unless the Action is Delete, in which case it returns true if it has
+// no undeleted dependents. Only the resources in batch, which are being
+// deployed together, are considered.
+func ready(resource *Resource, g *graph.Graph, batch map[string]*Resource) bool {
 
 	node := graph.Node{Name: resource.Name, Type: "Resources"}
 	var deps []graph.Node
@@ -150,7 +145,10 @@ func ready(resource *Resource, g *graph.Graph) bool {
 			continue
 		}
 
-		depr := resMap[dep.Name]
+		depr, ok := batch[dep.Name]
+		if !ok {
+			continue
+		}
 
 		// If the dependency is not deployed, terminate
 		if depr.State != Deployed {
@@ -158,7 +156,7 @@ func ready(resource *Resource, g *graph.Graph) bool {
 		}
 
 		// Recurse on each dependency
-		if !ready(depr, g) {
+		if !ready(depr, g, batch) {
 			return false
 		}
 	}
@@ -172,6 +170,10 @@ type DeploymentResults struct {
 	Succeeded bool
 	State     *cft.Template
 	Resources map[string]*Resource
+
+	// Replaced has the resources that were deleted or retained
+	// after they were replaced, keyed by logical id
+	Replaced map[string]*Resource
 }
 
 // Summarize prints out a summary of deployment results
@@ -200,11 +202,19 @@ func (results *DeploymentResults) Summarize() {
 			if resource.State == Failed {
 				action = "Update"
 			}
+		case Replace:
+			action = "Replaced"
+			if resource.State == Failed {
+				action = "Replace"
+			}
 		case diff.Delete:
 			action = "Deleted"
 			if resource.State == Failed {
 				action = "Delete"
 			}
+			if resource.Retain {
+				action = "Retained"
+			}
 		default:
 			action = "None"
 			formatter = nil
@@ -239,6 +249,20 @@ func (results *DeploymentResults) Summarize() {
 
 		tbl.AddRowf(formatter, action, message, t, logicalId, ident)
 	}
+	for _, resource := range results.Replaced {
+		action := "Deleted (replaced)"
+		if resource.Retain {
+			action = "Retained (replaced)"
+		}
+		formatter, message := successFormat, "Success"
+		if resource.State != Deployed {
+			formatter, message = failFormat, "Failed"
+			failureMessages = append(failureMessages, fmt.Sprintf(
+				"%s: unable to delete the replaced resource %s: %s",
+				resource.Name, resource.Identifier, resource.Message))
+		}
+		tbl.AddRowf(formatter, action, message, resource.Type, resource.Name, resource.Identifier)
+	}
 	tbl.Print()
 	fmt.Println()
 	if len(failureMessages) > 0 {
@@ -300,79 +324,6 @@ func verifyDeletes(resources []*Resource, g *graph.Graph, resourceMap map[string
 	return nil
 }
 
-// deployResources deploys a set of resources - either all the deletes, or
-// all of the creates and updates. Deletes are handled in reverse dependency order.
-func deployResources(resources []*Resource, results *DeploymentResults, g *graph.Graph) error {
-
-	numResources := len(resources)
-	numDone := 0
-	failed := false
-
-	config.Debugf("About to deploy %v resources", numResources)
-
-	// TODO - Instead of re-evaluating readiness for each resource in a loop,
-	// it might be better to create a deployment plan, with a pre-determined
-	// order of operations, and then simply iterate over that plan.
-
-	for numDone < numResources {
-
-		// config.Debugf("Starting an iteration over resources (%v/%v done)",
-		// 	numDone, numResources)
-
-		numDone = 0
-
-		for _, r := range resources {
-
-			if r.State == Deployed || r.State == Canceled {
-				numDone += 1
-				continue
-			}
-
-			if r.State == Deploying {
-				continue
-			}
-
-			if r.State == Failed {
-				// This will prevent any additional resources from deploying,
-				// but any that had already started creation will complete
-				failed = true
-				numDone += 1
-				continue
-			}
-
-			if !failed {
-				// Recurse dependencies to see if it's ok to deploy this one now
-				if ready(r, g) {
-					// Start a goroutine to do the actual deployment
-					go deployResource(r)
-				}
-			} else {
-				if r.State == Waiting {
-					r.State = Canceled
-				}
-			}
-		}
-
-		// for _, r := range resources {
-		// 	config.Debugf("%v", r)
-		// }
-
-		// Give deployment routines time to finish
-		// TODO: We could be smarter about this with channels...
-		time.Sleep(time.Second * 1)
-	}
-
-	for _, r := range resources {
-		results.Resources[r.Name] = r
-	}
-
-	if failed {
-		results.Succeeded = false
-	}
-
-	return nil
-}
-
 // deployTemplate deploys the CloudFormation template using the Cloud Control API.
 // A failed deployment will result in DeploymentResults.Succeeded = false.
 // A non-nil error is returned when something unexpected caused a failure
@@ -383,6 +334,7 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 		Succeeded: true,
 		State:     &cft.Template{},
 		Resources: make(map[string]*Resource),
+		Replaced:  make(map[string]*Resource),
 	}
 
 	var err error
@@ -435,6 +387,7 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 			var ident string
 			var model string
 			var priorJson string
+			var replacedType string
 			_, stateNode, _ := s11n.GetMapValue(y, "State")
 			if stateNode == nil {
 				// Assume this is a new deployment
@@ -448,7 +401,7 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 							action = diff.ActionType(a)
 							isValid := false
 							switch action {
-							case diff.Create, diff.Update, diff.Delete, diff.None:
+							case diff.Create, diff.Update, diff.Delete, diff.None, Replace:
 								isValid = true
 							}
 							if !isValid {
@@ -462,6 +415,8 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 							model = string(m)
 						} else if s.Value == "PriorJson" {
 							priorJson = stateNode.Content[i+1].Value
+						} else if s.Value == "ReplacedType" {
+							replacedType = stateNode.Content[i+1].Value
 						} else {
 							config.Debugf("Unexpected State key %v", s.Value)
 						}
@@ -477,6 +432,25 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 
 			config.Debugf("deployment set r.Model to %v", r.Model)
 
+			switch r.Action {
+			case diff.Delete:
+				// Removed resources are dropped from the state instead
+				// of being deleted if their DeletionPolicy is Retain
+				r.Retain, err = retainOnDelete(y, false)
+			case Replace:
+				// The new resource gets a new identifier, so keep the old one
+				r.ReplacedIdentifier = ident
+				r.ReplacedType = replacedType
+				if r.ReplacedType == "" {
+					r.ReplacedType = typeName
+				}
+				r.Identifier = ""
+				r.Retain, err = retainOnReplace(y)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("resource %s: %v", n.Name, err)
+			}
+
 			if r.Action == diff.Delete {
 				deletes = append(deletes, r)
 			} else {
@@ -500,11 +474,13 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 		return nil, err
 	}
 	if !results.Succeeded {
-		spinner.StopTimer()
-		for _, resource := range results.Resources {
-			fmt.Printf("%v\n", resource)
+		// Don't create or update anything, so that the results
+		// show what still exists
+		for _, r := range createsUpdates {
+			r.State = Canceled
+			results.Resources[r.Name] = r
 		}
-		return nil, errors.New("unable to delete resources")
+		return results, nil
 	}
 
 	// Deploy the rest of the resources
@@ -513,6 +489,16 @@ func DeployTemplate(template *cft.Template) (*DeploymentResults, error) {
 		return nil, err
 	}
 
+	// Delete the resources that were replaced, now that nothing refers to them.
+	// Like in CloudFormation, this only happens if everything else succeeded,
+	// and a failure here does not fail the deployment.
+	if results.Succeeded {
+		err = cleanupReplaced(createsUpdates, results, &g)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return results, nil
 
 }
@@ -521,6 +507,46 @@ func init() {
 	createFormat = color.New(color.FgCyan).SprintfFunc()
 	updateFormat = color.New(color.FgYellow).SprintfFunc()
 	deleteFormat = color.New(color.FgMagenta).SprintfFunc()
+	replaceFormat = color.New(color.FgRed).SprintfFunc()
 	failFormat = color.New(color.FgRed).Add(color.Bold).SprintfFunc()
 	successFormat = color.New(color.FgGreen).SprintfFunc()
 }
+
+// cleanupReplaced deletes the old resources that were replaced, in reverse
+// dependency order, unless their UpdateReplacePolicy is Retain
+func cleanupReplaced(resources []*Resource, results *DeploymentResults, g *graph.Graph) error {
+	olds := make([]*Resource, 0)
+	names := make(map[string]bool)
+	for _, r := range resources {
+		if r.Action != Replace || r.State != Deployed {
+			continue
+		}
+		// Not NewResource, since the global map has to keep the new resource
+		old := &Resource{
+			Name:       r.Name,
+			Type:       r.ReplacedType,
+			State:      Waiting,
+			Action:     diff.Delete,
+			Identifier: r.ReplacedIdentifier,
+			Retain:     r.Retain,
+			Node: &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "Type"},
+				{Kind: yaml.ScalarNode, Value: r.ReplacedType},
+			}},
+		}
+		olds = append(olds, old)
+		names[r.Name] = true
+	}
+	if len(olds) == 0 {
+		return nil
+	}
+
+	config.Debugf("Cleaning up %d replaced resources", len(olds))
+
+	cleanup := &DeploymentResults{
+		Succeeded: true,
+		Resources: results.Replaced,
+	}
+	sub := subgraph(g, names)
+	return deployResources(olds, cleanup, &sub)
+}
@@ -1,6 +1,7 @@
 package cc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"slices"
@@ -13,7 +14,6 @@ import (
 	"github.com/aws-cloudformation/rain/cft/parse"
 	"github.com/aws-cloudformation/rain/internal/aws/ccapi"
 	"github.com/aws-cloudformation/rain/internal/aws/cfn"
-	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console"
 	"github.com/aws-cloudformation/rain/internal/console/spinner"
@@ -34,14 +34,26 @@ func runDrift(cmd *cobra.Command, args []string) {
 
 	spinner.Push("Downloading state file")
 
-	bucketName := s3.RainBucket(false)
+	backend := getBackend(false)
 
-	key := getStateFileKey(name)
+	// Lock the deployment, since the state file might be updated
+	lock := newLockInfo(cmd.CommandPath())
+	if err := acquireLock(backend, name, lock); err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := releaseLock(backend, name, lock); err != nil {
+			console.Errorf("unable to release lock: %v", err)
+		}
+	}()
 
-	obj, err := s3.GetObject(bucketName, key)
+	obj, etag, err := backend.Get(name)
 	if err != nil {
 		panic(fmt.Errorf("unable to download state: %v", err))
 	}
+	if obj == nil {
+		panic(fmt.Errorf("deployment %s does not exist", name))
+	}
 
 	config.Debugf("State file: %s", obj)
 
@@ -52,21 +64,24 @@ func runDrift(cmd *cobra.Command, args []string) {
 
 	spinner.Pop()
 
-	if err := runDriftOnState(name, template, bucketName, key); err != nil {
+	if _, err := runDriftOnState(name, template, backend, etag); err != nil {
 		panic(err)
 	}
 }
 
-func runDriftOnState(name string, template *cft.Template, bucketName string, key string) error {
+// runDriftOnState compares the state file with the live state of each
+// resource. If the state file is updated, it is only written if it still
+// has the version etag, and the new version is returned.
+func runDriftOnState(name string, template *cft.Template, backend StateBackend, etag string) (string, error) {
 
 	resources, err := template.GetSection(cft.Resources)
 	if err != nil {
-		return err
+		return etag, err
 	}
 
 	_, err = template.GetSection(cft.State)
 	if err != nil {
-		return err
+		return etag, err
 	}
 
 	// Display deployment meta-data
@@ -78,7 +93,7 @@ func runDriftOnState(name string, template *cft.Template, bucketName string, key
 	fmt.Print(console.Cyan(fmt.Sprintf("%s\n", name)))
 
 	fmt.Print(console.Blue("State file:       "))
-	fmt.Print(console.Cyan(fmt.Sprintf("s3://%s/%s\n", bucketName, key)))
+	fmt.Print(console.Cyan(fmt.Sprintf("%s\n", backend.Location(name))))
 
 	localPath, err := template.GetNode(cft.State, "FilePath")
 	if err != nil {
@@ -131,7 +146,7 @@ func runDriftOnState(name string, template *cft.Template, bucketName string, key
 	// Summarize all changes that will be made and ask the user to confirm
 	if !hasChanges {
 		fmt.Println("No changes were made to your infrastructure or to the state file.")
-		return nil
+		return etag, nil
 	}
 
 	fmt.Println("The following changes will be made:")
@@ -149,7 +164,7 @@ func runDriftOnState(name string, template *cft.Template, bucketName string, key
 	// Confirm and then actually make the changes
 	if !console.Confirm(true, "Do you wish to continue?") {
 		fmt.Println("Deployment cancelled. No changes have been made to the state file or to live state")
-		return nil
+		return etag, nil
 	}
 
 	// Set the global template reference for resolving intrinsics
@@ -198,7 +213,7 @@ func runDriftOnState(name string, template *cft.Template, bucketName string, key
 
 			priorJson, _ := json.Marshal(newPriorMap)
 
-			model, err := ccapi.UpdateResource(selection.ResourceName,
+			model, err := ccapi.UpdateResource(context.Background(), selection.ResourceName,
 				selection.ResourceIdentifier, resolvedNode, string(priorJson))
 			if err != nil {
 				msg := "unable to update live state for %s: %v"
@@ -229,14 +244,14 @@ func runDriftOnState(name string, template *cft.Template, bucketName string, key
 	if hasStateFileChanges {
 		lastWrite.Value = time.Now().Format(time.RFC3339)
 		str := format.String(template, format.Options{JSON: false, Unsorted: false})
-		err = s3.PutObject(bucketName, key, []byte(str))
+		newETag, err := backend.Put(name, []byte(str), etag)
 		if err != nil {
-			console.Errorf("unable to write updated state file to bucket: %v", err)
-		} else {
-			fmt.Println("State file updated successfully")
+			return etag, fmt.Errorf("unable to write updated state file: %w", err)
 		}
+		fmt.Println("State file updated successfully")
+		etag = newETag
 	}
-	return nil
+	return etag, nil
 }
 
 type action int
@@ -0,0 +1,235 @@
+package cc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// exportedValue is the value of an export and the deployment that exports it
+type exportedValue struct {
+	Deployment string
+	Value      string
+}
+
+// exportIndex holds the exports and imports of all deployments that
+// share a state backend, so that Fn::ImportValue can be resolved
+type exportIndex struct {
+	// Values maps export names to their values
+	Values map[string]exportedValue
+
+	// Importers maps export names to the deployments that import them
+	Importers map[string][]string
+}
+
+// deploymentExports is used to resolve Fn::ImportValue. It is
+// loaded before a deployment if the template needs it.
+var deploymentExports *exportIndex
+
+// loadExports reads the state file of every deployment in the backend,
+// except the one named exclude, and indexes their exports and imports
+func loadExports(backend StateBackend, exclude string) (*exportIndex, error) {
+	index := &exportIndex{
+		Values:    make(map[string]exportedValue),
+		Importers: make(map[string][]string),
+	}
+
+	names, err := backend.List()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if name == exclude {
+			continue
+		}
+		state, _, err := readState(name, backend)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read state for %s: %v", name, err)
+		}
+		if state == nil {
+			// It was removed after we listed it
+			continue
+		}
+		for _, output := range readOutputs(state) {
+			if output.Export == "" {
+				continue
+			}
+			if prior, ok := index.Values[output.Export]; ok {
+				return nil, fmt.Errorf("export %s is exported by both %s and %s",
+					output.Export, prior.Deployment, name)
+			}
+			index.Values[output.Export] = exportedValue{Deployment: name, Value: output.Value}
+		}
+		for _, imp := range readImports(state) {
+			index.Importers[imp] = append(index.Importers[imp], name)
+		}
+	}
+
+	config.Debugf("Loaded %d exports", len(index.Values))
+
+	return index, nil
+}
+
+// templateExports returns the export names declared in the Outputs of a template.
+// Export names can only refer to parameters and pseudo-parameters.
+func templateExports(template *cft.Template) ([]string, error) {
+	names := make([]string, 0)
+	section, err := template.GetSection(cft.Outputs)
+	if err != nil {
+		return names, nil
+	}
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		name, err := exportName(section.Content[i].Value, section.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("export %s is declared more than once", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// templateImports returns the export names used by Fn::ImportValue in
+// the resources and outputs of a template. Resources that are being
+// deleted are ignored. Like in CloudFormation, the name of an import can
+// only refer to parameters and pseudo-parameters.
+func templateImports(template *cft.Template) ([]string, error) {
+	names := make([]string, 0)
+
+	var walk func(n *yaml.Node, what string) error
+	walk = func(n *yaml.Node, what string) error {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == "Fn::ImportValue" {
+					name, err := resolveScalar(n.Content[i+1], &Resource{Name: what})
+					if err != nil {
+						return fmt.Errorf("unable to resolve Fn::ImportValue in %s: %v", what, err)
+					}
+					if !slices.Contains(names, name) {
+						names = append(names, name)
+					}
+					continue
+				}
+				if err := walk(n.Content[i+1], what); err != nil {
+					return err
+				}
+			}
+		} else if n.Kind == yaml.SequenceNode {
+			for _, c := range n.Content {
+				if err := walk(c, what); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if resources, err := template.GetSection(cft.Resources); err == nil {
+		for i := 0; i+1 < len(resources.Content); i += 2 {
+			name := resources.Content[i].Value
+			decl := resources.Content[i+1]
+			if action := resourceAction(decl); action == "Delete" {
+				continue
+			}
+			if err := walk(decl, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if outputs, err := template.GetSection(cft.Outputs); err == nil {
+		for i := 0; i+1 < len(outputs.Content); i += 2 {
+			if err := walk(outputs.Content[i+1], "Outputs."+outputs.Content[i].Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// resourceAction returns the Action in the State of an annotated resource
+func resourceAction(decl *yaml.Node) string {
+	for i := 0; i+1 < len(decl.Content); i += 2 {
+		if decl.Content[i].Value == "State" {
+			s := decl.Content[i+1]
+			for j := 0; j+1 < len(s.Content); j += 2 {
+				if s.Content[j].Value == "Action" {
+					return s.Content[j+1].Value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// checkExports makes sure that every import is exported by another
+// deployment, and that none of the exports are already exported elsewhere
+func checkExports(index *exportIndex, exportNames []string, imports []string) error {
+	for _, name := range exportNames {
+		if prior, ok := index.Values[name]; ok {
+			return fmt.Errorf("export %s is already exported by %s", name, prior.Deployment)
+		}
+	}
+	for _, name := range imports {
+		if _, ok := index.Values[name]; !ok {
+			return fmt.Errorf("no deployment exports %s", name)
+		}
+	}
+	return nil
+}
+
+// checkExportsInUse returns an error if another deployment imports
+// any of the exports that are about to be removed
+func checkExportsInUse(index *exportIndex, removed []string) error {
+	inUse := make([]string, 0)
+	for _, name := range removed {
+		if importers := index.Importers[name]; len(importers) > 0 {
+			inUse = append(inUse, fmt.Sprintf("%s (imported by %s)", name, strings.Join(importers, ", ")))
+		}
+	}
+	if len(inUse) > 0 {
+		return fmt.Errorf("unable to remove exports that are in use: %s", strings.Join(inUse, "; "))
+	}
+	return nil
+}
+
+// removedExports returns the exports in the prior state
+// that are not in the list of new export names
+func removedExports(prior *cft.Template, exportNames []string) []string {
+	removed := make([]string, 0)
+	for _, output := range readOutputs(prior) {
+		if output.Export != "" && !slices.Contains(exportNames, output.Export) {
+			removed = append(removed, output.Export)
+		}
+	}
+	return removed
+}
+
+// resolveImportValue resolves a node with Fn::ImportValue, using
+// the exports of other deployments in the same state backend
+func resolveImportValue(n *yaml.Node, resource *Resource) (string, error) {
+	name, err := resolveScalar(n, resource)
+	if err != nil {
+		return "", err
+	}
+	if deploymentExports == nil {
+		return "", fmt.Errorf("exports have not been loaded to resolve %s for %s", name, resource.Name)
+	}
+	export, ok := deploymentExports.Values[name]
+	if !ok {
+		return "", fmt.Errorf("no deployment exports %s for %s", name, resource.Name)
+	}
+	config.Debugf("Imported %s from %s", name, export.Deployment)
+	return export.Value, nil
+}
@@ -0,0 +1,175 @@
+package cc
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/format"
+)
+
+// putState writes a state file with the given outputs and imports
+func putState(t *testing.T, backend StateBackend, name string, outputs []Output, imports []string) {
+	state := setTestTemplate(t, "Resources: {}", nil)
+	stateMap := cft.AppendStateMap(state)
+	addOutputs(stateMap, outputs, imports)
+	str := format.String(state, format.Options{})
+	if _, err := backend.Put(name, []byte(str), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	useFakeClient(t, 10)
+	template := setTestTemplate(t, `
+Parameters:
+    Env:
+        Type: String
+Resources:
+    Bucket:
+        Type: AWS::S3::Bucket
+Outputs:
+    BucketName:
+        Description: The bucket
+        Value: !Ref Bucket
+        Export:
+            Name: !Sub ${Env}-bucket
+    Plain:
+        Value: hello
+`, []string{"Env=dev"})
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+
+	outputs, err := resolveOutputs(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Output{
+		{Name: "BucketName", Value: "id-Bucket", Description: "The bucket", Export: "dev-bucket"},
+		{Name: "Plain", Value: "hello"},
+	}
+	if !slices.Equal(outputs, expected) {
+		t.Errorf("expected %v, got %v", expected, outputs)
+	}
+
+	exportNames, err := templateExports(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(exportNames, []string{"dev-bucket"}) {
+		t.Errorf("unexpected exports %v", exportNames)
+	}
+
+	// Outputs are stored in the state file
+	stateMap := cft.AppendStateMap(template)
+	addOutputs(stateMap, outputs, []string{"other"})
+	if got := readOutputs(template); !slices.Equal(got, expected) {
+		t.Errorf("expected %v to be stored, got %v", expected, got)
+	}
+	if got := readImports(template); !slices.Equal(got, []string{"other"}) {
+		t.Errorf("unexpected imports %v", got)
+	}
+}
+
+func TestImportValue(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	backend := &fileBackend{dir: t.TempDir()}
+	putState(t, backend, "network", []Output{
+		{Name: "VpcId", Value: "vpc-123", Export: "dev-vpc"},
+		{Name: "Internal", Value: "x"},
+	}, nil)
+
+	template := setTestTemplate(t, `
+Parameters:
+    Env:
+        Type: String
+Resources:
+    Bucket:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !ImportValue
+                Fn::Sub: ${Env}-vpc
+`, []string{"Env=dev"})
+
+	imports, err := templateImports(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(imports, []string{"dev-vpc"}) {
+		t.Fatalf("unexpected imports %v", imports)
+	}
+
+	saved := deploymentExports
+	defer func() { deploymentExports = saved }()
+	deploymentExports, err = loadExports(backend, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExports(deploymentExports, nil, imports); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExports(deploymentExports, nil, []string{"prod-vpc"}); err == nil {
+		t.Error("expected a missing export to fail")
+	}
+	if err := checkExports(deploymentExports, []string{"dev-vpc"}, nil); err == nil {
+		t.Error("expected an export that already exists to fail")
+	}
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatalf("expected deployment to succeed: %v", results.Resources["Bucket"])
+	}
+	if !strings.Contains(fake.resolved["Bucket"], "vpc-123") {
+		t.Errorf("expected the imported value, got %s", fake.resolved["Bucket"])
+	}
+}
+
+func TestExportsInUse(t *testing.T) {
+	backend := &fileBackend{dir: t.TempDir()}
+	putState(t, backend, "network", []Output{
+		{Name: "VpcId", Value: "vpc-123", Export: "dev-vpc"},
+		{Name: "SubnetId", Value: "subnet-123", Export: "dev-subnet"},
+	}, nil)
+	putState(t, backend, "app", nil, []string{"dev-vpc"})
+
+	prior, _, err := readState("network", backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := loadExports(backend, "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing an export that nobody imports is fine
+	removed := removedExports(prior, []string{"dev-vpc"})
+	if !slices.Equal(removed, []string{"dev-subnet"}) {
+		t.Fatalf("unexpected removed exports %v", removed)
+	}
+	if err := checkExportsInUse(index, removed); err != nil {
+		t.Error(err)
+	}
+
+	// Removing the deployment would remove an export that app imports
+	removed = removedExports(prior, nil)
+	err = checkExportsInUse(index, removed)
+	if err == nil || !strings.Contains(err.Error(), "dev-vpc (imported by app)") {
+		t.Errorf("expected dev-vpc to be in use, got %v", err)
+	}
+
+	// Two deployments can't export the same name
+	putState(t, backend, "copy", []Output{{Name: "VpcId", Value: "vpc-456", Export: "dev-vpc"}}, nil)
+	if _, err := loadExports(backend, "app"); err == nil {
+		t.Error("expected a duplicate export to fail")
+	}
+}
@@ -0,0 +1,181 @@
+package cc
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileBackend stores state files in a local directory. It is meant for
+// experiments, tests, and single-developer sandboxes.
+//
+// The lock file is created exclusively, so only one process can hold it.
+// Versions are hashes of the content, and state files are replaced with
+// a rename so that readers never see a partial write.
+type fileBackend struct {
+	dir string
+}
+
+func (b *fileBackend) statePath(name string) string {
+	return filepath.Join(b.dir, name+".yaml")
+}
+
+func (b *fileBackend) lockPath(name string) string {
+	return filepath.Join(b.dir, name+".lock")
+}
+
+// fileVersion returns the version of a file's content
+func fileVersion(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// readFile returns the content and version of a file, or nil if it does not exist
+func readFile(path string) ([]byte, string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return content, fileVersion(content), nil
+}
+
+// checkVersion returns ErrStateChanged if the file does not have the expected version
+func checkVersion(path string, version string) error {
+	content, current, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == "" && content != nil:
+		return fmt.Errorf("%w: %s already exists", ErrStateChanged, path)
+	case version != "" && current != version:
+		return fmt.Errorf("%w: %s", ErrStateChanged, path)
+	}
+	return nil
+}
+
+func (b *fileBackend) Get(name string) ([]byte, string, error) {
+	return readFile(b.statePath(name))
+}
+
+func (b *fileBackend) Put(name string, content []byte, version string) (string, error) {
+	path := b.statePath(name)
+	if err := checkVersion(path, version); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return fileVersion(content), nil
+}
+
+func (b *fileBackend) Delete(name string, version string) error {
+	path := b.statePath(name)
+	if err := checkVersion(path, version); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (b *fileBackend) Lock(name string, lock *LockInfo) error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	path := b.lockPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		existing, readErr := b.ReadLock(name)
+		if readErr != nil {
+			return readErr
+		}
+		if existing == nil {
+			// The lock was released in the meantime
+			return b.Lock(name, lock)
+		}
+		return &LockedError{Lock: existing}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create lock file: %v", err)
+	}
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("unable to write lock file: %v", err)
+	}
+
+	lock.version = fileVersion(content)
+	return nil
+}
+
+func (b *fileBackend) Unlock(name string, lock *LockInfo) error {
+	path := b.lockPath(name)
+	if err := checkVersion(path, lock.version); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (b *fileBackend) ReadLock(name string) (*LockInfo, error) {
+	content, version, err := readFile(b.lockPath(name))
+	if err != nil || content == nil {
+		return nil, err
+	}
+	return parseLock(content, version)
+}
+
+func (b *fileBackend) Location(name string) string {
+	return b.statePath(name)
+}
+
+func (b *fileBackend) List() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if ok && name != "" && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
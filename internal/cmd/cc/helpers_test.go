@@ -0,0 +1,24 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/dc"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// setTestTemplate parses a template and sets the globals that deploy
+// would set, with the given parameter values
+func setTestTemplate(t *testing.T, source string, params []string) *cft.Template {
+	template := parseSchedulerTemplate(t, source)
+	stack := types.Stack{}
+	stack.Parameters = make([]types.Parameter, 0)
+	var err error
+	templateConfig, err = dc.GetDeployConfig([]string{}, params, "", "",
+		template, stack, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
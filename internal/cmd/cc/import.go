@@ -0,0 +1,278 @@
+package cc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/aws/ccapi"
+	"github.com/aws-cloudformation/rain/internal/console"
+	"github.com/aws-cloudformation/rain/internal/console/spinner"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var importTemplatePath string
+var importFile string
+
+// getLiveModel is a variable so that tests can avoid calling CCAPI
+var getLiveModel = ccapi.GetResource
+
+// resourceImport is an existing resource to bring under cc management
+type resourceImport struct {
+	LogicalId  string
+	Identifier string
+}
+
+// readImportFile reads a YAML mapping of logical ids to identifiers
+func readImportFile(path string) ([]resourceImport, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var n yaml.Node
+	err = yaml.Unmarshal(content, &n)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if len(n.Content) == 0 || n.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected %s to be a mapping of logical ids to identifiers", path)
+	}
+
+	imports := make([]resourceImport, 0)
+	m := n.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i+1].Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("expected the identifier for %s to be a string", m.Content[i].Value)
+		}
+		imports = append(imports, resourceImport{m.Content[i].Value, m.Content[i+1].Value})
+	}
+	return imports, nil
+}
+
+// newStateTemplate creates an empty state template for a deployment
+// that does not exist yet
+func newStateTemplate(absPath string) *cft.Template {
+	state := &cft.Template{Node: &yaml.Node{Kind: yaml.DocumentNode}}
+	state.Node.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	node.AddMap(state.Node.Content[0], string(cft.Resources))
+	stateMap := cft.AppendStateMap(state)
+	addCommon(stateMap, absPath)
+	return state
+}
+
+// importResource adds a resource and its live model to the state template.
+// The resource declaration comes from the template, if there is one, or from
+// the state template if it is already declared there. It returns the
+// differences between the declared properties and the live model.
+func importResource(state *cft.Template, template *cft.Template, imp resourceImport) ([]PropertyDiff, error) {
+	resources, err := state.GetSection(cft.Resources)
+	if err != nil {
+		return nil, err
+	}
+	stateMap, err := state.GetSection(cft.State)
+	if err != nil {
+		return nil, err
+	}
+	resourceModels := node.AddMap(stateMap, "ResourceModels")
+
+	if _, existing, _ := s11n.GetMapValue(resourceModels, imp.LogicalId); existing != nil {
+		return nil, fmt.Errorf("%s is already managed by this deployment", imp.LogicalId)
+	}
+
+	// Find the declaration
+	_, declared, _ := s11n.GetMapValue(resources, imp.LogicalId)
+	if template != nil {
+		if res, err := template.GetResource(imp.LogicalId); err == nil {
+			declared = node.Clone(res)
+			node.RemoveFromMap(resources, imp.LogicalId)
+			resources.Content = append(resources.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: imp.LogicalId}, declared)
+		}
+	}
+	if declared == nil {
+		return nil, fmt.Errorf("%s is not declared in the template or the state file", imp.LogicalId)
+	}
+
+	typeName := resourceType(declared)
+	if typeName == "" {
+		return nil, fmt.Errorf("expected %s to have a Type", imp.LogicalId)
+	}
+
+	spinner.Push(fmt.Sprintf("Querying CCAPI: %s (%s %s)", imp.LogicalId, typeName, imp.Identifier))
+	model, err := getLiveModel(imp.Identifier, typeName)
+	spinner.Pop()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s %s: %v", typeName, imp.Identifier, err)
+	}
+
+	err = addResourceModel(resourceModels, imp.LogicalId, imp.Identifier, model)
+	if err != nil {
+		return nil, err
+	}
+
+	return importDiff(declared, model)
+}
+
+// importDiff compares the declared properties of a resource with its live
+// model. Properties that are only in the live model are not shown, since
+// most of them are defaults or read-only properties.
+func importDiff(declared *yaml.Node, model string) ([]PropertyDiff, error) {
+	var parsed map[string]any
+	err := json.Unmarshal([]byte(model), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the live model: %v", err)
+	}
+	var live yaml.Node
+	err = live.Encode(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make([]PropertyDiff, 0)
+	for _, d := range diffProperties(nil, &live, resourceProperties(declared)) {
+		if d.Action != PropertyRemove {
+			retval = append(retval, d)
+		}
+	}
+	return retval, nil
+}
+
+// printImportDiff shows the differences between the template and the live model
+func printImportDiff(imp resourceImport, diffs []PropertyDiff) {
+	if len(diffs) == 0 {
+		fmt.Printf("%s %s (%s): the template matches the live resource\n",
+			console.Green("Imported"), imp.LogicalId, imp.Identifier)
+		return
+	}
+
+	fmt.Printf("%s %s (%s): the template does not match the live resource\n",
+		console.Yellow("Imported"), imp.LogicalId, imp.Identifier)
+	for _, d := range diffs {
+		switch d.Action {
+		case PropertyAdd:
+			fmt.Printf("    + %s: %s (not set on the live resource)\n", d.Path, d.New)
+		default:
+			fmt.Printf("    ~ %s: %s (live) => %s (template)\n", d.Path, d.Old, d.New)
+		}
+	}
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	name := args[0]
+
+	var imports []resourceImport
+	if importFile != "" {
+		if len(args) != 1 {
+			panic("Do not pass <LogicalId> and <identifier> with --file")
+		}
+		var err error
+		imports, err = readImportFile(importFile)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		if len(args) != 3 {
+			panic("Expected <name> <LogicalId> <identifier>")
+		}
+		imports = []resourceImport{{args[1], args[2]}}
+	}
+
+	var template *cft.Template
+	absPath := ""
+	if importTemplatePath != "" {
+		template = PackageTemplate(importTemplatePath, yes)
+		absPath, _ = filepath.Abs(importTemplatePath)
+	}
+
+	backend := getBackend(yes)
+
+	lock := newLockInfo(cmd.CommandPath())
+	if err := acquireLock(backend, name, lock); err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := releaseLock(backend, name, lock); err != nil {
+			console.Errorf("unable to release lock: %v", err)
+		}
+	}()
+
+	content, version, err := backend.Get(name)
+	if err != nil {
+		panic(err)
+	}
+
+	var state *cft.Template
+	if content == nil {
+		if template == nil {
+			panic(fmt.Errorf("deployment %s does not exist; pass --template to create it", name))
+		}
+		state = newStateTemplate(absPath)
+	} else {
+		state, err = parse.String(string(content))
+		if err != nil {
+			panic(fmt.Errorf("unable to parse state file: %v", err))
+		}
+		if absPath != "" {
+			stateMap, _ := state.GetSection(cft.State)
+			addCommon(stateMap, absPath)
+		}
+	}
+
+	for _, imp := range imports {
+		diffs, err := importResource(state, template, imp)
+		if err != nil {
+			panic(err)
+		}
+		printImportDiff(imp, diffs)
+	}
+
+	str := format.String(state, format.Options{JSON: false, Unsorted: false})
+	_, err = backend.Put(name, []byte(str), version)
+	if err != nil {
+		panic(fmt.Errorf("unable to write state file: %w", err))
+	}
+
+	fmt.Printf("Imported %d resources into %s\n", len(imports), name)
+}
+
+var CCImportCmd = &cobra.Command{
+	Use:   "import <name> <LogicalId> <identifier>",
+	Short: "Bring an existing resource under management by cc deploy",
+	Long: `Imports an existing resource into the deployment <name>. The resource's current model is read with
+Cloud Control API and recorded in the state file, along with its identifier. The resource is declared by
+the template passed with --template, or by the state file if it is already declared there. Differences
+between the declared properties and the live resource are shown, like drift, so that you can update the
+template to match before you deploy it.
+
+Use --file to import several resources at once, from a YAML file that maps logical ids to identifiers:
+
+  MyBucket: my-bucket-name
+  MyQueue: https://sqs.us-east-1.amazonaws.com/123456789012/my-queue
+
+If the deployment does not exist yet, it is created, and --template is required.
+
+You must pass the --experimental (-x) flag to use this command, to acknowledge that it is experimental and likely to be unstable!
+`,
+	Args:                  cobra.RangeArgs(1, 3),
+	DisableFlagsInUseLine: true,
+	Run:                   runImport,
+}
+
+func init() {
+	CCImportCmd.Flags().StringVarP(&importTemplatePath, "template", "t", "", "template that declares the resources to import")
+	CCImportCmd.Flags().StringVarP(&importFile, "file", "f", "", "YAML file that maps logical ids to identifiers, to import several resources")
+	CCImportCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask questions")
+	addCommonParams(CCImportCmd)
+}
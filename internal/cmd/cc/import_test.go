@@ -0,0 +1,113 @@
+package cc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+)
+
+func TestImportResource(t *testing.T) {
+	saved := getLiveModel
+	getLiveModel = func(identifier string, typeName string) (string, error) {
+		return `{"BucketName": "my-bucket", "VersioningConfiguration": {"Status": "Suspended"}, "Arn": "arn:aws:s3:::my-bucket"}`, nil
+	}
+	defer func() { getLiveModel = saved }()
+
+	template, err := parse.String(`
+Resources:
+  MyBucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: my-bucket
+      VersioningConfiguration:
+        Status: Enabled
+      Tags:
+        - Key: a
+          Value: b
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := newStateTemplate("/tmp/template.yaml")
+	diffs, err := importResource(state, template, resourceImport{"MyBucket", "my-bucket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Arn is only in the live model, so it is not shown
+	actions := make(map[string]string)
+	for _, d := range diffs {
+		actions[d.Path] = d.Action
+	}
+	expected := map[string]string{
+		"VersioningConfiguration.Status": PropertyChange,
+		"Tags":                           PropertyAdd,
+	}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, diffs)
+	}
+	for path, action := range expected {
+		if actions[path] != action {
+			t.Errorf("expected %s to be %v, got %v", path, action, actions[path])
+		}
+	}
+
+	if _, err := state.GetResource("MyBucket"); err != nil {
+		t.Errorf("expected MyBucket to be added to the state template: %v", err)
+	}
+	stateMap, _ := state.GetSection(cft.State)
+	_, models, _ := s11n.GetMapValue(stateMap, "ResourceModels")
+	_, model, _ := s11n.GetMapValue(models, "MyBucket")
+	if model == nil {
+		t.Fatal("expected a resource model for MyBucket")
+	}
+	_, id, _ := s11n.GetMapValue(model, "Identifier")
+	if id == nil || id.Value != "my-bucket" {
+		t.Errorf("expected identifier my-bucket, got %v", id)
+	}
+
+	// The same resource can't be imported twice
+	if _, err := importResource(state, template, resourceImport{"MyBucket", "my-bucket"}); err == nil {
+		t.Error("expected importing MyBucket again to fail")
+	}
+
+	// Resources must be declared
+	if _, err := importResource(state, template, resourceImport{"Missing", "x"}); err == nil {
+		t.Error("expected importing an undeclared resource to fail")
+	}
+}
+
+func TestReadImportFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.yaml")
+	err := os.WriteFile(path, []byte("MyBucket: my-bucket\nMyQueue: https://example.com/queue\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imports, err := readImportFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []resourceImport{{"MyBucket", "my-bucket"}, {"MyQueue", "https://example.com/queue"}}
+	if len(imports) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, imports)
+	}
+	for i := range expected {
+		if imports[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], imports[i])
+		}
+	}
+
+	err = os.WriteFile(path, []byte("- MyBucket\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readImportFile(path); err == nil {
+		t.Error("expected a list to be rejected")
+	}
+}
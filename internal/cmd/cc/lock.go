@@ -0,0 +1,108 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// LockInfo is stored in a lock object next to the state file while
+// a deployment is in progress. The state backend makes sure that
+// only one process can hold it at a time.
+type LockInfo struct {
+	Id      string `yaml:"Id"`
+	Owner   string `yaml:"Owner"`
+	Host    string `yaml:"Host"`
+	Time    string `yaml:"Time"`
+	Command string `yaml:"Command"`
+
+	// version is the version of the lock object, used to
+	// make sure we only delete a lock that we hold
+	version string
+}
+
+func (lock *LockInfo) String() string {
+	return fmt.Sprintf("%s (owner: %s, host: %s, time: %s, command: %s)",
+		lock.Id, lock.Owner, lock.Host, lock.Time, lock.Command)
+}
+
+// LockedError is returned when another process holds the lock
+type LockedError struct {
+	Lock *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("the state file is locked by %v. This means another process is currently deploying this template, or a deployment failed to complete. You will need to manually resolve the issue, or you can try to resume the deployment by running cc deploy with --unlock %s, or remove the lock with cc unlock", e.Lock, e.Lock.Id)
+}
+
+// newLockInfo creates lock metadata for the current process
+func newLockInfo(command string) *LockInfo {
+	lock := &LockInfo{
+		Id:      uuid.New().String(),
+		Time:    time.Now().Format(time.RFC3339),
+		Command: command,
+	}
+
+	if u, err := user.Current(); err == nil {
+		lock.Owner = u.Username
+	}
+
+	lock.Host, _ = os.Hostname()
+
+	return lock
+}
+
+// parseLock reads the lock metadata from a lock object
+func parseLock(content []byte, version string) (*LockInfo, error) {
+	var lock LockInfo
+	err := yaml.Unmarshal(content, &lock)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse lock file: %v", err)
+	}
+	lock.version = version
+	return &lock, nil
+}
+
+// acquireLock takes the lock on a deployment
+func acquireLock(backend StateBackend, name string, lock *LockInfo) error {
+	if err := backend.Lock(name, lock); err != nil {
+		return err
+	}
+	config.Debugf("Acquired lock %v", lock)
+	return nil
+}
+
+// releaseLock releases the lock, as long as we still hold it
+func releaseLock(backend StateBackend, name string, lock *LockInfo) error {
+	err := backend.Unlock(name, lock)
+	if errors.Is(err, ErrStateChanged) {
+		return fmt.Errorf("lock %s is no longer held by this process", lock.Id)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to remove lock: %v", err)
+	}
+	config.Debugf("Released lock %s", lock.Id)
+	return nil
+}
+
+// takeLock adopts an existing lock with the given id, which lets a
+// failed deployment be resumed
+func takeLock(backend StateBackend, name string, lockId string) (*LockInfo, error) {
+	lock, err := backend.ReadLock(name)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("deployment %s is not locked", name)
+	}
+	if lock.Id != lockId {
+		return nil, fmt.Errorf("unlock %v does not match found lock %v", lockId, lock.Id)
+	}
+	return lock, nil
+}
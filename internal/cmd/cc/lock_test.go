@@ -0,0 +1,212 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/parse"
+)
+
+func TestConcurrentLock(t *testing.T) {
+	for kind, backend := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			testConcurrentLock(t, backend)
+		})
+	}
+}
+
+func testConcurrentLock(t *testing.T, backend StateBackend) {
+
+	const n = 20
+	var wg sync.WaitGroup
+	locks := make([]*LockInfo, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			locks[i] = &LockInfo{Id: fmt.Sprintf("lock-%d", i), Command: "rain cc deploy"}
+			errs[i] = acquireLock(backend, "test", locks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var holder *LockInfo
+	for i, err := range errs {
+		if err == nil {
+			if holder != nil {
+				t.Fatalf("%s and %s both acquired the lock", holder.Id, locks[i].Id)
+			}
+			holder = locks[i]
+			continue
+		}
+		var locked *LockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("expected LockedError, got %v", err)
+		}
+	}
+	if holder == nil {
+		t.Fatal("nobody acquired the lock")
+	}
+
+	current, err := backend.ReadLock("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Id != holder.Id || current.Command != "rain cc deploy" {
+		t.Errorf("expected lock %v, got %v", holder, current)
+	}
+
+	// Only the holder can release the lock
+	other := &LockInfo{Id: "other", version: "0"}
+	if err := releaseLock(backend, "test", other); err == nil {
+		t.Error("expected releasing a lock we do not hold to fail")
+	}
+	if err := releaseLock(backend, "test", holder); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := acquireLock(backend, "test", other); err != nil {
+		t.Errorf("expected to acquire the released lock: %v", err)
+	}
+}
+
+func TestTakeLock(t *testing.T) {
+	for kind, backend := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			testTakeLock(t, backend)
+		})
+	}
+}
+
+func testTakeLock(t *testing.T, backend StateBackend) {
+
+	if _, err := takeLock(backend, "test", "abc"); err == nil {
+		t.Error("expected an error when the deployment is not locked")
+	}
+
+	lock := &LockInfo{Id: "abc"}
+	if err := acquireLock(backend, "test", lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := takeLock(backend, "test", "xyz"); err == nil {
+		t.Error("expected an error when the lock id does not match")
+	}
+
+	taken, err := takeLock(backend, "test", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseLock(backend, "test", taken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckStateCreate(t *testing.T) {
+	for kind, backend := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			testCheckStateCreate(t, backend)
+		})
+	}
+}
+
+func testCheckStateCreate(t *testing.T, backend StateBackend) {
+	template, err := parse.File("../../../test/templates/ccdeploy2.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := checkState("test", template, backend, "/tmp/ccdeploy2.yaml", "", "rain cc deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsUpdate || result.ETag == "" || result.StateHash != "" {
+		t.Errorf("unexpected result for a new deployment: %v", result)
+	}
+
+	// A second deployment has to wait for the first one
+	_, err = checkState("test", template, backend, "/tmp/ccdeploy2.yaml", "", "rain cc deploy")
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Lock.Id != result.Lock.Id {
+		t.Fatalf("expected LockedError for %s, got %v", result.Lock.Id, err)
+	}
+
+	// Deleting a state file that someone else changed fails
+	if _, err := backend.Put("test", []byte("Resources: {}"), result.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteState("test", backend, result); !errors.Is(err, ErrStateChanged) {
+		t.Errorf("expected deleting a changed state file to fail, got %v", err)
+	}
+
+	_, result.ETag, _ = backend.Get("test")
+	if err := deleteState("test", backend, result); err != nil {
+		t.Fatal(err)
+	}
+	if content, _, _ := backend.Get("test"); content != nil {
+		t.Error("expected the state file to be removed")
+	}
+	if lock, _ := backend.ReadLock("test"); lock != nil {
+		t.Errorf("expected the lock to be released, found %v", lock)
+	}
+}
+
+func TestAbandonState(t *testing.T) {
+	backend := &fileBackend{dir: t.TempDir()}
+	content := []byte("Resources: {}\nState: {}\n")
+	if _, err := backend.Put("test", content, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	lock := newLockInfo("rain cc deploy")
+	if err := acquireLock(backend, "test", lock); err != nil {
+		t.Fatal(err)
+	}
+	result := &StateResult{Lock: lock, IsUpdate: true, StateHash: stateHash(content)}
+
+	// An existing state file is kept, and only the lock is released
+	if err := abandonState(backend, "test", result); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := backend.Get("test"); string(got) != string(content) {
+		t.Error("expected the state file to be kept")
+	}
+	if lock, _ := backend.ReadLock("test"); lock != nil {
+		t.Errorf("expected the lock to be released, found %v", lock)
+	}
+}
+
+func TestRmReleasesLock(t *testing.T) {
+	dir := t.TempDir()
+	saved, savedExperimental := stateBackendURI, Experimental
+	defer func() { stateBackendURI, Experimental = saved, savedExperimental }()
+	stateBackendURI = "file://" + dir
+	Experimental = true
+
+	backend := &fileBackend{dir: dir}
+	for name, content := range map[string]string{
+		"unparsable": "Resources: [",
+		"nostate":    "Resources: {}\n",
+		"nomodels":   "Resources:\n    A:\n        Type: AWS::S3::Bucket\nState: {}\n",
+	} {
+		if _, err := backend.Put(name, []byte(content), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected rm to fail", name)
+				}
+			}()
+			CCRmCmd.Run(CCRmCmd, []string{name})
+		}()
+
+		if lock, _ := backend.ReadLock(name); lock != nil {
+			t.Errorf("%s: expected the lock to be released, found %v", name, lock)
+		}
+	}
+}
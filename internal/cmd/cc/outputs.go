@@ -0,0 +1,206 @@
+package cc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output is a template output, resolved after a deployment.
+// The JSON names match the Outputs in CloudFormation's DescribeStacks.
+type Output struct {
+	Name        string `json:"OutputKey"`
+	Value       string `json:"OutputValue"`
+	Description string `json:"Description,omitempty"`
+	Export      string `json:"ExportName,omitempty"`
+}
+
+// resolveScalar resolves the intrinsics in a node that has to resolve to a string
+func resolveScalar(n *yaml.Node, resource *Resource) (string, error) {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	resolved, err := resolveValue(n, resource)
+	if err != nil {
+		return "", err
+	}
+	if resolved == nil || resolved.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("expected %s to resolve to a string", resource.Name)
+	}
+	return resolved.Value, nil
+}
+
+// resolveOutputs resolves the Outputs section of a template after all
+// of its resources have been deployed. Outputs whose condition was false
+// have already been removed by applyConditions.
+func resolveOutputs(template *cft.Template) ([]Output, error) {
+	outputs := make([]Output, 0)
+
+	section, err := template.GetSection(cft.Outputs)
+	if err != nil {
+		// The template has no outputs
+		return outputs, nil
+	}
+
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		name := section.Content[i].Value
+		decl := section.Content[i+1]
+		output := Output{Name: name}
+
+		_, value, _ := s11n.GetMapValue(decl, "Value")
+		if value == nil {
+			return nil, fmt.Errorf("output %s does not have a Value", name)
+		}
+		output.Value, err = resolveScalar(value, &Resource{Name: "Outputs." + name})
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve output %s: %v", name, err)
+		}
+
+		if _, desc, _ := s11n.GetMapValue(decl, "Description"); desc != nil {
+			output.Description = desc.Value
+		}
+
+		output.Export, err = exportName(name, decl)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+// exportName resolves the Export Name of an output, or returns an
+// empty string if the output is not exported
+func exportName(name string, decl *yaml.Node) (string, error) {
+	_, export, _ := s11n.GetMapValue(decl, "Export")
+	if export == nil {
+		return "", nil
+	}
+	_, exportNode, _ := s11n.GetMapValue(export, "Name")
+	if exportNode == nil {
+		return "", fmt.Errorf("output %s does not have an Export Name", name)
+	}
+	retval, err := resolveScalar(exportNode, &Resource{Name: "Outputs." + name + ".Export"})
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve the export name for output %s: %v", name, err)
+	}
+	if retval == "" {
+		return "", fmt.Errorf("the export name for output %s is empty", name)
+	}
+	return retval, nil
+}
+
+// addOutputs records resolved outputs in State.Outputs,
+// and the exports used by Fn::ImportValue in State.Imports
+func addOutputs(stateMap *yaml.Node, outputs []Output, imports []string) {
+	node.RemoveFromMap(stateMap, "Outputs")
+	node.RemoveFromMap(stateMap, "Imports")
+
+	if len(outputs) > 0 {
+		outputMap := node.AddMap(stateMap, "Outputs")
+		for _, output := range outputs {
+			m := node.AddMap(outputMap, output.Name)
+			node.Add(m, "Value", output.Value)
+			if output.Description != "" {
+				node.Add(m, "Description", output.Description)
+			}
+			if output.Export != "" {
+				node.Add(m, "Export", output.Export)
+			}
+		}
+	}
+
+	if len(imports) > 0 {
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, name := range imports {
+			seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name})
+		}
+		stateMap.Content = append(stateMap.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "Imports"}, seq)
+	}
+}
+
+// readOutputs returns the outputs recorded in a state file
+func readOutputs(state *cft.Template) []Output {
+	outputs := make([]Output, 0)
+	_, stateMap, _ := s11n.GetMapValue(state.Node.Content[0], string(cft.State))
+	_, outputMap, _ := s11n.GetMapValue(stateMap, "Outputs")
+	if outputMap == nil {
+		return outputs
+	}
+	for i := 0; i+1 < len(outputMap.Content); i += 2 {
+		output := Output{Name: outputMap.Content[i].Value}
+		m := outputMap.Content[i+1]
+		if _, v, _ := s11n.GetMapValue(m, "Value"); v != nil {
+			output.Value = v.Value
+		}
+		if _, v, _ := s11n.GetMapValue(m, "Description"); v != nil {
+			output.Description = v.Value
+		}
+		if _, v, _ := s11n.GetMapValue(m, "Export"); v != nil {
+			output.Export = v.Value
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs
+}
+
+// readImports returns the exports that a state file recorded as imported
+func readImports(state *cft.Template) []string {
+	imports := make([]string, 0)
+	_, stateMap, _ := s11n.GetMapValue(state.Node.Content[0], string(cft.State))
+	_, seq, _ := s11n.GetMapValue(stateMap, "Imports")
+	if seq == nil {
+		return imports
+	}
+	for _, n := range seq.Content {
+		imports = append(imports, n.Value)
+	}
+	return imports
+}
+
+func runOutputs(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	state, _, err := readState(name, getReadOnlyBackend())
+	if err != nil {
+		panic(fmt.Errorf("unable to read state file: %v", err))
+	}
+	if state == nil {
+		panic(fmt.Errorf("deployment %s does not exist", name))
+	}
+
+	j, err := json.MarshalIndent(readOutputs(state), "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(j))
+}
+
+var CCOutputsCmd = &cobra.Command{
+	Use:   "outputs <name>",
+	Short: "Show the outputs of a deployment created by cc deploy (Experimental!)",
+	Long: `Prints the outputs of the cc deploy deployment named <name> as JSON.
+
+Outputs are resolved after each successful deployment and stored in the state file.
+Outputs with an Export Name can be used by other cc deployments with Fn::ImportValue.
+`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   runOutputs,
+}
+
+func init() {
+	addCommonParams(CCOutputsCmd)
+}
@@ -0,0 +1,558 @@
+package cc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/graph"
+	"github.com/aws-cloudformation/rain/cft/pkg"
+	"github.com/aws-cloudformation/rain/internal/aws/cfn"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/console/spinner"
+	"github.com/aws-cloudformation/rain/internal/dc"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"github.com/aws-cloudformation/rain/internal/ui"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Replace is the action for a resource that has to be deleted and
+// re-created because a create-only property changed
+const Replace diff.ActionType = "Replace"
+
+// Property change actions
+const (
+	PropertyAdd    = "Add"
+	PropertyChange = "Change"
+	PropertyRemove = "Remove"
+)
+
+var planFile string
+
+// Plan is the set of changes that cc deploy will make to a deployment.
+// It is written to a file by cc plan and executed by cc deploy --plan.
+type Plan struct {
+	Name         string `yaml:"Name"`
+	TemplatePath string `yaml:"TemplatePath"`
+
+	// StateHash is the hash of the state file that the plan was made
+	// against, or empty if the deployment did not exist
+	StateHash string `yaml:"StateHash"`
+
+	Params     []string `yaml:"Params,omitempty"`
+	Tags       []string `yaml:"Tags,omitempty"`
+	ConfigFile string   `yaml:"ConfigFile,omitempty"`
+
+	// Template is the packaged template
+	Template string `yaml:"Template"`
+
+	Changes []ResourceChange `yaml:"Changes"`
+}
+
+// ResourceChange is a planned change to a single resource
+type ResourceChange struct {
+	LogicalId  string          `yaml:"LogicalId"`
+	Type       string          `yaml:"Type"`
+	Action     diff.ActionType `yaml:"Action"`
+	Identifier string          `yaml:"Identifier,omitempty"`
+	Properties []PropertyDiff  `yaml:"Properties,omitempty"`
+
+	// Retain is set when a deleted or replaced resource will be
+	// dropped from the state instead of being deleted
+	Retain bool `yaml:"Retain,omitempty"`
+}
+
+// PropertyDiff is a change to a property, identified by a dotted path like A.B
+type PropertyDiff struct {
+	Path    string `yaml:"Path"`
+	Action  string `yaml:"Action"`
+	Old     string `yaml:"Old,omitempty"`
+	New     string `yaml:"New,omitempty"`
+	Replace bool   `yaml:"Replace,omitempty"`
+}
+
+// readPlan reads a plan file written by cc plan
+func readPlan(path string) (*Plan, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	err = yaml.Unmarshal(content, &p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse plan file %s: %v", path, err)
+	}
+	if p.Name == "" || p.TemplatePath == "" {
+		return nil, fmt.Errorf("plan file %s is missing Name or TemplatePath", path)
+	}
+	return &p, nil
+}
+
+// Write saves the plan to a YAML file
+func (p *Plan) Write(path string) error {
+	content, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// planChanges compares the template with the state file and returns the
+// changes to each resource. Deletes come last, in the order they will run.
+// stateTemplate is nil for a new deployment.
+func planChanges(stateTemplate *cft.Template, template *cft.Template) ([]ResourceChange, error) {
+	changes := make([]ResourceChange, 0)
+
+	newResources, err := template.GetSection(cft.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	if stateTemplate == nil {
+		for i := 0; i+1 < len(newResources.Content); i += 2 {
+			res := newResources.Content[i+1]
+			changes = append(changes, ResourceChange{
+				LogicalId:  newResources.Content[i].Value,
+				Type:       resourceType(res),
+				Action:     diff.Create,
+				Properties: diffProperties(nil, nil, resourceProperties(res)),
+			})
+		}
+		return changes, nil
+	}
+
+	stateResources, err := stateTemplate.GetSection(cft.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers := make(map[string]string)
+	models := make(map[string]*yaml.Node)
+	if rm, err := stateTemplate.GetNode(cft.State, "ResourceModels"); err == nil {
+		for i := 0; i+1 < len(rm.Content); i += 2 {
+			_, id, _ := s11n.GetMapValue(rm.Content[i+1], "Identifier")
+			if id != nil {
+				identifiers[rm.Content[i].Value] = id.Value
+			}
+			_, model, _ := s11n.GetMapValue(rm.Content[i+1], "Model")
+			if model != nil {
+				models[rm.Content[i].Value] = model
+			}
+		}
+	}
+
+	// Replacing a resource can force changes to the resources that refer to it
+	replaced, refUpdates := planReplacements(stateResources, newResources)
+
+	for i := 0; i+1 < len(newResources.Content); i += 2 {
+		name := newResources.Content[i].Value
+		res := newResources.Content[i+1]
+		change := ResourceChange{
+			LogicalId:  name,
+			Type:       resourceType(res),
+			Identifier: identifiers[name],
+		}
+
+		_, prior, _ := s11n.GetMapValue(stateResources, name)
+		if prior == nil {
+			change.Action = diff.Create
+			change.Properties = diffProperties(nil, nil, resourceProperties(res))
+			changes = append(changes, change)
+			continue
+		}
+
+		change.Properties = diffProperties(nil, resourceProperties(prior), resourceProperties(res))
+		showModelValues(change.Properties, models[name])
+
+		predictReplacements(change.Type, change.Properties)
+		for _, ref := range refUpdates[name] {
+			if !slices.ContainsFunc(change.Properties, func(p PropertyDiff) bool { return p.Path == ref.Path }) {
+				change.Properties = append(change.Properties, ref)
+			}
+		}
+
+		switch {
+		case replaced[name]:
+			change.Action = Replace
+			change.Retain, err = retainOnReplace(res)
+			if err != nil {
+				return nil, fmt.Errorf("resource %s: %v", name, err)
+			}
+		case len(change.Properties) > 0 || !sameResource(prior, res):
+			change.Action = diff.Update
+		default:
+			change.Action = diff.None
+		}
+
+		if change.Action != diff.None {
+			changes = append(changes, change)
+		}
+	}
+
+	for _, name := range deletionOrder(stateTemplate, template) {
+		_, prior, _ := s11n.GetMapValue(stateResources, name)
+		change := ResourceChange{
+			LogicalId:  name,
+			Type:       resourceType(prior),
+			Action:     diff.Delete,
+			Identifier: identifiers[name],
+			Properties: diffProperties(nil, resourceProperties(prior), nil),
+		}
+		change.Retain, err = retainOnDelete(prior, false)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %v", name, err)
+		}
+		showModelValues(change.Properties, models[name])
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// deletionOrder returns the resources that are in the state but not in the
+// template, ordered so that dependents are deleted before their dependencies
+func deletionOrder(stateTemplate *cft.Template, template *cft.Template) []string {
+	newResources, _ := template.GetSection(cft.Resources)
+
+	deletes := make([]string, 0)
+	g := graph.New(stateTemplate)
+	nodes := g.Nodes()
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].Type != string(cft.Resources) {
+			continue
+		}
+		if _, res, _ := s11n.GetMapValue(newResources, nodes[i].Name); res == nil {
+			deletes = append(deletes, nodes[i].Name)
+		}
+	}
+	return deletes
+}
+
+// resourceType returns the Type of a resource node
+func resourceType(resource *yaml.Node) string {
+	_, t, _ := s11n.GetMapValue(resource, "Type")
+	if t == nil {
+		return ""
+	}
+	return t.Value
+}
+
+// resourceProperties returns the Properties of a resource node
+func resourceProperties(resource *yaml.Node) *yaml.Node {
+	_, props, _ := s11n.GetMapValue(resource, "Properties")
+	return props
+}
+
+// sameResource returns true if the resource attributes other than
+// Properties, like DependsOn and Metadata, have not changed
+func sameResource(prior *yaml.Node, res *yaml.Node) bool {
+	attributes := func(n *yaml.Node) string {
+		var m map[string]any
+		n.Decode(&m)
+		delete(m, "Properties")
+		return valueString(m)
+	}
+	return attributes(prior) == attributes(res)
+}
+
+// diffProperties compares two property nodes, recursing into mappings
+func diffProperties(path []string, old *yaml.Node, new *yaml.Node) []PropertyDiff {
+	retval := make([]PropertyDiff, 0)
+
+	p := strings.Join(path, ".")
+	switch {
+	case old == nil && new == nil:
+	case old == nil:
+		if len(path) == 0 {
+			for i := 0; i+1 < len(new.Content); i += 2 {
+				retval = append(retval, diffProperties([]string{new.Content[i].Value}, nil, new.Content[i+1])...)
+			}
+		} else {
+			retval = append(retval, PropertyDiff{Path: p, Action: PropertyAdd, New: nodeString(new)})
+		}
+	case new == nil:
+		if len(path) == 0 {
+			for i := 0; i+1 < len(old.Content); i += 2 {
+				retval = append(retval, diffProperties([]string{old.Content[i].Value}, old.Content[i+1], nil)...)
+			}
+		} else {
+			retval = append(retval, PropertyDiff{Path: p, Action: PropertyRemove, Old: nodeString(old)})
+		}
+	case old.Kind == yaml.MappingNode && new.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			_, v, _ := s11n.GetMapValue(new, old.Content[i].Value)
+			retval = append(retval, diffProperties(append(slices.Clone(path), old.Content[i].Value), old.Content[i+1], v)...)
+		}
+		for i := 0; i+1 < len(new.Content); i += 2 {
+			if _, v, _ := s11n.GetMapValue(old, new.Content[i].Value); v == nil {
+				retval = append(retval, diffProperties(append(slices.Clone(path), new.Content[i].Value), nil, new.Content[i+1])...)
+			}
+		}
+	default:
+		o, n := nodeString(old), nodeString(new)
+		if o != n {
+			retval = append(retval, PropertyDiff{Path: p, Action: PropertyChange, Old: o, New: n})
+		}
+	}
+
+	return retval
+}
+
+// showModelValues replaces old values from the prior template with the values
+// from the resource model, which is what was actually deployed
+func showModelValues(props []PropertyDiff, model *yaml.Node) {
+	if model == nil {
+		return
+	}
+	for i, prop := range props {
+		n := model
+		for _, name := range strings.Split(prop.Path, ".") {
+			_, n, _ = s11n.GetMapValue(n, name)
+			if n == nil {
+				break
+			}
+		}
+		if n != nil {
+			props[i].Old = nodeString(n)
+		}
+	}
+}
+
+// predictReplacements marks the properties that are create-only in the
+// type's schema and returns true if any of them have changed
+func predictReplacements(typeName string, props []PropertyDiff) bool {
+	if len(props) == 0 {
+		return false
+	}
+
+	source, err := cfn.GetTypeSchema(typeName, cfn.UseCacheNormally)
+	if err != nil {
+		config.Debugf("unable to get schema for %s: %v", typeName, err)
+		return false
+	}
+	schema, err := cfn.ParseSchema(source)
+	if err != nil {
+		config.Debugf("unable to parse schema for %s: %v", typeName, err)
+		return false
+	}
+
+	replace := false
+	for i, prop := range props {
+		p := "/properties/" + strings.ReplaceAll(prop.Path, ".", "/")
+		for _, createOnly := range schema.CreateOnlyProperties {
+			if pathsOverlap(p, createOnly) {
+				props[i].Replace = true
+				replace = true
+				break
+			}
+		}
+	}
+	return replace
+}
+
+// pathsOverlap returns true if one schema path is the same
+// as the other, or contains it
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// nodeString formats a value for display in the plan
+func nodeString(n *yaml.Node) string {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return n.Value
+	}
+	return valueString(v)
+}
+
+// valueString formats a decoded value as compact JSON
+func valueString(v any) string {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(j)
+}
+
+// printPlan shows the changes and a summary of the counts
+func printPlan(name string, changes []ResourceChange, total int) {
+	fmt.Printf("Plan for %s:\n\n", name)
+
+	counts := make(map[diff.ActionType]int)
+	deletes := make([]string, 0)
+	for _, c := range changes {
+		counts[c.Action]++
+
+		formatter := updateFormat
+		switch c.Action {
+		case diff.Create:
+			formatter = createFormat
+		case Replace, diff.Delete:
+			formatter = deleteFormat
+			if c.Action == diff.Delete {
+				deletes = append(deletes, c.LogicalId)
+			}
+		}
+
+		line := fmt.Sprintf("%-8s %s (%s)", c.Action, c.LogicalId, c.Type)
+		if c.Identifier != "" {
+			line += " " + c.Identifier
+		}
+		if c.Retain {
+			line += " (retain)"
+		}
+		fmt.Println(formatter("%s", line))
+
+		for _, p := range c.Properties {
+			var prop string
+			switch p.Action {
+			case PropertyAdd:
+				prop = fmt.Sprintf("+ %s: %s", p.Path, p.New)
+			case PropertyRemove:
+				prop = fmt.Sprintf("- %s: %s", p.Path, p.Old)
+			default:
+				prop = fmt.Sprintf("~ %s: %s => %s", p.Path, p.Old, p.New)
+			}
+			if p.Replace {
+				prop += " (forces replacement)"
+			}
+			fmt.Println("    " + prop)
+		}
+	}
+
+	if len(deletes) > 0 {
+		fmt.Printf("\nDeletion order: %s\n", strings.Join(deletes, ", "))
+	}
+
+	unchanged := total - counts[diff.Create] - counts[diff.Update] - counts[Replace]
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to replace, %d to delete, %d unchanged\n",
+		counts[diff.Create], counts[diff.Update], counts[Replace], counts[diff.Delete], unchanged)
+}
+
+// packagedString formats a packaged template so that a plan can
+// be compared with the template that is about to be deployed
+func packagedString(t *cft.Template) string {
+	return format.String(t, format.Options{JSON: false, Unsorted: false})
+}
+
+func runPlan(cmd *cobra.Command, args []string) {
+	fn := args[0]
+	name := args[1]
+	base := filepath.Base(fn)
+	absPath, _ := filepath.Abs(fn)
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	// Packaging must not upload anything, create the bucket,
+	// or write the lock file
+	pkg.NoUpload = true
+	pkg.CheckLockOnly = true
+	spinner.Push(fmt.Sprintf("Preparing template '%s'", base))
+	template := PackageTemplate(fn, false)
+	spinner.Pop()
+
+	stack := types.Stack{}
+	stack.Parameters = make([]types.Parameter, 0)
+	dc, err := dc.GetDeployConfig(tags, params, configFilePath, base,
+		template, stack, false, true, ignoreUnknownParams)
+	if err != nil {
+		panic(err)
+	}
+	templateConfig = dc
+
+	if err := applyConditions(template); err != nil {
+		panic(err)
+	}
+
+	backend := getReadOnlyBackend()
+
+	spinner.Push("Reading state")
+	stateTemplate, content, err := readState(name, backend)
+	spinner.Pop()
+	if err != nil {
+		panic(ui.Errorf(err, "unable to read state for %s", name))
+	}
+	if lock, err := backend.ReadLock(name); err == nil && lock != nil {
+		fmt.Printf("Warning: the deployment is locked by %v, so the state may change before the plan is deployed\n\n", lock)
+	}
+
+	changes, err := planChanges(stateTemplate, template)
+	if err != nil {
+		panic(err)
+	}
+
+	resources, _ := template.GetSection(cft.Resources)
+	printPlan(name, changes, len(resources.Content)/2)
+
+	if planFile != "" {
+		p := &Plan{
+			Name:         name,
+			TemplatePath: absPath,
+			StateHash:    stateHash(content),
+			Params:       params,
+			Tags:         tags,
+			ConfigFile:   configFilePath,
+			Template:     packagedString(template),
+			Changes:      changes,
+		}
+		if err := p.Write(planFile); err != nil {
+			panic(ui.Errorf(err, "unable to write plan file %s", planFile))
+		}
+		fmt.Printf("\nPlan written to %s. Run cc deploy --plan %s to apply it.\n", planFile, planFile)
+	}
+}
+
+// checkPlan returns an error if the packaged template has changed since
+// the plan was made. The state file is compared with StateHash once the
+// deployment is locked, by cc deploy.
+func checkPlan(p *Plan, template *cft.Template) error {
+	if packagedString(template) != p.Template {
+		return errors.New("the template has changed since the plan was made; run cc plan again")
+	}
+	return nil
+}
+
+var CCPlanCmd = &cobra.Command{
+	Use:   "plan <template> <name>",
+	Short: "Show the changes that cc deploy would make, without making them",
+	Long: `Compares the template with the state of the deployment <name> and shows the changes that cc deploy
+would make to each resource, down to the property level. Old values come from the resource models
+recorded in the state file. Changes to properties that are create-only in the resource type's schema
+are shown as replacements, and resources that will be deleted are listed in the order they will be
+deleted.
+
+Nothing is deployed or uploaded, the state file is not locked, and rain.lock is checked but not
+written. Use --output to write the plan to a file, and then run cc deploy --plan <file> to deploy
+exactly that plan. Deployment fails if the template or the state file have changed since the plan
+was made.
+
+You must pass the --experimental (-x) flag to use this command, to acknowledge that it is experimental and likely to be unstable!
+`,
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	Run:                   runPlan,
+}
+
+func init() {
+	CCPlanCmd.Flags().StringVarP(&planFile, "output", "o", "", "write the plan to a file that can be deployed with cc deploy --plan")
+	CCPlanCmd.Flags().StringSliceVar(&tags, "tags", []string{}, "add tags to the stack; use the format key1=value1,key2=value2")
+	CCPlanCmd.Flags().StringSliceVar(&params, "params", []string{}, "set parameter values; use the format key1=value1,key2=value2")
+	CCPlanCmd.Flags().StringVarP(&configFilePath, "config", "c", "", "YAML or JSON file to set tags and parameters")
+	CCPlanCmd.Flags().BoolVarP(&ignoreUnknownParams, "ignore-unknown-params", "", false, "Ignore unknown parameters")
+
+	addCommonParams(CCPlanCmd)
+}
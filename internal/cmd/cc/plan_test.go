@@ -0,0 +1,157 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/parse"
+)
+
+func TestPlanChanges(t *testing.T) {
+
+	state, err := parse.File("../../../test/templates/ccdeploy1-state.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := parse.File("../../../test/templates/ccdeploy2.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := planChanges(state, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+
+	a := changes[0]
+	if a.LogicalId != "A" || a.Action != diff.Update {
+		t.Fatalf("expected A to be updated, got %v", a)
+	}
+	if len(a.Properties) != 1 {
+		t.Fatalf("expected one property change on A, got %v", a.Properties)
+	}
+	p := a.Properties[0]
+	if p.Path != "DelaySeconds" || p.Old != "1" || p.New != "2" || p.Replace {
+		t.Errorf("unexpected property change on A: %v", p)
+	}
+
+	if changes[1].LogicalId != "D" || changes[1].Action != diff.Create {
+		t.Errorf("expected D to be created, got %v", changes[1])
+	}
+
+	c := changes[2]
+	if c.LogicalId != "C" || c.Action != diff.Delete {
+		t.Errorf("expected C to be deleted, got %v", c)
+	}
+	if c.Identifier != "https://sqs.us-east-1.amazonaws.com/755952356119/ccdeploy-c" {
+		t.Errorf("unexpected identifier for C: %v", c.Identifier)
+	}
+}
+
+func TestPlanReplace(t *testing.T) {
+
+	state, err := parse.String(`
+Resources:
+  A:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: a
+State:
+  ResourceModels:
+    A:
+      Identifier: a
+      Model:
+        QueueName: a
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := parse.String(`
+Resources:
+  A:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: b
+      DelaySeconds: 5
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := planChanges(state, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Action != Replace {
+		t.Fatalf("expected A to be replaced, got %v", changes)
+	}
+	for _, p := range changes[0].Properties {
+		if p.Replace != (p.Path == "QueueName") {
+			t.Errorf("unexpected replacement prediction for %v", p)
+		}
+	}
+}
+
+func TestDeletionOrder(t *testing.T) {
+
+	state, err := parse.String(`
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+  Policy:
+    Type: AWS::S3::BucketPolicy
+    Properties:
+      Bucket: !Ref Bucket
+  Topic:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !GetAtt Policy.Id
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := parse.String(`
+Resources:
+  Other:
+    Type: AWS::SQS::Queue
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := deletionOrder(state, template)
+	expected := []string{"Topic", "Policy", "Bucket"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"/properties/A", "/properties/A", true},
+		{"/properties/A/B", "/properties/A", true},
+		{"/properties/A", "/properties/A/B", true},
+		{"/properties/AB", "/properties/A", false},
+	}
+	for _, c := range cases {
+		if pathsOverlap(c.a, c.b) != c.expected {
+			t.Errorf("pathsOverlap(%s, %s) should be %v", c.a, c.b, c.expected)
+		}
+	}
+}
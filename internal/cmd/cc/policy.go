@@ -0,0 +1,238 @@
+package cc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// Resource attributes that control what happens to a resource
+// when it is deleted or replaced
+const (
+	DeletionPolicy      = "DeletionPolicy"
+	UpdateReplacePolicy = "UpdateReplacePolicy"
+)
+
+// Policy values
+const (
+	PolicyDelete               = "Delete"
+	PolicyRetain               = "Retain"
+	PolicyRetainExceptOnCreate = "RetainExceptOnCreate"
+	PolicySnapshot             = "Snapshot"
+)
+
+// resourcePolicy returns the DeletionPolicy or UpdateReplacePolicy of a
+// resource declaration. The default is Delete.
+func resourcePolicy(decl *yaml.Node, attribute string) (string, error) {
+	_, policy, _ := s11n.GetMapValue(decl, attribute)
+	if policy == nil {
+		return PolicyDelete, nil
+	}
+	if policy.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("expected %s to be a string", attribute)
+	}
+
+	valid := []string{PolicyDelete, PolicyRetain, PolicySnapshot}
+	if attribute == DeletionPolicy {
+		valid = append(valid, PolicyRetainExceptOnCreate)
+	}
+	if !slices.Contains(valid, policy.Value) {
+		return "", fmt.Errorf("invalid %s: %s", attribute, policy.Value)
+	}
+	return policy.Value, nil
+}
+
+// retainOnDelete returns true if a resource should be dropped from the
+// state instead of being deleted. created is true when the resource is
+// being deleted by a rollback of the deployment that created it.
+// A stored Snapshot policy is treated like Delete.
+func retainOnDelete(decl *yaml.Node, created bool) (bool, error) {
+	policy, err := resourcePolicy(decl, DeletionPolicy)
+	if err != nil {
+		return false, err
+	}
+	switch policy {
+	case PolicyRetain:
+		return true, nil
+	case PolicyRetainExceptOnCreate:
+		return !created, nil
+	default:
+		return false, nil
+	}
+}
+
+// retainOnReplace returns true if the old resource should be dropped from
+// the state instead of being deleted after it has been replaced.
+// A stored Snapshot policy is treated like Delete.
+func retainOnReplace(decl *yaml.Node) (bool, error) {
+	policy, err := resourcePolicy(decl, UpdateReplacePolicy)
+	if err != nil {
+		return false, err
+	}
+	return policy == PolicyRetain, nil
+}
+
+// checkPolicies makes sure that the policies in a template are
+// supported, before anything is deployed
+func checkPolicies(template *cft.Template) error {
+	resources, err := template.GetSection(cft.Resources)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		for _, attribute := range []string{DeletionPolicy, UpdateReplacePolicy} {
+			policy, err := resourcePolicy(resources.Content[i+1], attribute)
+			if err == nil && policy == PolicySnapshot {
+				// Cloud Control API deletes resources without taking a snapshot
+				err = fmt.Errorf("%s: Snapshot is not supported by cc; use Retain or Delete", attribute)
+			}
+			if err != nil {
+				return fmt.Errorf("resource %s: %v", resources.Content[i].Value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasSnapshotPolicy returns true if a resource declaration has a
+// DeletionPolicy of Snapshot. Deployments stored before Snapshot was
+// rejected can still have one, and those resources are deleted without
+// a snapshot.
+func hasSnapshotPolicy(decl *yaml.Node) bool {
+	policy, err := resourcePolicy(decl, DeletionPolicy)
+	return err == nil && policy == PolicySnapshot
+}
+
+// warnSnapshots prints a warning about deleted resources that have a
+// DeletionPolicy of Snapshot
+func warnSnapshots(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Printf("Warning: Snapshot is not supported by cc, so these resources will be deleted without a snapshot: %s\n",
+		strings.Join(names, ", "))
+}
+
+// needsReplacement returns true if a resource can't be updated in place,
+// because its type or one of its create-only properties changed
+func needsReplacement(prior *yaml.Node, res *yaml.Node) bool {
+	if resourceType(prior) != resourceType(res) {
+		return true
+	}
+	props := diffProperties(nil, resourceProperties(prior), resourceProperties(res))
+	return predictReplacements(resourceType(res), props)
+}
+
+// referenceChanges returns a change for each top level property of a
+// resource that refers to one of the replaced resources, since their
+// values will change when the new resources are created
+func referenceChanges(res *yaml.Node, replaced map[string]bool) []PropertyDiff {
+	changes := make([]PropertyDiff, 0)
+	props := resourceProperties(res)
+	if props == nil {
+		return changes
+	}
+	for i := 0; i+1 < len(props.Content); i += 2 {
+		refers := false
+		visitRefs(props.Content[i+1], func(name string) string {
+			refers = refers || replaced[name]
+			return name
+		})
+		if refers {
+			changes = append(changes, PropertyDiff{
+				Path:   props.Content[i].Value,
+				Action: PropertyChange,
+				Old:    nodeString(props.Content[i+1]),
+				New:    nodeString(props.Content[i+1]),
+			})
+		}
+	}
+	return changes
+}
+
+// planReplacements returns the resources in both the state and the template
+// that have to be replaced, and the property changes for resources that have
+// to be updated because they refer to a replaced resource. A resource that
+// refers to a replaced resource in a create-only property is replaced too.
+func planReplacements(stateResources *yaml.Node, newResources *yaml.Node) (map[string]bool, map[string][]PropertyDiff) {
+	replaced := make(map[string]bool)
+	names := make([]string, 0)
+	for i := 0; i+1 < len(newResources.Content); i += 2 {
+		name := newResources.Content[i].Value
+		_, prior, _ := s11n.GetMapValue(stateResources, name)
+		if prior == nil {
+			continue
+		}
+		names = append(names, name)
+		if needsReplacement(prior, newResources.Content[i+1]) {
+			replaced[name] = true
+		}
+	}
+
+	refUpdates := make(map[string][]PropertyDiff)
+	for {
+		clear(refUpdates)
+		more := false
+		for _, name := range names {
+			if replaced[name] {
+				continue
+			}
+			_, res, _ := s11n.GetMapValue(newResources, name)
+			changes := referenceChanges(res, replaced)
+			if len(changes) == 0 {
+				continue
+			}
+			if predictReplacements(resourceType(res), changes) {
+				replaced[name] = true
+				more = true
+			} else {
+				refUpdates[name] = changes
+			}
+		}
+		if !more {
+			break
+		}
+	}
+
+	return replaced, refUpdates
+}
+
+// snapshotResources returns the names of the resources in a template that
+// have a DeletionPolicy of Snapshot
+func snapshotResources(template *cft.Template) ([]string, error) {
+	names := make([]string, 0)
+	resources, err := template.GetSection(cft.Resources)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		if hasSnapshotPolicy(resources.Content[i+1]) {
+			names = append(names, resources.Content[i].Value)
+		}
+	}
+	return names, nil
+}
+
+// retainedResources returns the names of the resources in a template that
+// will be dropped from the state instead of being deleted
+func retainedResources(template *cft.Template) ([]string, error) {
+	retained := make([]string, 0)
+	resources, err := template.GetSection(cft.Resources)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		retain, err := retainOnDelete(resources.Content[i+1], false)
+		if err != nil {
+			return nil, err
+		}
+		if retain {
+			retained = append(retained, resources.Content[i].Value)
+		}
+	}
+	return retained, nil
+}
@@ -0,0 +1,282 @@
+package cc
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+)
+
+// deleteOps returns the Delete operations that the fake client received
+func deleteOps(fake *fakeClient) []string {
+	deletes := make([]string, 0)
+	for _, op := range fake.ops {
+		if strings.HasPrefix(op, "Delete ") {
+			deletes = append(deletes, op)
+		}
+	}
+	return deletes
+}
+
+func TestCheckPolicies(t *testing.T) {
+	cases := map[string]bool{
+		"DeletionPolicy: Retain":                    true,
+		"DeletionPolicy: RetainExceptOnCreate":      true,
+		"UpdateReplacePolicy: Delete":               true,
+		"DeletionPolicy: Snapshot":                  false,
+		"UpdateReplacePolicy: RetainExceptOnCreate": false,
+		"DeletionPolicy: Keep":                      false,
+		"DeletionPolicy: [Retain]":                  false,
+	}
+	for policy, valid := range cases {
+		template, err := parse.String("Resources:\n    A:\n        Type: AWS::S3::Bucket\n        " + policy + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkPolicies(template)
+		if valid && err != nil {
+			t.Errorf("expected %s to be valid: %v", policy, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %s to be invalid", policy)
+		}
+	}
+}
+
+func TestRetainOnDelete(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	template := parseSchedulerTemplate(t, `
+Resources:
+    Kept:
+        Type: AWS::S3::Bucket
+        DeletionPolicy: Retain
+        State:
+            Action: Delete
+            Identifier: k
+    Removed:
+        Type: AWS::S3::Bucket
+        DeletionPolicy: RetainExceptOnCreate
+        State:
+            Action: Delete
+            Identifier: r
+    Deleted:
+        Type: AWS::S3::Bucket
+        State:
+            Action: Delete
+            Identifier: d
+`)
+
+	retained, err := retainedResources(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(retained, []string{"Kept", "Removed"}) {
+		t.Errorf("unexpected retained resources %v", retained)
+	}
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+	if deletes := deleteOps(fake); !slices.Equal(deletes, []string{"Delete Deleted"}) {
+		t.Errorf("unexpected deletes: %v", deletes)
+	}
+	if r := results.Resources["Kept"]; !r.Retain || r.State != Deployed {
+		t.Errorf("expected Kept to be retained, got %v", r)
+	}
+
+	// Retained resources are dropped from the state
+	state, err := resultState(nil, template, results, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, _ := state.GetSection(cft.Resources)
+	if len(resources.Content) != 0 {
+		t.Errorf("expected no resources in the state, got %d", len(resources.Content)/2)
+	}
+}
+
+// Deployments stored before Snapshot was rejected can still be removed
+func TestDeleteStoredSnapshot(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	template := parseSchedulerTemplate(t, `
+Resources:
+    Volume:
+        Type: AWS::EC2::Volume
+        DeletionPolicy: Snapshot
+        State:
+            Action: Delete
+            Identifier: v
+`)
+
+	retained, err := retainedResources(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retained) != 0 {
+		t.Errorf("unexpected retained resources %v", retained)
+	}
+	snapshots, err := snapshotResources(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(snapshots, []string{"Volume"}) {
+		t.Errorf("unexpected snapshot resources %v", snapshots)
+	}
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+	if deletes := deleteOps(fake); !slices.Equal(deletes, []string{"Delete Volume"}) {
+		t.Errorf("unexpected deletes: %v", deletes)
+	}
+}
+
+func TestRollbackRetainExceptOnCreate(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["B"] = []error{errors.New("access denied")}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        DeletionPolicy: RetainExceptOnCreate
+    R:
+        Type: AWS::S3::Bucket
+        DeletionPolicy: Retain
+    B:
+        Type: AWS::S3::Bucket
+        DependsOn: [A, R]
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+	if _, err := rollback(template, results); err != nil {
+		t.Fatal(err)
+	}
+
+	// A was created by the failed deployment, so it is deleted
+	if deletes := deleteOps(fake); !slices.Equal(deletes, []string{"Delete A"}) {
+		t.Errorf("unexpected deletes: %v", deletes)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	for _, retain := range []bool{false, true} {
+		fake := useFakeClient(t, 10)
+		policy := "Delete"
+		if retain {
+			policy = "Retain"
+		}
+		template := parseSchedulerTemplate(t, `
+Resources:
+    Bucket:
+        Type: AWS::S3::Bucket
+        UpdateReplacePolicy: `+policy+`
+        Properties:
+            BucketName: new
+        State:
+            Action: Replace
+            Identifier: old
+    Policy:
+        Type: AWS::S3::BucketPolicy
+        Properties:
+            Bucket: other
+            PolicyDocument:
+                Resource: !Ref Bucket
+        State:
+            Action: Update
+            Identifier: p
+`)
+
+		results, err := DeployTemplate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !results.Succeeded {
+			t.Fatalf("expected deployment to succeed: %v, %v", results.Resources["Bucket"], results.Resources["Policy"])
+		}
+
+		// The new bucket is created before anything refers to it,
+		// and the old one is deleted last
+		expected := []string{"Create Bucket", "Update Policy", "Delete Bucket"}
+		if retain {
+			expected = expected[:2]
+		}
+		if !slices.Equal(fake.ops, expected) {
+			t.Errorf("expected %v, got %v", expected, fake.ops)
+		}
+
+		if r := results.Resources["Bucket"]; r.Identifier != "id-Bucket" || r.ReplacedIdentifier != "old" {
+			t.Errorf("unexpected identifiers for the replacement: %v", r)
+		}
+		old := results.Replaced["Bucket"]
+		if old == nil || old.Identifier != "old" || old.State != Deployed || old.Retain != retain {
+			t.Errorf("unexpected replaced resource: %v", old)
+		}
+	}
+}
+
+func TestPlanReplacements(t *testing.T) {
+	source := `
+Resources:
+    Bucket:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: old
+    Attached:
+        Type: AWS::S3::BucketPolicy
+        Properties:
+            Bucket: !Ref Bucket
+            PolicyDocument: {}
+    Referring:
+        Type: AWS::S3::BucketPolicy
+        Properties:
+            Bucket: other
+            PolicyDocument:
+                Resource: !GetAtt Bucket.Arn
+    Unrelated:
+        Type: AWS::S3::Bucket
+`
+	prior, err := parse.String(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateResources, _ := prior.GetSection(cft.Resources)
+
+	changed, err := parse.String(strings.Replace(source, "BucketName: old", "BucketName: new", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResources, _ := changed.GetSection(cft.Resources)
+
+	// Nothing changed
+	replaced, refUpdates := planReplacements(stateResources, stateResources)
+	if len(replaced) != 0 || len(refUpdates) != 0 {
+		t.Errorf("expected no replacements, got %v, %v", replaced, refUpdates)
+	}
+
+	// BucketName is create-only, and so is the Bucket of a bucket policy
+	replaced, refUpdates = planReplacements(stateResources, newResources)
+	if len(replaced) != 2 || !replaced["Bucket"] || !replaced["Attached"] {
+		t.Errorf("expected Bucket and Attached to be replaced, got %v", replaced)
+	}
+	if len(refUpdates) != 1 || len(refUpdates["Referring"]) != 1 ||
+		refUpdates["Referring"][0].Path != "PolicyDocument" {
+		t.Errorf("expected Referring to be updated, got %v", refUpdates)
+	}
+}
@@ -24,16 +24,15 @@ import (
 //	Ref
 //	Fn::GetAtt
 //	Fn::Sub
+//	Fn::ImportValue (exports from other cc deployments)
 //
 // Not Supported:
 //
 //	Fn::Base64
 //	Fn::Cidr
-//	Condition functions
 //	Fn::FindInMap
 //	Fn::ForEach
 //	Fn::GetAZs
-//	Fn::ImportValue
 //	Fn::Join
 //	Fn::Length
 //	Fn::Select
@@ -49,7 +48,9 @@ const AWS_PREFIX = "AWS::"
 // TODO: What about intrinsics outside of Resources?
 
 // resolveNode is a recursive function that resolves all
-// intrinsics in the resource node and its children
+// intrinsics in the resource node and its children.
+// It returns nil if the node resolves to AWS::NoValue.
+// Fn::If has already been resolved by applyConditions.
 func resolveNode(n *yaml.Node, resource *Resource) (*yaml.Node, error) {
 
 	config.Debugf("resolveNode: %s", node.ToSJson(n))
@@ -61,10 +62,19 @@ func resolveNode(n *yaml.Node, resource *Resource) (*yaml.Node, error) {
 	// We'll return a clone of the node, with intrinsics resolved
 	retval := node.Clone(n)
 
+	// Keys whose values resolved to AWS::NoValue
+	noValue := make(map[int]bool)
+
 	for i := 0; i < len(n.Content); i += 2 {
 		mapkey := n.Content[i]
 		mapval := n.Content[i+1]
-		if mapkey.Kind == yaml.ScalarNode && mapkey.Value == "Ref" {
+		if mapkey.Kind == yaml.ScalarNode && mapkey.Value == "Ref" &&
+			mapval.Value == AWS_PREFIX+"NoValue" {
+
+			config.Debugf("This is a Ref to AWS::NoValue")
+			return nil, nil
+
+		} else if mapkey.Kind == yaml.ScalarNode && mapkey.Value == "Ref" {
 			config.Debugf("This is a Ref")
 			refVal, err := resolveRef(mapval, resource)
 			if err != nil {
@@ -113,6 +123,16 @@ func resolveNode(n *yaml.Node, resource *Resource) (*yaml.Node, error) {
 
 			retval = &yaml.Node{Kind: yaml.ScalarNode, Value: getAttVal}
 
+		} else if mapkey.Kind == yaml.ScalarNode && mapkey.Value == "Fn::ImportValue" {
+
+			config.Debugf("This is an ImportValue")
+			importVal, err := resolveImportValue(mapval, resource)
+			if err != nil {
+				return nil, err
+			}
+
+			retval = &yaml.Node{Kind: yaml.ScalarNode, Value: importVal}
+
 		} else if mapkey.Kind == yaml.ScalarNode && mapkey.Value == "Fn::Sub" {
 
 			config.Debugf("This is a Sub")
@@ -125,31 +145,62 @@ func resolveNode(n *yaml.Node, resource *Resource) (*yaml.Node, error) {
 
 			retval = &yaml.Node{Kind: yaml.ScalarNode, Value: subVal}
 
-		} else if mapval.Kind == yaml.MappingNode {
-			// Recurse on a child Mapping node
-			config.Debugf("Recursing on child Mapping node")
-			rn, err := resolveNode(mapval, resource)
+		} else if mapval.Kind == yaml.MappingNode || mapval.Kind == yaml.SequenceNode {
+			// Recurse on a child Mapping or Sequence node
+			config.Debugf("Recursing on child node")
+			rn, err := resolveValue(mapval, resource)
 			if err != nil {
 				return nil, err
 			}
-			retval.Content[i+1] = rn
-		} else if mapval.Kind == yaml.SequenceNode {
-			// Recurse on each element in the sequence
-			for s, sNode := range mapval.Content {
-				if sNode.Kind == yaml.MappingNode {
-					rn, err := resolveNode(sNode, resource)
-					if err != nil {
-						return nil, err
-					}
-					retval.Content[i+1].Content[s] = rn
-				} // otherwise it's a Scalar and we leave it alone
+			if rn == nil {
+				noValue[i] = true
+			} else {
+				retval.Content[i+1] = rn
 			}
 		}
 	}
 
+	// Remove keys whose values resolved to AWS::NoValue
+	if len(noValue) > 0 && retval.Kind == yaml.MappingNode {
+		content := make([]*yaml.Node, 0, len(retval.Content))
+		for i := 0; i < len(retval.Content); i += 2 {
+			if !noValue[i] {
+				content = append(content, retval.Content[i], retval.Content[i+1])
+			}
+		}
+		retval.Content = content
+	}
+
 	return retval, nil
 }
 
+// resolveValue resolves intrinsics in a node of any kind.
+// It returns nil if the node resolves to AWS::NoValue.
+func resolveValue(n *yaml.Node, resource *Resource) (*yaml.Node, error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return resolveNode(n, resource)
+	case yaml.SequenceNode:
+		// Recurse on each element in the sequence, leaving
+		// out elements that resolve to AWS::NoValue
+		retval := node.Clone(n)
+		retval.Content = make([]*yaml.Node, 0, len(n.Content))
+		for _, sNode := range n.Content {
+			rn, err := resolveValue(sNode, resource)
+			if err != nil {
+				return nil, err
+			}
+			if rn != nil {
+				retval.Content = append(retval.Content, rn)
+			}
+		}
+		return retval, nil
+	default:
+		// Scalars are left alone
+		return node.Clone(n), nil
+	}
+}
+
 func resolveRef(refNode *yaml.Node, resource *Resource) (string, error) {
 	if refNode.Kind != yaml.ScalarNode {
 		return "", fmt.Errorf("ref Value is not a scalar for %v", resource.Name)
@@ -170,8 +221,8 @@ func resolvePseudoParam(name string) (string, error) {
 		// TODO: Can't return a string for this!
 		return "", errors.New("unsupported: AWS::NotificationARNs")
 	case "NoValue":
-		// TODO: Needs special handling to remove nodes from the template
-		return "", errors.New("unsupported: AWS::NoValue")
+		// resolveNode removes nodes that are a Ref to AWS::NoValue
+		return "", errors.New("AWS::NoValue can only be used as a property value")
 	case "Partition":
 		region := aws.Config().Region
 		if strings.HasPrefix(region, "us-gov") {
@@ -397,14 +448,14 @@ func resolveSub(n *yaml.Node, resource *Resource) (string, error) {
 				// Likely something like:
 				// [ "${A}", "A", Map [ "Ref", "B" ] ]
 				resolvedNode, err := resolveNode(subNode, resource)
+				if err != nil {
+					return "", err
+				}
 				config.Debugf("Sub sequence mapping resolved: %v", node.ToSJson(resolvedNode))
-				if resolvedNode.Kind != yaml.ScalarNode {
+				if resolvedNode == nil || resolvedNode.Kind != yaml.ScalarNode {
 					return "", fmt.Errorf("expected resolved %s: %s to be a Scalar", sub, key)
 				}
 				subVal = resolvedNode.Value
-				if err != nil {
-					return "", err
-				}
 			} else if subNode.Kind == yaml.ScalarNode {
 				subVal = subNode.Value
 			} else {
@@ -30,8 +30,23 @@ type Resource struct {
 	Model      string
 	Action     diff.ActionType
 	PriorJson  string
-	Start      time.Time
-	End        time.Time
+
+	// AppliedJson is the JSON of the properties that were sent in
+	// an update, so that the update can be rolled back
+	AppliedJson string
+
+	// ReplacedIdentifier and ReplacedType identify the resource that
+	// a replacement is replacing
+	ReplacedIdentifier string
+	ReplacedType       string
+
+	// Retain is set when a resource that is being deleted should be
+	// dropped from the state instead, because of its DeletionPolicy,
+	// or for a replacement, its UpdateReplacePolicy
+	Retain bool
+
+	Start time.Time
+	End   time.Time
 }
 
 func (r Resource) String() string {
@@ -2,11 +2,11 @@ package cc
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/aws-cloudformation/rain/cft"
 	"github.com/aws-cloudformation/rain/cft/format"
 	"github.com/aws-cloudformation/rain/cft/parse"
-	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console"
 	"github.com/aws-cloudformation/rain/internal/console/spinner"
@@ -32,13 +32,30 @@ var CCRmCmd = &cobra.Command{
 		}
 
 		spinner.Push("Fetching deployment status")
-		key := getStateFileKey(name)
 		var state *cft.Template
 
-		// Call RainBucket for side-effects in case we want to force bucket creation
-		bucketName := s3.RainBucket(yes)
+		backend := getBackend(yes)
 
-		obj, err := s3.GetObject(bucketName, key)
+		// Lock the deployment so nobody else deploys it while it is removed
+		lock := newLockInfo(cmd.CommandPath())
+		if err := acquireLock(backend, name, lock); err != nil {
+			panic(err)
+		}
+
+		// Release the lock if anything goes wrong before resources are deleted
+		handedOff := false
+		defer func() {
+			if !handedOff {
+				if err := releaseLock(backend, name, lock); err != nil {
+					config.Debugf("unable to release lock: %v", err)
+				}
+			}
+		}()
+
+		obj, etag, err := backend.Get(name)
+		if err == nil && obj == nil {
+			err = fmt.Errorf("deployment %s does not exist", name)
+		}
 		if err != nil {
 			panic(err)
 		}
@@ -53,19 +70,45 @@ var CCRmCmd = &cobra.Command{
 			panic(fmt.Errorf("did not find State in state file"))
 		}
 
-		lock := ""
+		// Older versions of rain stored the lock in the state file
+		legacyLock := ""
 		for i, s := range stateMap.Content {
 			if s.Kind == yaml.ScalarNode && s.Value == "Lock" {
-				lock = stateMap.Content[i+1].Value
+				legacyLock = stateMap.Content[i+1].Value
 			}
 		}
 
 		spinner.Pop()
 
-		if lock != "" {
+		if legacyLock != "" {
 			msg := "Unable to remove deployment, found a locked state file"
-			panic(fmt.Errorf("%v:\ns3://%v/%v (%v)", msg, bucketName, key, lock))
+			panic(fmt.Errorf("%v:\n%v (%v)", msg, backend.Location(name), legacyLock))
+		}
+
+		// Other deployments might import this deployment's exports
+		if removed := removedExports(state, nil); len(removed) > 0 {
+			index, err := loadExports(backend, name)
+			if err == nil {
+				err = checkExportsInUse(index, removed)
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		// Resources with a DeletionPolicy of Retain are left in place
+		retained, err := retainedResources(state)
+		if err != nil {
+			panic(err)
+		}
+		if len(retained) > 0 {
+			fmt.Printf("These resources will be retained: %s\n", strings.Join(retained, ", "))
 		}
+		snapshots, err := snapshotResources(state)
+		if err != nil {
+			panic(err)
+		}
+		warnSnapshots(snapshots)
 
 		if !yes {
 			if !console.Confirm(false, "Are you sure you want to delete this deployment?") {
@@ -116,16 +159,39 @@ var CCRmCmd = &cobra.Command{
 			panic(err)
 		}
 
+		// Resources might have been deleted, so from here on the lock is only
+		// released once the state file is updated or removed
+		handedOff = true
+
 		spinner.StopTimer()
 
 		results.Summarize()
+
+		if !results.Succeeded {
+			// Record the resources that were not deleted and unlock the state file
+			absPath := ""
+			if _, fp, _ := s11n.GetMapValue(stateMap, FILE_PATH); fp != nil {
+				absPath = fp.Value
+			}
+			err := writeResultState(state, nil, results, nil, backend, name, absPath,
+				&StateResult{Lock: lock, ETag: etag})
+			if err != nil {
+				panic(fmt.Errorf("unable to write state file (lock: %s): %v", lock.Id, err))
+			}
+			panic(fmt.Errorf("unable to remove deployment %v; the state file records the resources that still exist", name))
+		}
+
 		fmt.Printf("Deployment %v successfully removed\n", name)
 
 		spinner.Push("Deleting state file")
-		err = s3.DeleteObject(bucketName, key, nil)
+		err = backend.Delete(name, etag)
 		if err != nil {
 			//lint:ignore ST1005 NA
-			panic(fmt.Errorf("Unable to delete state file %v/%v: %v", bucketName, key, err))
+			panic(fmt.Errorf("Unable to delete state file %v (lock: %s): %v", backend.Location(name), lock.Id, err))
+		}
+		err = releaseLock(backend, name, lock)
+		if err != nil {
+			panic(err)
 		}
 		spinner.Pop()
 	},
@@ -133,5 +199,6 @@ var CCRmCmd = &cobra.Command{
 
 func init() {
 	CCRmCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask questions; just delete")
+	addSchedulerParams(CCRmCmd)
 	addCommonParams(CCRmCmd)
 }
@@ -0,0 +1,335 @@
+package cc
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/graph"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"gopkg.in/yaml.v3"
+)
+
+// noRollback is set by --no-rollback
+var noRollback bool
+
+// subgraph returns the part of the graph that connects the named resources
+func subgraph(g *graph.Graph, names map[string]bool) graph.Graph {
+	sub := graph.Empty()
+	for name := range names {
+		n := graph.Node{Name: name, Type: "Resources"}
+		sub.Link(n)
+		for _, dep := range g.Get(n) {
+			if dep.Type == "Resources" && names[dep.Name] {
+				sub.Link(n, dep)
+			}
+		}
+	}
+	return sub
+}
+
+// priorNode creates a resource node with the properties
+// that a resource had before it was updated
+func priorNode(resource *Resource) (*yaml.Node, error) {
+	var props map[string]any
+	if err := json.Unmarshal([]byte(resource.PriorJson), &props); err != nil {
+		return nil, fmt.Errorf("unable to parse prior properties for %s: %v", resource.Name, err)
+	}
+	var n yaml.Node
+	if err := n.Encode(map[string]any{"Type": resource.Type, "Properties": props}); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// rollback undoes a failed deployment. Resources that were updated are
+// restored to their prior properties, and then resources that were created
+// or replaced are deleted, in reverse dependency order, unless their
+// DeletionPolicy is Retain. The template is the one that
+// was passed to DeployTemplate. The results of anything that was rolled back
+// are returned even if there is an error.
+func rollback(template *cft.Template, results *DeploymentResults) (*DeploymentResults, error) {
+
+	rolledBack := &DeploymentResults{
+		Succeeded: true,
+		Resources: make(map[string]*Resource),
+	}
+
+	restores := make([]*Resource, 0)
+	deletes := make([]*Resource, 0)
+	for name, r := range results.Resources {
+		if r.State != Deployed {
+			continue
+		}
+		switch r.Action {
+		case diff.Update:
+			n, err := priorNode(r)
+			if err != nil {
+				return rolledBack, err
+			}
+			restore := NewResource(name, r.Type, Waiting, n)
+			restore.Action = diff.Update
+			restore.Identifier = r.Identifier
+			restore.PriorJson = r.AppliedJson
+			restores = append(restores, restore)
+		case diff.Create, Replace:
+			// A replacement is deleted like a create, since the
+			// resource that it replaced has not been deleted yet
+			del := NewResource(name, r.Type, Waiting, r.Node)
+			del.Action = diff.Delete
+			del.Identifier = r.Identifier
+			retain, err := retainOnDelete(r.Node, true)
+			if err != nil {
+				return rolledBack, err
+			}
+			del.Retain = retain
+			deletes = append(deletes, del)
+		}
+	}
+
+	config.Debugf("Rolling back %d updates and %d creates", len(restores), len(deletes))
+
+	g := graph.New(template)
+
+	// Restores don't depend on each other, since they only refer
+	// to resources that existed before the deployment
+	names := make(map[string]bool)
+	for _, r := range restores {
+		names[r.Name] = true
+	}
+	sub := graph.Empty()
+	for name := range names {
+		sub.Link(graph.Node{Name: name, Type: "Resources"})
+	}
+	if err := deployResources(restores, rolledBack, &sub); err != nil {
+		return rolledBack, err
+	}
+
+	// Delete the created resources in reverse dependency order
+	names = make(map[string]bool)
+	for _, r := range deletes {
+		names[r.Name] = true
+	}
+	sub = subgraph(&g, names)
+	if err := deployResources(deletes, rolledBack, &sub); err != nil {
+		return rolledBack, err
+	}
+
+	return rolledBack, nil
+}
+
+// resultState creates a state template that records the resources that
+// exist after a deployment that did not succeed. Each resource is recorded
+// with the declaration and model that match what is deployed: resources
+// that were created or updated have the new declaration, resources that
+// failed, were canceled, or were rolled back keep the declaration and model
+// from the prior state, and resources that were deleted are left out.
+//
+// The template is nil when the deployment was removing everything.
+// rolledBack is nil if the deployment was not rolled back.
+func resultState(prior *cft.Template, template *cft.Template,
+	results *DeploymentResults, rolledBack *DeploymentResults, absPath string) (*cft.Template, error) {
+
+	source := template
+	if source == nil {
+		source = prior
+	}
+	state := &cft.Template{Node: node.Clone(source.Node)}
+	rootMap := state.Node.Content[0]
+	node.RemoveFromMap(rootMap, string(cft.State))
+	_, resources, _ := s11n.GetMapValue(rootMap, string(cft.Resources))
+	if resources == nil {
+		return nil, fmt.Errorf("expected to find a Resources section in the template")
+	}
+	newResources := resources.Content
+	resources.Content = make([]*yaml.Node, 0)
+
+	stateMap := cft.AppendStateMap(state)
+	node.Add(stateMap, "LastWriteTime", time.Now().Format(time.RFC3339))
+	addCommon(stateMap, absPath)
+	resourceModels := node.AddMap(stateMap, "ResourceModels")
+
+	// The prior declarations and models, if this was an update
+	var priorResources, priorModels *yaml.Node
+	if prior != nil {
+		_, priorResources, _ = s11n.GetMapValue(prior.Node.Content[0], string(cft.Resources))
+		_, priorStateMap, _ := s11n.GetMapValue(prior.Node.Content[0], string(cft.State))
+		if priorStateMap != nil {
+			_, priorModels, _ = s11n.GetMapValue(priorStateMap, "ResourceModels")
+		}
+	}
+
+	// Outputs are not resolved after a failure, so the prior outputs are kept.
+	// Imports from the new template are added, since resources that use
+	// them might have been kept.
+	outputs := make([]Output, 0)
+	imports := make([]string, 0)
+	if prior != nil {
+		outputs = readOutputs(prior)
+		imports = readImports(prior)
+	}
+	if template != nil {
+		newImports, err := templateImports(template)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range newImports {
+			if !slices.Contains(imports, imp) {
+				imports = append(imports, imp)
+			}
+		}
+	}
+	addOutputs(stateMap, outputs, imports)
+
+	// keepPrior records a resource as it was before the deployment
+	keepPrior := func(name string) error {
+		_, decl, _ := s11n.GetMapValue(priorResources, name)
+		_, model, _ := s11n.GetMapValue(priorModels, name)
+		if decl == nil || model == nil {
+			return fmt.Errorf("did not find %s in the prior state", name)
+		}
+		resources.Content = append(resources.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name}, node.Clone(decl))
+		resourceModels.Content = append(resourceModels.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name}, node.Clone(model))
+		return nil
+	}
+
+	// keep records a resource with the given declaration and model
+	keep := func(name string, decl *yaml.Node, r *Resource, model string) error {
+		if decl == nil {
+			return fmt.Errorf("did not find the declaration for %s", name)
+		}
+		resources.Content = append(resources.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name}, node.Clone(decl))
+		return addResourceModel(resourceModels, name, r.Identifier, model)
+	}
+
+	// Resources in the new template first, then the ones that were removed from it
+	decls := make(map[string]*yaml.Node)
+	order := make([]string, 0)
+	for i := 0; i+1 < len(newResources); i += 2 {
+		decls[newResources[i].Value] = newResources[i+1]
+		order = append(order, newResources[i].Value)
+	}
+	if priorResources != nil {
+		for i := 0; i+1 < len(priorResources.Content); i += 2 {
+			if _, ok := decls[priorResources.Content[i].Value]; !ok {
+				order = append(order, priorResources.Content[i].Value)
+			}
+		}
+	}
+
+	for _, name := range order {
+		r, ok := results.Resources[name]
+		if !ok {
+			continue
+		}
+		var rb *Resource
+		if rolledBack != nil {
+			rb = rolledBack.Resources[name]
+		}
+		undone := rb != nil && rb.State == Deployed
+
+		var err error
+		switch {
+		case r.Action == diff.Create:
+			if r.State == Deployed && !undone {
+				err = keep(name, decls[name], r, r.Model)
+			}
+		case r.Action == Replace && r.State == Deployed:
+			// The resource that was replaced still exists
+			if undone {
+				err = keepPrior(name)
+			} else {
+				err = keep(name, decls[name], r, r.Model)
+			}
+		case r.Action == diff.Update && r.State == Deployed:
+			if undone {
+				err = keep(name, priorDecl(priorResources, name), r, rb.Model)
+			} else {
+				err = keep(name, decls[name], r, r.Model)
+			}
+		case r.Action == diff.Delete && r.State == Deployed:
+			// Deleted
+		case r.Action == diff.None && r.State == Deployed && decls[name] != nil:
+			err = keep(name, decls[name], r, r.Model)
+		default:
+			// Failed or canceled, so it is unchanged
+			err = keepPrior(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config.Debugf("resultState: %v", format.String(state, format.Options{}))
+
+	return state, nil
+}
+
+// orphanedReplacements describes the resources that were replaced by a
+// deployment that did not succeed and are no longer in the state file,
+// since replaced resources are only deleted after a successful deployment
+func orphanedReplacements(results *DeploymentResults, rolledBack *DeploymentResults) []string {
+	orphans := make([]string, 0)
+	for name, r := range results.Resources {
+		if r.Action != Replace || r.State != Deployed {
+			continue
+		}
+		if rolledBack != nil {
+			if rb := rolledBack.Resources[name]; rb != nil && rb.State == Deployed {
+				continue
+			}
+		}
+		orphans = append(orphans, fmt.Sprintf("%s %s (%s)", r.ReplacedType, r.ReplacedIdentifier, name))
+	}
+	slices.Sort(orphans)
+	return orphans
+}
+
+// orphanedCreates describes the resources that a create or replacement left
+// behind when it failed or timed out. They are not in the state file, since
+// they might not have been created correctly, or at all.
+func orphanedCreates(results *DeploymentResults) []string {
+	orphans := make([]string, 0)
+	for name, r := range results.Resources {
+		if (r.Action == diff.Create || r.Action == Replace) && r.State == Failed && r.Identifier != "" {
+			orphans = append(orphans, fmt.Sprintf("%s %s (%s)", r.Type, r.Identifier, name))
+		}
+	}
+	slices.Sort(orphans)
+	return orphans
+}
+
+// priorDecl returns the declaration of a resource in the prior state
+func priorDecl(priorResources *yaml.Node, name string) *yaml.Node {
+	_, decl, _ := s11n.GetMapValue(priorResources, name)
+	return decl
+}
+
+// writeResultState records what exists after a deployment that did not
+// succeed, and releases the lock
+func writeResultState(prior *cft.Template, template *cft.Template,
+	results *DeploymentResults, rolledBack *DeploymentResults,
+	backend StateBackend, name string, absPath string, stateResult *StateResult) error {
+
+	state, err := resultState(prior, template, results, rolledBack, absPath)
+	if err != nil {
+		return err
+	}
+
+	str := format.String(state, format.Options{JSON: false, Unsorted: false})
+	_, err = backend.Put(name, []byte(str), stateResult.ETag)
+	if err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+
+	return releaseLock(backend, name, stateResult.Lock)
+}
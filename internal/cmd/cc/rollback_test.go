@@ -0,0 +1,289 @@
+package cc
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+)
+
+func TestRollbackCreates(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["C"] = []error{errors.New("access denied")}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !Ref B
+    B:
+        Type: AWS::S3::Bucket
+    C:
+        Type: AWS::S3::Bucket
+        DependsOn: A
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+
+	rolledBack, err := rollback(template, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rolledBack.Succeeded {
+		t.Fatal("expected rollback to succeed")
+	}
+
+	// A depends on B, so it has to be deleted first.
+	// C failed, so there is nothing to delete.
+	deletes := make([]string, 0)
+	for _, op := range fake.ops {
+		if op == "Delete A" || op == "Delete B" || op == "Delete C" {
+			deletes = append(deletes, op)
+		}
+	}
+	if !slices.Equal(deletes, []string{"Delete A", "Delete B"}) {
+		t.Errorf("unexpected deletes: %v", deletes)
+	}
+
+	// Nothing was created, so the state has no resources
+	state, err := resultState(nil, template, results, rolledBack, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, _ := state.GetSection(cft.Resources)
+	if len(resources.Content) != 0 {
+		t.Errorf("expected no resources in the state, got %d", len(resources.Content)/2)
+	}
+}
+
+func TestOrphanedCreates(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["A"] = []error{errHandler}
+	fake.exists["id-A-1"] = true
+	fake.failures["B"] = []error{errors.New("access denied")}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+    B:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+
+	// A left a resource behind, B did not
+	expected := []string{"AWS::S3::Bucket id-A-1 (A)"}
+	if got := orphanedCreates(results); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Neither is recorded in the state
+	state, err := resultState(nil, template, results, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, _ := state.GetSection(cft.Resources)
+	if len(resources.Content) != 0 {
+		t.Errorf("expected no resources in the state, got %d", len(resources.Content)/2)
+	}
+}
+
+func TestRollbackUpdates(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["B"] = []error{errors.New("access denied")}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: new
+        State:
+            Action: Update
+            Identifier: a
+            PriorJson: '{"BucketName":"old"}'
+    B:
+        Type: AWS::S3::Bucket
+        DependsOn: A
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+
+	_, err = rollback(template, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A is patched from the properties that were applied back to the prior ones
+	if fake.calls["A"] != 2 {
+		t.Fatalf("expected A to be updated twice, got %d", fake.calls["A"])
+	}
+	if fake.priorJson["A"] != `{"BucketName":"new"}` {
+		t.Errorf("expected the restore to start from the applied properties, got %s", fake.priorJson["A"])
+	}
+	if !strings.Contains(fake.resolved["A"], `"old"`) || strings.Contains(fake.resolved["A"], `"new"`) {
+		t.Errorf("expected A to be restored to old, got %s", fake.resolved["A"])
+	}
+}
+
+func TestResultState(t *testing.T) {
+	prior, err := parse.String(`
+Resources:
+    Updated:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: old
+    FailedUpdate:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: old
+    Removed:
+        Type: AWS::S3::Bucket
+    FailedDelete:
+        Type: AWS::S3::Bucket
+State:
+    ResourceModels:
+        Updated:
+            Identifier: u
+            Model:
+                BucketName: old
+        FailedUpdate:
+            Identifier: f
+            Model:
+                BucketName: old
+        Removed:
+            Identifier: r
+            Model: {}
+        FailedDelete:
+            Identifier: d
+            Model: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := parse.String(`
+Resources:
+    Updated:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: new
+    FailedUpdate:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: new
+    Created:
+        Type: AWS::S3::Bucket
+    Canceled:
+        Type: AWS::S3::Bucket
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := func(name string, action diff.ActionType, state ResourceState, id string) *Resource {
+		return &Resource{Name: name, Type: "AWS::S3::Bucket", Action: action,
+			State: state, Identifier: id, Model: `{"BucketName": "new"}`}
+	}
+	results := &DeploymentResults{Resources: map[string]*Resource{
+		"Updated":      result("Updated", diff.Update, Deployed, "u"),
+		"FailedUpdate": result("FailedUpdate", diff.Update, Failed, "f"),
+		"Created":      result("Created", diff.Create, Deployed, "c"),
+		"Canceled":     result("Canceled", diff.Create, Canceled, ""),
+		"Removed":      result("Removed", diff.Delete, Deployed, "r"),
+		"FailedDelete": result("FailedDelete", diff.Delete, Failed, "d"),
+	}}
+
+	checkModel := func(state *cft.Template, name string, expected string) {
+		t.Helper()
+		stateMap, _ := state.GetSection(cft.State)
+		_, models, _ := s11n.GetMapValue(stateMap, "ResourceModels")
+		_, model, _ := s11n.GetMapValue(models, name)
+		if model == nil {
+			t.Errorf("expected a model for %s", name)
+			return
+		}
+		res, err := state.GetResource(name)
+		if err != nil {
+			t.Errorf("expected %s to be declared: %v", name, err)
+			return
+		}
+		_, m, _ := s11n.GetMapValue(model, "Model")
+		_, mv, _ := s11n.GetMapValue(m, "BucketName")
+		_, props, _ := s11n.GetMapValue(res, "Properties")
+		_, dv, _ := s11n.GetMapValue(props, "BucketName")
+		if expected != "" && (mv == nil || mv.Value != expected || dv == nil || dv.Value != expected) {
+			t.Errorf("expected %s to be %s", name, expected)
+		}
+	}
+
+	names := func(state *cft.Template) []string {
+		resources, _ := state.GetSection(cft.Resources)
+		retval := make([]string, 0)
+		for i := 0; i < len(resources.Content); i += 2 {
+			retval = append(retval, resources.Content[i].Value)
+		}
+		return retval
+	}
+
+	// Without rollback, created and updated resources are kept
+	state, err := resultState(prior, template, results, nil, "/tmp/t.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Updated", "FailedUpdate", "Created", "FailedDelete"}
+	if got := names(state); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	checkModel(state, "Updated", "new")
+	checkModel(state, "FailedUpdate", "old")
+	checkModel(state, "Created", "")
+	checkModel(state, "FailedDelete", "")
+
+	// With rollback, they are restored or removed,
+	// unless the rollback failed for them
+	rolledBack := &DeploymentResults{Resources: map[string]*Resource{
+		"Updated": {Name: "Updated", Action: diff.Update, State: Deployed, Model: `{"BucketName": "old"}`},
+		"Created": {Name: "Created", Action: diff.Delete, State: Failed},
+	}}
+	state, err = resultState(prior, template, results, rolledBack, "/tmp/t.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(state); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	checkModel(state, "Updated", "old")
+	checkModel(state, "Created", "")
+
+	rolledBack.Resources["Created"].State = Deployed
+	state, err = resultState(prior, template, results, rolledBack, "/tmp/t.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"Updated", "FailedUpdate", "FailedDelete"}
+	if got := names(state); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,251 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/graph"
+	"github.com/aws-cloudformation/rain/internal/aws/ccapi"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// resourceClient makes the Cloud Control API calls for a deployment.
+// Tests replace it with a fake.
+type resourceClient interface {
+	Create(ctx context.Context, logicalId string, resource *yaml.Node) (string, string, error)
+	Update(ctx context.Context, logicalId string, identifier string, resource *yaml.Node, priorJson string) (string, error)
+	Delete(ctx context.Context, logicalId string, identifier string, resource *yaml.Node) error
+	Exists(ctx context.Context, typeName string, identifier string) (bool, error)
+	IsRetryable(err error) bool
+	IsRejected(err error) bool
+}
+
+// ccapiClient calls Cloud Control API
+type ccapiClient struct{}
+
+func (ccapiClient) Create(ctx context.Context, logicalId string, resource *yaml.Node) (string, string, error) {
+	return ccapi.CreateResource(ctx, logicalId, resource)
+}
+
+func (ccapiClient) Update(ctx context.Context, logicalId string, identifier string, resource *yaml.Node, priorJson string) (string, error) {
+	return ccapi.UpdateResource(ctx, logicalId, identifier, resource, priorJson)
+}
+
+func (ccapiClient) Delete(ctx context.Context, logicalId string, identifier string, resource *yaml.Node) error {
+	return ccapi.DeleteResource(ctx, logicalId, identifier, resource)
+}
+
+func (ccapiClient) Exists(ctx context.Context, typeName string, identifier string) (bool, error) {
+	_, err := ccapi.GetResource(identifier, typeName)
+	if ccapi.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (ccapiClient) IsRetryable(err error) bool {
+	return ccapi.IsRetryable(err)
+}
+
+func (ccapiClient) IsRejected(err error) bool {
+	return ccapi.IsRejected(err)
+}
+
+var client resourceClient = ccapiClient{}
+
+// Retry settings for throttling and retryable handler errors.
+// These are variables so that tests can make them shorter.
+var maxRetries = 5
+var retryBaseDelay = 2 * time.Second
+var retryMaxDelay = 60 * time.Second
+
+// backoff returns how long to wait before the next attempt, doubling
+// with each attempt up to retryMaxDelay, with jitter so that throttled
+// resources don't all retry at the same time
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 30 {
+		delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// deployWithRetries deploys the resource, retrying errors that might succeed
+// if tried again, until the resource timeout expires
+func deployWithRetries(resource *Resource) error {
+	ctx := context.Background()
+	if resourceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, resourceTimeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := deployResource(ctx, resource)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return fmt.Errorf("timed out after %v: %v", resourceTimeout, err)
+		}
+		if attempt >= maxRetries || !canRetry(ctx, resource, err) {
+			return err
+		}
+
+		delay := backoff(attempt)
+		config.Debugf("Retrying %s in %v after: %v", resource.Name, delay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v: %v", resourceTimeout, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// canRetry returns true if the resource can be deployed again after err.
+// A create is only tried again if it was rejected before anything started,
+// or if the handler failed and the resource it reported does not exist, so
+// that a resource is never created twice.
+func canRetry(ctx context.Context, resource *Resource, err error) bool {
+	if resource.Action != diff.Create && resource.Action != Replace {
+		return client.IsRetryable(err)
+	}
+	if client.IsRejected(err) {
+		return true
+	}
+	if !client.IsRetryable(err) || resource.Identifier == "" {
+		return false
+	}
+
+	exists, existsErr := client.Exists(ctx, resource.Type, resource.Identifier)
+	if existsErr != nil || exists {
+		config.Debugf("Not retrying %s, %s might exist: %v", resource.Name, resource.Identifier, existsErr)
+		return false
+	}
+	resource.Identifier = ""
+	return true
+}
+
+// deployResources deploys a set of resources - either all the deletes, or
+// all of the creates and updates. Deletes are handled in reverse dependency order.
+//
+// Resources start as soon as everything they depend on has been deployed,
+// with no more than parallelism resources in progress at a time. When one
+// fails, nothing else is started, and resources that are in progress are
+// allowed to finish.
+func deployResources(resources []*Resource, results *DeploymentResults, g *graph.Graph) error {
+
+	config.Debugf("About to deploy %v resources", len(resources))
+
+	limit := parallelism
+	if limit < 1 {
+		limit = 1
+	}
+
+	inBatch := make(map[string]*Resource)
+	for _, r := range resources {
+		inBatch[r.Name] = r
+	}
+
+	type outcome struct {
+		resource *Resource
+		err      error
+	}
+	done := make(chan outcome)
+
+	queue := make([]*Resource, 0)
+	queued := make(map[string]bool)
+	enqueue := func(r *Resource) {
+		if !queued[r.Name] && r.State == Waiting && ready(r, g, inBatch) {
+			queued[r.Name] = true
+			queue = append(queue, r)
+		}
+	}
+	for _, r := range resources {
+		enqueue(r)
+	}
+
+	running := 0
+	failed := false
+	for {
+		// Start as many resources as the limit allows
+		for !failed && running < limit && len(queue) > 0 {
+			r := queue[0]
+			queue = queue[1:]
+			r.State = Deploying
+			r.Start = time.Now()
+			running++
+			go func() {
+				err := deployWithRetries(r)
+				done <- outcome{r, err}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		// Wait for a resource to finish
+		o := <-done
+		running--
+		r := o.resource
+		r.End = time.Now()
+		if o.err != nil {
+			config.Debugf("deployResource %s failed: %v", r.Name, o.err)
+			r.State = Failed
+			r.Message = fmt.Sprintf("%v", o.err)
+			failed = true
+			continue
+		}
+		r.State = Deployed
+		r.Message = "Success"
+		if r.Action == diff.Delete && r.Retain {
+			r.Message = "Retained"
+		}
+
+		// Resources that were waiting on this one might be ready now
+		node := graph.Node{Name: r.Name, Type: "Resources"}
+		var next []graph.Node
+		if r.Action == diff.Delete {
+			next = g.Get(node)
+		} else {
+			next = g.GetReverse(node)
+		}
+		for _, n := range next {
+			if nr, ok := inBatch[n.Name]; ok && n.Type == "Resources" {
+				enqueue(nr)
+			}
+		}
+	}
+
+	stuck := make([]string, 0)
+	for _, r := range resources {
+		if r.State == Waiting {
+			if failed {
+				r.State = Canceled
+			} else {
+				stuck = append(stuck, r.Name)
+			}
+		}
+		results.Resources[r.Name] = r
+	}
+
+	if failed {
+		results.Succeeded = false
+	}
+
+	if len(stuck) > 0 {
+		return fmt.Errorf("unable to deploy %v; check for circular dependencies", stuck)
+	}
+
+	return nil
+}
@@ -0,0 +1,390 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/aws/ccapi"
+	"github.com/aws-cloudformation/rain/internal/node"
+	cctypes "github.com/aws/aws-sdk-go-v2/service/cloudcontrol/types"
+	"gopkg.in/yaml.v3"
+)
+
+// errThrottled is a request that was rejected before anything started
+var errThrottled = errors.New("throttled")
+
+// errHandler is a retryable failure reported by a resource handler
+// after the operation started
+var errHandler = &ccapi.HandlerError{Code: cctypes.HandlerErrorCodeInternalFailure, Message: "internal failure"}
+
+// fakeClient stands in for Cloud Control API
+type fakeClient struct {
+	mu         sync.Mutex
+	delay      time.Duration
+	running    int
+	maxRunning int
+	calls      map[string]int
+	finished   map[string]time.Time
+	started    map[string]time.Time
+	resolved   map[string]string
+	priorJson  map[string]string
+
+	// operations in the order they started, like "Create A"
+	ops []string
+
+	// errors to return, in order, before succeeding
+	failures map[string][]error
+
+	// resources that never finish
+	hang map[string]bool
+
+	// identifiers of resources that a failed create left behind
+	exists map[string]bool
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		calls:     make(map[string]int),
+		finished:  make(map[string]time.Time),
+		started:   make(map[string]time.Time),
+		resolved:  make(map[string]string),
+		priorJson: make(map[string]string),
+		failures:  make(map[string][]error),
+		hang:      make(map[string]bool),
+		exists:    make(map[string]bool),
+	}
+}
+
+func (c *fakeClient) do(ctx context.Context, op string, logicalId string, resource *yaml.Node) error {
+	c.mu.Lock()
+	c.ops = append(c.ops, op+" "+logicalId)
+	c.calls[logicalId]++
+	c.running++
+	c.maxRunning = max(c.maxRunning, c.running)
+	c.started[logicalId] = time.Now()
+	c.resolved[logicalId] = node.ToSJson(resource)
+	var err error
+	if f := c.failures[logicalId]; len(f) > 0 {
+		err = f[0]
+		c.failures[logicalId] = f[1:]
+	}
+	hang := c.hang[logicalId]
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.running--
+		c.finished[logicalId] = time.Now()
+		c.mu.Unlock()
+	}()
+
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	time.Sleep(c.delay)
+	return err
+}
+
+func (c *fakeClient) Create(ctx context.Context, logicalId string, resource *yaml.Node) (string, string, error) {
+	if err := c.do(ctx, "Create", logicalId, resource); err != nil {
+		if errors.Is(err, errHandler) {
+			// The handler reports the resource it was creating
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return fmt.Sprintf("id-%s-%d", logicalId, c.calls[logicalId]), "", err
+		}
+		return "", "", err
+	}
+	return "id-" + logicalId, "{}", nil
+}
+
+func (c *fakeClient) Update(ctx context.Context, logicalId string, identifier string, resource *yaml.Node, priorJson string) (string, error) {
+	c.mu.Lock()
+	c.priorJson[logicalId] = priorJson
+	c.mu.Unlock()
+	return "{}", c.do(ctx, "Update", logicalId, resource)
+}
+
+func (c *fakeClient) Delete(ctx context.Context, logicalId string, identifier string, resource *yaml.Node) error {
+	return c.do(ctx, "Delete", logicalId, resource)
+}
+
+func (c *fakeClient) Exists(ctx context.Context, typeName string, identifier string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exists[identifier], nil
+}
+
+func (c *fakeClient) IsRetryable(err error) bool {
+	return errors.Is(err, errThrottled) || errors.Is(err, errHandler)
+}
+
+func (c *fakeClient) IsRejected(err error) bool {
+	return errors.Is(err, errThrottled)
+}
+
+// useFakeClient replaces Cloud Control API and the scheduler settings for a test
+func useFakeClient(t *testing.T, limit int) *fakeClient {
+	fake := newFakeClient()
+	fake.delay = 10 * time.Millisecond
+
+	savedClient, savedParallelism, savedTimeout := client, parallelism, resourceTimeout
+	savedRetries, savedBase, savedMax := maxRetries, retryBaseDelay, retryMaxDelay
+	t.Cleanup(func() {
+		client, parallelism, resourceTimeout = savedClient, savedParallelism, savedTimeout
+		maxRetries, retryBaseDelay, retryMaxDelay = savedRetries, savedBase, savedMax
+	})
+
+	client = fake
+	parallelism = limit
+	resourceTimeout = time.Minute
+	maxRetries = 3
+	retryBaseDelay = time.Millisecond
+	retryMaxDelay = 5 * time.Millisecond
+
+	return fake
+}
+
+func parseSchedulerTemplate(t *testing.T, source string) *cft.Template {
+	template, err := parse.String(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployedTemplate = template
+	return template
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	fake := useFakeClient(t, 2)
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !Ref B
+    B:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !Ref C
+    C:
+        Type: AWS::S3::Bucket
+    D:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+
+	for _, dep := range [][2]string{{"A", "B"}, {"B", "C"}} {
+		if fake.started[dep[0]].Before(fake.finished[dep[1]]) {
+			t.Errorf("%s started before %s finished", dep[0], dep[1])
+		}
+	}
+	if !strings.Contains(fake.resolved["A"], "id-B") {
+		t.Errorf("expected A to get B's identifier, got %s", fake.resolved["A"])
+	}
+	for name, r := range results.Resources {
+		if r.State != Deployed || r.Identifier != "id-"+name {
+			t.Errorf("unexpected result for %s: %v (%s)", name, r, r.Identifier)
+		}
+	}
+}
+
+func TestSchedulerParallelism(t *testing.T) {
+	fake := useFakeClient(t, 3)
+	fake.delay = 30 * time.Millisecond
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+    B:
+        Type: AWS::S3::Bucket
+    C:
+        Type: AWS::S3::Bucket
+    D:
+        Type: AWS::S3::Bucket
+    E:
+        Type: AWS::S3::Bucket
+    F:
+        Type: AWS::S3::Bucket
+    G:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+	if fake.maxRunning != 3 {
+		t.Errorf("expected 3 resources at a time, got %d", fake.maxRunning)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["A"] = []error{errThrottled, errThrottled}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatalf("expected deployment to succeed after retries: %v", results.Resources["A"])
+	}
+	if fake.calls["A"] != 3 {
+		t.Errorf("expected 3 attempts, got %d", fake.calls["A"])
+	}
+}
+
+func TestSchedulerCreateRetry(t *testing.T) {
+	fake := useFakeClient(t, 10)
+
+	// A's first attempt left nothing behind, so it is created again.
+	// B's first attempt left a resource behind, so it is not.
+	fake.failures["A"] = []error{errHandler}
+	fake.failures["B"] = []error{errHandler}
+	fake.exists["id-B-1"] = true
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+    B:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+	if a := results.Resources["A"]; fake.calls["A"] != 2 || a.State != Deployed || a.Identifier != "id-A" {
+		t.Errorf("expected A to be created on the second attempt, got %d attempts: %v (%s)", fake.calls["A"], a, a.Identifier)
+	}
+	if b := results.Resources["B"]; fake.calls["B"] != 1 || b.State != Failed || b.Identifier != "id-B-1" {
+		t.Errorf("expected B to fail with its identifier after one attempt, got %d attempts: %v (%s)", fake.calls["B"], b, b.Identifier)
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	fake.failures["B"] = []error{errors.New("access denied")}
+	fake.failures["C"] = []error{errThrottled, errThrottled, errThrottled, errThrottled, errThrottled}
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        DependsOn: B
+    B:
+        Type: AWS::S3::Bucket
+    C:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+
+	// Errors that are not retryable are not retried
+	if fake.calls["B"] != 1 {
+		t.Errorf("expected 1 attempt for B, got %d", fake.calls["B"])
+	}
+	// Retryable errors give up after maxRetries
+	if fake.calls["C"] != maxRetries+1 {
+		t.Errorf("expected %d attempts for C, got %d", maxRetries+1, fake.calls["C"])
+	}
+	expected := map[string]ResourceState{"A": Canceled, "B": Failed, "C": Failed}
+	for name, state := range expected {
+		if results.Resources[name].State != state {
+			t.Errorf("unexpected result for %s: %v", name, results.Resources[name])
+		}
+	}
+	if fake.calls["A"] != 0 {
+		t.Error("expected A not to be deployed")
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	resourceTimeout = 50 * time.Millisecond
+	fake.hang["A"] = true
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+    B:
+        Type: AWS::S3::Bucket
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Succeeded {
+		t.Fatal("expected deployment to fail")
+	}
+	a := results.Resources["A"]
+	if a.State != Failed || !strings.Contains(a.Message, "timed out") {
+		t.Errorf("expected A to time out, got %v", a)
+	}
+	if results.Resources["B"].State != Deployed {
+		t.Errorf("expected B to be deployed, got %v", results.Resources["B"])
+	}
+}
+
+func TestSchedulerDeletes(t *testing.T) {
+	fake := useFakeClient(t, 10)
+	template := parseSchedulerTemplate(t, `
+Resources:
+    A:
+        Type: AWS::S3::Bucket
+        DependsOn: B
+        State:
+            Action: Delete
+            Identifier: a
+    B:
+        Type: AWS::S3::Bucket
+        State:
+            Action: Delete
+            Identifier: b
+`)
+
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+
+	// A depends on B, so A has to be deleted first
+	if fake.started["B"].Before(fake.finished["A"]) {
+		t.Error("B was deleted before A")
+	}
+}
@@ -1,8 +1,8 @@
 package cc
 
 import (
+	"crypto/sha256"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"time"
 
@@ -10,13 +10,10 @@ import (
 	"github.com/aws-cloudformation/rain/cft/diff"
 	"github.com/aws-cloudformation/rain/cft/format"
 	"github.com/aws-cloudformation/rain/cft/parse"
-	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
 	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/node"
 	"github.com/aws-cloudformation/rain/internal/s11n"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -25,8 +22,16 @@ const FILE_PATH string = "FilePath"
 
 type StateResult struct {
 	StateFile *cft.Template
-	Lock      string
+	Lock      *LockInfo
 	IsUpdate  bool
+
+	// ETag is the version of the state file that we last wrote. Writes
+	// fail if the state file was changed by anyone else in the meantime.
+	ETag string
+
+	// StateHash is the hash of the state file as it was when the lock
+	// was taken, before it was updated, or empty if it did not exist
+	StateHash string
 }
 
 // addCommon adds common elements to the state file
@@ -42,154 +47,160 @@ func addCommon(stateMap *yaml.Node, absPath string) {
 	}
 }
 
-// deleteState removes the state file.
+// deleteState removes the state file and releases the lock.
 // This is necessary when the user cancels a fresh deployment
-func deleteState(name string, bucketName string) error {
-	key := getStateFileKey(name)
-	return s3.DeleteObject(bucketName, key, nil)
+func deleteState(name string, backend StateBackend, stateResult *StateResult) error {
+	err := backend.Delete(name, stateResult.ETag)
+	if err != nil {
+		return err
+	}
+	return releaseLock(backend, name, stateResult.Lock)
+}
+
+// readState downloads the state file without locking it. The state
+// template is nil if the deployment does not exist yet.
+func readState(name string, backend StateBackend) (*cft.Template, []byte, error) {
+	obj, _, err := backend.Get(name)
+	if err != nil || obj == nil {
+		return nil, nil, err
+	}
+
+	state, err := parse.String(string(obj))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse state file: %v", err)
+	}
+
+	return state, obj, nil
 }
 
-// Get the object key for the state file in S3
-func getStateFileKey(name string) string {
-	key := fmt.Sprintf("deployments/%v.yaml", name)
-	if s3.BucketKeyPrefix != "" {
-		key = fmt.Sprintf("%s/%s", s3.BucketKeyPrefix, key)
+// stateHash returns a hash of the contents of a state file,
+// or an empty string if there is no state file
+func stateHash(content []byte) string {
+	if content == nil {
+		return ""
 	}
-	return key
+	return fmt.Sprintf("%x", sha256.Sum256(content))
 }
 
-// checkState looks for an existing state file.
+// checkState locks the deployment and looks for an existing state file.
 //
-// If one does not exist, it is created.
+// The lock is a separate object that is created with a conditional write,
+// so if another process holds it, an error is returned. If unlockId
+// matches the current lock, we take it over to resume a failed deployment.
 //
-// If one exists and there is a lock, an error is returned unless this process
-// owns the lock.  If priorLock matches, then we are in the middle of an update
-// and for some reason we needed to re-check state
-//
-// If one exists and there is no lock, this is an update.
-// Save the state file back with a lock that we own
+// If the state file does not exist, it is created. If it exists, this is
+// an update. Every write to the state file is conditional on the version
+// that we last read or wrote, so changes made by anyone else are detected.
 func checkState(
 	name string,
 	template *cft.Template,
-	bucketName string,
-	priorLock string,
+	backend StateBackend,
 	absPath string,
-	unlockId string) (*StateResult, error) {
+	unlockId string,
+	command string) (*StateResult, error) {
 
 	spinner.Push("Checking state")
-
-	key := getStateFileKey(name)
-	var state *cft.Template
+	defer spinner.Pop()
 
 	result := &StateResult{}
 
-	// TODO: Handle race conditions (which seem unlikely but who knows...)
-	// Double check before writing a lock that someone else didn't grab it?
-	// Want to avoid using another service like DDB for this. Keep it simple.
-
-	obj, err := s3.GetObject(bucketName, key)
-	spinner.Pop()
-	if err != nil {
-
-		// Make sure it's a NotFound error
-		var nf *types.NoSuchKey
-		if !errors.As(err, &nf) {
+	var err error
+	if unlockId != "" {
+		result.Lock, err = takeLock(backend, name, unlockId)
+		if err != nil {
 			return nil, err
 		}
+		fmt.Println("Unlocking the locked state file")
+	} else {
+		result.Lock = newLockInfo(command)
+		if err := acquireLock(backend, name, result.Lock); err != nil {
+			return nil, err
+		}
+	}
+
+	// Release a lock that we just acquired if anything goes wrong
+	fail := func(err error) (*StateResult, error) {
+		if unlockId == "" {
+			if releaseErr := releaseLock(backend, name, result.Lock); releaseErr != nil {
+				config.Debugf("unable to release lock: %v", releaseErr)
+			}
+		}
+		return nil, err
+	}
+
+	obj, etag, err := backend.Get(name)
+	if err != nil {
+		return fail(err)
+	}
+	result.StateHash = stateHash(obj)
 
+	if obj == nil {
 		config.Debugf("No state file found, creating")
 
-		// This is a create operation. Create a state file and lock it.
-		spinner.Push("Creating a new state file")
-		lock := uuid.New().String()
-		config.Debugf("Creating new state file with lock %v", lock)
-		state = &cft.Template{Node: node.Clone(template.Node)}
+		// This is a create operation. Create a state file.
+		state := &cft.Template{Node: node.Clone(template.Node)}
 		result.StateFile = state
-		result.Lock = lock
 		result.IsUpdate = false
 
 		// Edit the state template to add a new top level "State" section
 		stateMap := cft.AppendStateMap(state)
 
-		// Lock it
-		node.Add(stateMap, "Lock", lock)
-
 		// Add common elements
 		addCommon(stateMap, absPath)
 
-		// Write the state file to the bucket
+		// Write the state file, unless someone else created it
 		str := format.String(state, format.Options{JSON: false, Unsorted: false})
-		err := s3.PutObject(bucketName, key, []byte(str))
-		spinner.Pop()
+		result.ETag, err = backend.Put(name, []byte(str), "")
 		if err != nil {
-			return nil, fmt.Errorf("unable to write state to bucket: %v", err)
+			return fail(fmt.Errorf("unable to write state: %w", err))
 		}
 
-		config.Debugf("State file created with lock: %v", lock)
+		config.Debugf("State file created with lock: %v", result.Lock.Id)
 
 	} else {
-		// The state file exists. Inspect it to see if it's locked
+		// The state file exists, so this is an update
 
 		config.Debugf("Found existing state file")
 
 		state, err := parse.String(string(obj))
 		if err != nil {
-			return nil, fmt.Errorf("unable to parse state file: %v", err)
+			return fail(fmt.Errorf("unable to parse state file: %v", err))
 		}
 
 		_, stateMap, _ := s11n.GetMapValue(state.Node.Content[0], "State")
 		if stateMap == nil {
-			return nil, fmt.Errorf("did not find State in state file")
+			return fail(fmt.Errorf("did not find State in state file"))
 		}
 
 		result.StateFile = state
 		result.IsUpdate = true
-		lock := ""
-		for i, s := range stateMap.Content {
-			if s.Kind == yaml.ScalarNode && s.Value == "Lock" {
-				lock = stateMap.Content[i+1].Value
-			}
-		}
-		result.Lock = lock
-
-		ignoreLock := false
-		if lock != "" {
-			if unlockId != "" {
-				if lock != unlockId {
-					return nil, fmt.Errorf("unlock %v does not match found lock %v", unlockId, lock)
-				} else {
-					fmt.Println("Unlocking the locked state file")
-					ignoreLock = true
-				}
-			} else {
-				msg := fmt.Sprintf("Found a locked state file (lock: %v). This means another process is currently deploying this template, or a deployment failed to complete. You will need to manually resolve the issue, or you can try to resume the deployment by running cc deploy with --unlock <lock>", lock)
-				return nil, errors.New(msg)
+
+		// Older versions of rain stored the lock in the state file
+		_, legacyLock, _ := s11n.GetMapValue(stateMap, "Lock")
+		if legacyLock != nil && legacyLock.Value != "" {
+			if legacyLock.Value != unlockId {
+				return fail(fmt.Errorf("found a locked state file (lock: %v). Run cc deploy with --unlock %v to resume the deployment", legacyLock.Value, legacyLock.Value))
 			}
+			node.RemoveFromMap(stateMap, "Lock")
 		}
 
 		// Check to see if the deployment has drifted
-		if err := runDriftOnState(name, state, bucketName, key); err != nil {
-			return nil, err
-		}
-
-		// We are safe to proceed with an update.
-		// Write a new lock back to the state file stored in S3.
-		// If we're unlocking to continue a failed deployment, leave it
-		// since we would need to re-lock it here anyway
-		if !ignoreLock {
-			lock = uuid.New().String()
-			node.Add(stateMap, "Lock", lock)
+		spinner.Pause()
+		etag, err = runDriftOnState(name, state, backend, etag)
+		spinner.Resume()
+		if err != nil {
+			return fail(err)
 		}
 
 		// Add common elements
 		addCommon(stateMap, absPath)
 
 		str := format.String(state, format.Options{JSON: false, Unsorted: false})
-		err = s3.PutObject(bucketName, key, []byte(str))
+		result.ETag, err = backend.Put(name, []byte(str), etag)
 		if err != nil {
-			return nil, fmt.Errorf("unable to write updated state file to bucket: %v", err)
+			return fail(fmt.Errorf("unable to write updated state file: %w", err))
 		}
-		config.Debugf("State file updated with lock: %v", lock)
+		config.Debugf("State file updated with lock: %v", result.Lock.Id)
 	}
 
 	return result, nil
@@ -197,13 +208,17 @@ func checkState(
 
 // writeState writes updated state to the state file in S3 and unlocks it
 // The state passed in should be the original template, since we will
-// overwrite state with current values.
+// overwrite state with current values. The resolved outputs and the
+// exports that the template imports are recorded along with the resources.
 func writeState(
 	state *cft.Template,
 	results *DeploymentResults,
-	bucketName string,
+	outputs []Output,
+	imports []string,
+	backend StateBackend,
 	name string,
-	absPath string) error {
+	absPath string,
+	stateResult *StateResult) error {
 
 	original := format.String(state, format.Options{JSON: false, Unsorted: false})
 	config.Debugf("writeState original template: %v", original)
@@ -213,6 +228,7 @@ func writeState(
 		node.Add(stateMap, "LastWriteTime", time.Now().Format(time.RFC3339))
 		addCommon(stateMap, absPath)
 		resourceModels := node.AddMap(stateMap, "ResourceModels")
+		addOutputs(stateMap, outputs, imports)
 
 		// Iterate over each resource in the results.
 		// Add a State section to the state resource and write the resource model
@@ -240,31 +256,42 @@ func writeState(
 				return fmt.Errorf("did not find %v in the state template", name)
 			}
 
-			resourceStateMap := node.AddMap(resourceModels, name)
-			node.Add(resourceStateMap, "Identifier", resource.Identifier)
-			modelMap := node.AddMap(resourceStateMap, "Model")
-			var parsed map[string]any
-			json.Unmarshal([]byte(resource.Model), &parsed)
-			var n yaml.Node
-			err := n.Encode(parsed)
+			err := addResourceModel(resourceModels, name, resource.Identifier, resource.Model)
 			if err != nil {
 				return err
 			}
-			modelMap.Content = append(modelMap.Content, n.Content...)
 		}
 	}
 
 	str := format.String(state, format.Options{JSON: false, Unsorted: false})
 	config.Debugf("About to write state file:\n%v", str)
-	key := getStateFileKey(name)
-	err := s3.PutObject(bucketName, key, []byte(str))
+	_, err := backend.Put(name, []byte(str), stateResult.ETag)
 	if err != nil {
-		return fmt.Errorf("unable to write unlocked state file to bucket: %v", err)
+		return fmt.Errorf("unable to write unlocked state file: %w", err)
 	}
 
+	return releaseLock(backend, name, stateResult.Lock)
+}
+
+// addResourceModel records the identifier and the JSON model
+// of a resource in State.ResourceModels
+func addResourceModel(resourceModels *yaml.Node, name string, identifier string, model string) error {
+	resourceStateMap := node.AddMap(resourceModels, name)
+	node.Add(resourceStateMap, "Identifier", identifier)
+	modelMap := node.AddMap(resourceStateMap, "Model")
+	var parsed map[string]any
+	json.Unmarshal([]byte(model), &parsed)
+	var n yaml.Node
+	err := n.Encode(parsed)
+	if err != nil {
+		return err
+	}
+	modelMap.Content = append(modelMap.Content, n.Content...)
 	return nil
 }
 
+var showLock bool
+
 // run is the cobra command for rain cc state
 func runState(cmd *cobra.Command, args []string) {
 	name := args[0]
@@ -273,16 +300,34 @@ func runState(cmd *cobra.Command, args []string) {
 		panic("Please add the --experimental arg to use this feature")
 	}
 
-	// Call RainBucket for side-effects in case we want to force bucket creation
-	bucketName := s3.RainBucket(false)
+	backend := getBackend(false)
 
-	key := getStateFileKey(name)
+	if showLock {
+		lock, err := backend.ReadLock(name)
+		if err != nil {
+			panic(fmt.Errorf("unable to read lock: %v", err))
+		}
+		if lock == nil {
+			fmt.Printf("Deployment %s is not locked\n", name)
+			return
+		}
+		out, err := yaml.Marshal(lock)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(string(out))
+		return
+	}
 
-	obj, err := s3.GetObject(bucketName, key)
+	obj, _, err := backend.Get(name)
 	if err != nil {
 		fmt.Printf("Unable to download state: %v", err)
 		return
 	}
+	if obj == nil {
+		fmt.Printf("Deployment %s does not exist\n", name)
+		return
+	}
 
 	fmt.Println(string(obj))
 }
@@ -291,6 +336,11 @@ var CCStateCmd = &cobra.Command{
 	Use:   "state <name>",
 	Short: "Download the state file for a template deployed with cc deploy",
 	Long: `When deploying templates with the cc command, a state file is created and stored in the rain assets bucket. This command outputs the contents of that file.
+
+Use --show-lock to show who holds the lock on the deployment instead.
+
+The subcommands list the resources in the state file and make changes to it, like renaming
+or forgetting a resource, without changing the live resources.
 `,
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
@@ -298,5 +348,6 @@ var CCStateCmd = &cobra.Command{
 }
 
 func init() {
+	CCStateCmd.Flags().BoolVar(&showLock, "show-lock", false, "show the lock on the deployment instead of the state file")
 	addCommonParams(CCStateCmd)
 }
@@ -0,0 +1,515 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/console"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+	"github.com/aws-cloudformation/rain/internal/table"
+	"github.com/aws-cloudformation/rain/internal/ui"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// visitRefs calls fn for each logical id that is referenced in n, with
+// Ref, Fn::GetAtt, Fn::Sub, or DependsOn, and replaces the logical id
+// with the name that fn returns
+func visitRefs(n *yaml.Node, fn func(name string) string) {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			visitRefs(c, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			val := n.Content[i+1]
+			switch {
+			case key == "Ref" && val.Kind == yaml.ScalarNode:
+				if !strings.HasPrefix(val.Value, AWS_PREFIX) {
+					val.Value = fn(val.Value)
+				}
+			case key == "Fn::GetAtt" && val.Kind == yaml.ScalarNode:
+				left, right, found := strings.Cut(val.Value, ".")
+				if found {
+					val.Value = fn(left) + "." + right
+				}
+			case key == "Fn::GetAtt" && val.Kind == yaml.SequenceNode && len(val.Content) > 0:
+				val.Content[0].Value = fn(val.Content[0].Value)
+			case key == "Fn::Sub" && val.Kind == yaml.ScalarNode:
+				val.Value = visitSubRefs(val.Value, nil, fn)
+			case key == "Fn::Sub" && val.Kind == yaml.SequenceNode && len(val.Content) == 2:
+				// Names in the variable map are not logical ids
+				vars := make([]string, 0)
+				for j := 0; j < len(val.Content[1].Content); j += 2 {
+					vars = append(vars, val.Content[1].Content[j].Value)
+				}
+				val.Content[0].Value = visitSubRefs(val.Content[0].Value, vars, fn)
+				visitRefs(val.Content[1], fn)
+			case key == "DependsOn" && val.Kind == yaml.ScalarNode:
+				val.Value = fn(val.Value)
+			case key == "DependsOn" && val.Kind == yaml.SequenceNode:
+				for _, d := range val.Content {
+					d.Value = fn(d.Value)
+				}
+			default:
+				visitRefs(val, fn)
+			}
+		}
+	}
+}
+
+// subVariable matches ${Name} and ${Name.Attribute}, but not ${!Literal}
+var subVariable = regexp.MustCompile(`\$\{([^!}.][^}.]*)(\.[^}]*)?\}`)
+
+// visitSubRefs calls fn for each logical id in a Sub string,
+// except for the names of variables in the Sub's variable map
+func visitSubRefs(sub string, vars []string, fn func(name string) string) string {
+	return subVariable.ReplaceAllStringFunc(sub, func(m string) string {
+		parts := subVariable.FindStringSubmatch(m)
+		name := strings.TrimSpace(parts[1])
+		if strings.HasPrefix(name, AWS_PREFIX) || slices.Contains(vars, name) {
+			return m
+		}
+		return "${" + fn(name) + parts[2] + "}"
+	})
+}
+
+// stateSections returns the Resources and State.ResourceModels
+// sections of a state file
+func stateSections(state *cft.Template) (*yaml.Node, *yaml.Node, error) {
+	if state.Node == nil || len(state.Node.Content) == 0 || state.Node.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, errors.New("expected the state file to be a mapping")
+	}
+	rootMap := state.Node.Content[0]
+	_, resources, _ := s11n.GetMapValue(rootMap, string(cft.Resources))
+	if resources == nil || resources.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("expected the state file to have a Resources section")
+	}
+	_, stateMap, _ := s11n.GetMapValue(rootMap, string(cft.State))
+	if stateMap == nil || stateMap.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("expected the state file to have a State section")
+	}
+	_, models, _ := s11n.GetMapValue(stateMap, "ResourceModels")
+	if models == nil {
+		// A deployment with no resources
+		models = node.AddMap(stateMap, "ResourceModels")
+	}
+	if models.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("expected State.ResourceModels to be a mapping")
+	}
+	return resources, models, nil
+}
+
+// validateState checks the structure of a state file before it is written.
+// Each resource must have a Type and a model with an identifier, each model
+// must belong to a resource, and resources can only refer to each other.
+func validateState(state *cft.Template) error {
+	resources, models, err := stateSections(state)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		name := resources.Content[i].Value
+		decl := resources.Content[i+1]
+		if names[name] {
+			return fmt.Errorf("resource %s is declared more than once", name)
+		}
+		names[name] = true
+		if decl.Kind != yaml.MappingNode {
+			return fmt.Errorf("expected resource %s to be a mapping", name)
+		}
+		if _, t, _ := s11n.GetMapValue(decl, "Type"); t == nil || t.Value == "" {
+			return fmt.Errorf("resource %s does not have a Type", name)
+		}
+		_, model, _ := s11n.GetMapValue(models, name)
+		if model == nil || model.Kind != yaml.MappingNode {
+			return fmt.Errorf("resource %s does not have a model in State.ResourceModels", name)
+		}
+		if _, id, _ := s11n.GetMapValue(model, "Identifier"); id == nil || id.Value == "" {
+			return fmt.Errorf("resource %s does not have an Identifier in State.ResourceModels", name)
+		}
+		if _, m, _ := s11n.GetMapValue(model, "Model"); m == nil || m.Kind != yaml.MappingNode {
+			return fmt.Errorf("resource %s does not have a Model in State.ResourceModels", name)
+		}
+	}
+
+	for i := 0; i+1 < len(models.Content); i += 2 {
+		if !names[models.Content[i].Value] {
+			return fmt.Errorf("State.ResourceModels has %s, which is not in Resources", models.Content[i].Value)
+		}
+	}
+
+	// Parameters can be referenced too
+	params := make(map[string]bool)
+	if p, err := state.GetSection(cft.Parameters); err == nil {
+		for i := 0; i+1 < len(p.Content); i += 2 {
+			params[p.Content[i].Value] = true
+		}
+	}
+
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		name := resources.Content[i].Value
+		missing := make([]string, 0)
+		visitRefs(resources.Content[i+1], func(ref string) string {
+			if !names[ref] && !params[ref] && !slices.Contains(missing, ref) {
+				missing = append(missing, ref)
+			}
+			return ref
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("resource %s refers to %s, which is not in the state file",
+				name, strings.Join(missing, ", "))
+		}
+	}
+
+	return nil
+}
+
+// renameStateResource changes the logical id of a resource in the state
+// file, along with the references to it. The live resource is not changed.
+func renameStateResource(state *cft.Template, from string, to string) error {
+	resources, models, err := stateSections(state)
+	if err != nil {
+		return err
+	}
+
+	if _, existing, _ := s11n.GetMapValue(resources, to); existing != nil {
+		return fmt.Errorf("resource %s already exists", to)
+	}
+	k, _, _ := s11n.GetMapValue(resources, from)
+	if k == nil {
+		return fmt.Errorf("resource %s is not in the state file", from)
+	}
+	k.Value = to
+	if mk, _, _ := s11n.GetMapValue(models, from); mk != nil {
+		mk.Value = to
+	}
+
+	rename := func(name string) string {
+		if name == from {
+			return to
+		}
+		return name
+	}
+	for i := 1; i < len(resources.Content); i += 2 {
+		visitRefs(resources.Content[i], rename)
+	}
+	if outputs, err := state.GetSection(cft.Outputs); err == nil {
+		for i := 1; i < len(outputs.Content); i += 2 {
+			visitRefs(outputs.Content[i], rename)
+		}
+	}
+
+	return nil
+}
+
+// removeStateResources forgets resources in the state file, without
+// deleting them. Resources that are still in the state file can't refer
+// to the ones that are removed.
+func removeStateResources(state *cft.Template, names []string) error {
+	resources, models, err := stateSections(state)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, decl, _ := s11n.GetMapValue(resources, name); decl == nil {
+			return fmt.Errorf("resource %s is not in the state file", name)
+		}
+	}
+
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		name := resources.Content[i].Value
+		if slices.Contains(names, name) {
+			continue
+		}
+		visitRefs(resources.Content[i+1], func(ref string) string {
+			if slices.Contains(names, ref) && err == nil {
+				err = fmt.Errorf("unable to remove %s, since %s refers to it", ref, name)
+			}
+			return ref
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		node.RemoveFromMap(resources, name)
+		node.RemoveFromMap(models, name)
+	}
+
+	return nil
+}
+
+// editState locks a deployment, applies an edit to its state file,
+// validates the result, and writes it
+func editState(backend StateBackend, name string, command string, edit func(state *cft.Template) error) error {
+	lock := newLockInfo(command)
+	if err := acquireLock(backend, name, lock); err != nil {
+		return err
+	}
+
+	err := func() error {
+		obj, etag, err := backend.Get(name)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			return fmt.Errorf("deployment %s does not exist", name)
+		}
+		state, err := parse.String(string(obj))
+		if err != nil {
+			return fmt.Errorf("unable to parse state file: %v", err)
+		}
+
+		if err := edit(state); err != nil {
+			return err
+		}
+		if err := validateState(state); err != nil {
+			return fmt.Errorf("the state file is not valid: %v", err)
+		}
+
+		_, stateMap, _ := s11n.GetMapValue(state.Node.Content[0], string(cft.State))
+		if _, lastWrite, _ := s11n.GetMapValue(stateMap, "LastWriteTime"); lastWrite != nil {
+			lastWrite.Value = time.Now().Format(time.RFC3339)
+		} else {
+			node.Add(stateMap, "LastWriteTime", time.Now().Format(time.RFC3339))
+		}
+
+		str := format.String(state, format.Options{JSON: false, Unsorted: false})
+		_, err = backend.Put(name, []byte(str), etag)
+		if err != nil {
+			return fmt.Errorf("unable to write state file: %w", err)
+		}
+		return nil
+	}()
+
+	if releaseErr := releaseLock(backend, name, lock); releaseErr != nil && err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+func runStateShow(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	state, _, err := readState(name, getReadOnlyBackend())
+	if err != nil {
+		panic(fmt.Errorf("unable to read state file: %v", err))
+	}
+	if state == nil {
+		panic(fmt.Errorf("deployment %s does not exist", name))
+	}
+	resources, models, err := stateSections(state)
+	if err != nil {
+		panic(err)
+	}
+
+	tbl := table.New("LogicalId", "Type", "Identifier")
+	headerFmt := color.New(color.FgBlue, color.Underline).SprintfFunc()
+	tbl.WithHeaderFormatter(headerFmt)
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		logicalId := resources.Content[i].Value
+		var t, ident string
+		if _, n, _ := s11n.GetMapValue(resources.Content[i+1], "Type"); n != nil {
+			t = n.Value
+		}
+		_, model, _ := s11n.GetMapValue(models, logicalId)
+		if _, n, _ := s11n.GetMapValue(model, "Identifier"); n != nil {
+			ident = n.Value
+		}
+		tbl.AddRow(logicalId, t, ident)
+	}
+	tbl.Print()
+}
+
+func runStateMv(cmd *cobra.Command, args []string) {
+	name, from, to := args[0], args[1], args[2]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	err := editState(getBackend(false), name, cmd.CommandPath(), func(state *cft.Template) error {
+		return renameStateResource(state, from, to)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Renamed %s to %s in %s. Rename it in the template before you deploy again.\n", from, to, name)
+}
+
+func runStateRm(cmd *cobra.Command, args []string) {
+	name := args[0]
+	logicalIds := args[1:]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	err := editState(getBackend(false), name, cmd.CommandPath(), func(state *cft.Template) error {
+		if err := removeStateResources(state, logicalIds); err != nil {
+			return err
+		}
+		if !yes && !console.Confirm(false, fmt.Sprintf(
+			"Forget %s? The resources will not be deleted, but cc will no longer manage them.",
+			strings.Join(logicalIds, ", "))) {
+			return errors.New("state rm cancelled")
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Removed %s from %s. Remove the same resources from the template before you deploy again.\n",
+		strings.Join(logicalIds, ", "), name)
+}
+
+func runStatePull(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	content, _, err := getReadOnlyBackend().Get(name)
+	if err != nil {
+		panic(fmt.Errorf("unable to read state file: %v", err))
+	}
+	if content == nil {
+		panic(fmt.Errorf("deployment %s does not exist", name))
+	}
+
+	if len(args) < 2 {
+		fmt.Print(string(content))
+		return
+	}
+	if err := os.WriteFile(args[1], content, 0644); err != nil {
+		panic(err)
+	}
+	fmt.Printf("Wrote the state file for %s to %s\n", name, args[1])
+}
+
+func runStatePush(cmd *cobra.Command, args []string) {
+	name, fn := args[0], args[1]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	content, err := os.ReadFile(fn)
+	if err != nil {
+		panic(err)
+	}
+	pushed, err := parse.String(string(content))
+	if err != nil {
+		panic(fmt.Errorf("unable to parse %s: %v", fn, err))
+	}
+	if err := validateState(pushed); err != nil {
+		panic(fmt.Errorf("%s is not a valid state file: %v", fn, err))
+	}
+
+	err = editState(getBackend(false), name, cmd.CommandPath(), func(state *cft.Template) error {
+		d := diff.New(state, pushed)
+		if d.Mode() == diff.Unchanged {
+			return errors.New("the state file has not changed")
+		}
+		fmt.Print(ui.ColouriseDiff(d, false))
+		if !yes && !console.Confirm(false, "Replace the state file?") {
+			return errors.New("state push cancelled")
+		}
+		state.Node = pushed.Node
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Replaced the state file for %s\n", name)
+}
+
+var CCStateShowCmd = &cobra.Command{
+	Use:                   "show <name>",
+	Short:                 "List the resources in a deployment and their identifiers",
+	Long:                  "Lists the logical id, type, and primary identifier of each resource in the state file for the deployment <name>.",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   runStateShow,
+}
+
+var CCStateMvCmd = &cobra.Command{
+	Use:   "mv <name> <from> <to>",
+	Short: "Rename a resource in the state file",
+	Long: `Changes the logical id of a resource in the state file for the deployment <name> from <from> to <to>,
+along with any references to it. The live resource is not changed.
+
+Rename the resource in the template too, so that the next deployment does not replace it.
+`,
+	Args:                  cobra.ExactArgs(3),
+	DisableFlagsInUseLine: true,
+	Run:                   runStateMv,
+}
+
+var CCStateRmCmd = &cobra.Command{
+	Use:   "rm <name> <logicalid>...",
+	Short: "Forget resources without deleting them",
+	Long: `Removes resources from the state file for the deployment <name>. The live resources are not deleted,
+and cc deploy will no longer manage them. Resources that refer to them have to be removed at the same time.
+
+Remove the resources from the template too, or the next deployment will create them again.
+`,
+	Args:                  cobra.MinimumNArgs(2),
+	DisableFlagsInUseLine: true,
+	Run:                   runStateRm,
+}
+
+var CCStatePullCmd = &cobra.Command{
+	Use:                   "pull <name> [file]",
+	Short:                 "Download the state file so that it can be edited",
+	Long:                  "Writes the state file for the deployment <name> to [file], or to stdout. After editing it, upload it with cc state push.",
+	Args:                  cobra.RangeArgs(1, 2),
+	DisableFlagsInUseLine: true,
+	Run:                   runStatePull,
+}
+
+var CCStatePushCmd = &cobra.Command{
+	Use:   "push <name> <file>",
+	Short: "Replace the state file with an edited copy",
+	Long: `Replaces the state file for the deployment <name> with <file>, after checking that it is a valid
+state file and showing what changed. The deployment is locked while the state file is replaced.
+`,
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	Run:                   runStatePush,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{CCStateShowCmd, CCStateMvCmd, CCStateRmCmd, CCStatePullCmd, CCStatePushCmd} {
+		addCommonParams(c)
+		CCStateCmd.AddCommand(c)
+	}
+	CCStateRmCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask questions; just remove")
+	CCStatePushCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask questions; just replace")
+}
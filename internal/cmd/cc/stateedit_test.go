@@ -0,0 +1,206 @@
+package cc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/s11n"
+)
+
+const editStateSource = `
+Parameters:
+    Prefix:
+        Type: String
+Resources:
+    Bucket:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !Sub ${Prefix}-bucket
+    Policy:
+        Type: AWS::S3::BucketPolicy
+        DependsOn: [Bucket]
+        Properties:
+            Bucket: !Ref Bucket
+            PolicyDocument:
+                Resource: !Sub
+                    - ${Bucket.Arn}/${Bucket}/${!Bucket}
+                    - Other: x
+    Alias:
+        Type: AWS::S3::Bucket
+        Properties:
+            BucketName: !Sub
+                - ${Bucket}
+                - Bucket: not-a-ref
+Outputs:
+    Arn:
+        Value: !GetAtt Bucket.Arn
+State:
+    LastWriteTime: "2026-01-01T00:00:00Z"
+    ResourceModels:
+        Bucket:
+            Identifier: b
+            Model:
+                BucketName: p-bucket
+        Policy:
+            Identifier: p
+            Model: {}
+        Alias:
+            Identifier: a
+            Model: {}
+`
+
+func parseEditState(t *testing.T) *cft.Template {
+	state, err := parse.String(editStateSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateState(state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestValidateState(t *testing.T) {
+	cases := map[string]string{
+		"Identifier: b":                               "Identifier: ''",
+		"Type: AWS::S3::BucketPolicy":                 "Foo: bar",
+		"Bucket: !Ref Bucket":                         "Bucket: !Ref Missing",
+		"        Alias:\n            Identifier: a\n": "        Alias:\n            Identifier: a\n        Extra:\n            Identifier: e\n            Model: {}\n",
+	}
+	for old, bad := range cases {
+		state, err := parse.String(strings.Replace(editStateSource, old, bad, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validateState(state); err == nil {
+			t.Errorf("expected replacing %q with %q to be invalid", old, bad)
+		}
+	}
+}
+
+func TestRenameStateResource(t *testing.T) {
+	state := parseEditState(t)
+
+	if err := renameStateResource(state, "Bucket", "Alias"); err == nil {
+		t.Error("expected renaming to an existing resource to fail")
+	}
+	if err := renameStateResource(state, "Missing", "Other"); err == nil {
+		t.Error("expected renaming a missing resource to fail")
+	}
+
+	if err := renameStateResource(state, "Bucket", "Logs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	out := format.String(state, format.Options{})
+	for _, expected := range []string{
+		"DependsOn: [Logs]",
+		"Bucket: !Ref Logs",
+		"${Logs.Arn}/${Logs}/${!Bucket}",
+		"BucketName: !Sub\n        - ${Bucket}",
+		"Value: !GetAtt Logs.Arn",
+		"    Logs:\n      Identifier: b",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestRemoveStateResources(t *testing.T) {
+	state := parseEditState(t)
+
+	if err := removeStateResources(state, []string{"Bucket"}); err == nil {
+		t.Error("expected removing a resource that Policy refers to to fail")
+	}
+
+	if err := removeStateResources(state, []string{"Policy", "Bucket"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateState(state); err != nil {
+		t.Fatal(err)
+	}
+	resources, models, _ := stateSections(state)
+	if len(resources.Content) != 2 || len(models.Content) != 2 {
+		t.Errorf("expected only Alias to be left")
+	}
+}
+
+func TestEditState(t *testing.T) {
+	backend := &fileBackend{dir: t.TempDir()}
+	if _, err := backend.Put("test", []byte(editStateSource), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// An edit that leaves the state invalid is not written
+	err := editState(backend, "test", "test", func(state *cft.Template) error {
+		resources, _, _ := stateSections(state)
+		_, bucket, _ := s11n.GetMapValue(resources, "Bucket")
+		bucket.Content = nil
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an invalid edit to fail")
+	}
+	content, _, _ := backend.Get("test")
+	if string(content) != editStateSource {
+		t.Error("expected the state file not to change")
+	}
+
+	err = editState(backend, "test", "test", func(state *cft.Template) error {
+		return renameStateResource(state, "Alias", "Copy")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, _, err := readState("test", backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.GetResource("Copy"); err != nil {
+		t.Error("expected Alias to be renamed")
+	}
+
+	// The lock is released
+	if lock, err := backend.ReadLock("test"); err != nil || lock != nil {
+		t.Errorf("expected the deployment to be unlocked, got %v, %v", lock, err)
+	}
+}
+
+func TestValidateConditionalState(t *testing.T) {
+	useFakeClient(t, 10)
+
+	// Logs is not deployed, and Bucket only refers to it
+	// in the value of a Fn::If that is not chosen
+	template := setTestTemplate(t, conditionsSource, []string{"Env=dev"})
+	if err := applyConditions(template); err != nil {
+		t.Fatal(err)
+	}
+	results, err := DeployTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Succeeded {
+		t.Fatal("expected deployment to succeed")
+	}
+	state, err := resultState(nil, template, results, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateState(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameStateResource(state, "Bucket", "Data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateState(state); err != nil {
+		t.Errorf("expected the state to be valid after a rename: %v", err)
+	}
+}
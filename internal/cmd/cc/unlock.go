@@ -0,0 +1,54 @@
+package cc
+
+import (
+	"fmt"
+
+	"github.com/aws-cloudformation/rain/internal/console"
+	"github.com/spf13/cobra"
+)
+
+func runUnlock(cmd *cobra.Command, args []string) {
+	name := args[0]
+	lockId := args[1]
+
+	if !Experimental {
+		panic("Please add the --experimental arg to use this feature")
+	}
+
+	backend := getBackend(false)
+
+	lock, err := takeLock(backend, name, lockId)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Deployment %s is locked by %v\n", name, lock)
+	if !yes && !console.Confirm(false, "Removing the lock while another process is deploying can corrupt the state file. Continue?") {
+		panic(fmt.Errorf("unlock cancelled: '%s'", name))
+	}
+
+	err = releaseLock(backend, name, lock)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Deployment %s is unlocked\n", name)
+}
+
+var CCUnlockCmd = &cobra.Command{
+	Use:   "unlock <name> <lockid>",
+	Short: "Remove the lock on a deployment created by cc deploy",
+	Long: `Removes the lock on the deployment <name>, which is left in place when a deployment fails to complete.
+The lock is only removed if its id matches <lockid>. Use cc state --show-lock to see the lock.
+
+Only remove a lock when you are sure that no other process is deploying <name>.
+`,
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	Run:                   runUnlock,
+}
+
+func init() {
+	CCUnlockCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask questions; just unlock")
+	addCommonParams(CCUnlockCmd)
+}
@@ -103,6 +103,18 @@ func update(stateTemplate *cft.Template, template *cft.Template) (*cft.Template,
 		}
 	}
 
+	// Resources whose type or create-only properties changed have to be
+	// replaced, and resources that refer to them have to be updated
+	replaced, refUpdates := planReplacements(stateResourceMap, newResourceMap)
+	for k := range replaced {
+		actions[k] = Replace
+	}
+	for k := range refUpdates {
+		if actions[k] == diff.None {
+			actions[k] = diff.Update
+		}
+	}
+
 	// Iterate over the diff and add actions to the output file
 	for k, v := range actions {
 		rmap, ok := resourceActionStates[k]
@@ -144,6 +156,12 @@ func update(stateTemplate *cft.Template, template *cft.Template) (*cft.Template,
 				modelMap.Content = model.Content
 			}
 
+			// Record the type of the resource that is being replaced,
+			// so that it can be deleted once the new one is created
+			if v == Replace {
+				node.Add(rmap, "ReplacedType", resourceType(stateResources[k]))
+			}
+
 			// Add PriorJson to represent the prior properties set by the user
 			if v == diff.Update {
 				priorProps := ccapi.ToJsonProps(stateResources[k])
@@ -245,6 +263,7 @@ func summarizeChanges(changes *cft.Template) {
 	fmt.Println("Review the resources that are about to be deployed")
 	fmt.Println()
 
+	snapshots := make([]string, 0)
 	tbl := table.New("Action", "Type", "LogicalId", "Identifier")
 	headerFmt := color.New(color.FgBlue, color.Underline).SprintfFunc()
 	tbl.WithHeaderFormatter(headerFmt)
@@ -287,8 +306,15 @@ func summarizeChanges(changes *cft.Template) {
 				formatter = createFormat
 			case "Update":
 				formatter = updateFormat
+			case "Replace":
+				formatter = replaceFormat
 			case "Delete":
 				formatter = deleteFormat
+				if retain, _ := retainOnDelete(resourceMap.Content[i+1], false); retain {
+					action = "Delete (Retain)"
+				} else if hasSnapshotPolicy(resourceMap.Content[i+1]) {
+					snapshots = append(snapshots, name)
+				}
 			default:
 				formatter = nil
 			}
@@ -297,4 +323,5 @@ func summarizeChanges(changes *cft.Template) {
 	}
 	tbl.Print()
 	fmt.Println()
+	warnSnapshots(snapshots)
 }
@@ -100,6 +100,7 @@ To list and delete changesets, use the ls and rm commands.
 		var err error
 		var stack types.Stack
 		var templateNode *yaml.Node
+		var sources cftpkg.SourceMap
 
 		if changeset {
 
@@ -126,6 +127,9 @@ To list and delete changesets, use the ls and rm commands.
 				changeSetName = args[2]
 			}
 
+			// Custom directives are told which stack they are packaging for
+			cftpkg.StackName = dc.GetStackName(suppliedStackName, base)
+
 			// Package template
 			if experimental {
 				cftpkg.Experimental = true
@@ -133,6 +137,7 @@ To list and delete changesets, use the ls and rm commands.
 			spinner.Push(fmt.Sprintf("Preparing template '%s'", base))
 			template := PackageTemplate(fn, yes)
 			templateNode = template.Node
+			sources = cftpkg.Sources
 			spinner.Pop()
 
 			// Before deploying, check to see if there are any Metadata sections.
@@ -269,6 +274,10 @@ To list and delete changesets, use the ls and rm commands.
 			} else if status == "IMPORT_COMPLETE" {
 				fmt.Println(console.Green("Successfully imported " + stackName))
 			} else {
+				if locations := formatSourceLocations(stackName, sources); locations != "" {
+					fmt.Println(console.Yellow("Source locations of failed resources:"))
+					fmt.Print(locations)
+				}
 				panic(fmt.Errorf("failed deploying stack '%s'", stackName))
 			}
 		}
@@ -352,4 +361,8 @@ func init() {
 	Cmd.Flags().BoolVar(&experimental, "experimental", false, "Acknowledge that you want to deploy with an experimental feature")
 	Cmd.Flags().BoolVar(&includeNested, "nested-change-set", true, "Whether or not to include nested stacks in the change set")
 	Cmd.Flags().BoolVar(&cftpkg.NoAnalytics, "no-analytics", false, "Do not write analytics to Metadata")
+	Cmd.Flags().BoolVar(&cftpkg.Offline, "offline", false, "Only use modules and packages that are already in the module cache")
+	Cmd.Flags().BoolVar(&cftpkg.UpdateLock, "update-lock", false, "Accept changes to remote modules and packages and update "+cftpkg.LockFileName)
+	Cmd.Flags().IntVar(&cftpkg.UploadConcurrency, "upload-concurrency", cftpkg.UploadConcurrency, "Number of assets to upload to S3 at the same time")
+	Cmd.Flags().StringVar(&cftpkg.DirectivesFile, "directives", "", "YAML file that maps custom directives to the executables that implement them")
 }
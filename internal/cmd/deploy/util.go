@@ -85,11 +85,20 @@ func PackageTemplate(fn string, yes bool) *cft.Template {
 	// Call RainBucket for side-effects in case we want to force bucket creation
 	s3.RainBucket(yes)
 
+	// Make sure remote modules have not changed since they were locked
+	pkg.LockFile = pkg.LockPath(fn)
+
 	t, err := pkg.File(fn)
 	if err != nil {
 		panic(ui.Errorf(err, "error packaging template '%s'", fn))
 	}
 
+	if pkg.Assets.Uploaded+pkg.Assets.Reused > 0 {
+		spinner.Pause()
+		fmt.Println(pkg.Assets.String())
+		spinner.Resume()
+	}
+
 	return t
 }
 
@@ -140,3 +149,59 @@ func CheckStack(stackName string) (types.Stack, bool) {
 
 	return stack, stackExists
 }
+
+// failedResources returns the logical ids of resources that failed during
+// the most recent stack operation. Events are listed newest first.
+func failedResources(stackName string, events []types.StackEvent) []string {
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, event := range events {
+		id := ptr.ToString(event.LogicalResourceId)
+		status := string(event.ResourceStatus)
+
+		if id == stackName {
+			// Stop at the start of the operation
+			if ptr.ToString(event.ResourceStatusReason) == "User Initiated" {
+				break
+			}
+			continue
+		}
+
+		if strings.HasSuffix(status, "_FAILED") && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// formatSourceLocations returns the source file and line of each resource that
+// failed to deploy, so that errors in modules can be traced back to the module
+func formatSourceLocations(stackName string, sources pkg.SourceMap) string {
+	if len(sources) == 0 {
+		return ""
+	}
+
+	events, err := cfn.GetStackEvents(stackName)
+	if err != nil {
+		config.Debugf("unable to get stack events for %s: %v", stackName, err)
+		return ""
+	}
+
+	out := strings.Builder{}
+	for _, id := range failedResources(stackName, events) {
+		source, ok := sources[id]
+		if !ok {
+			continue
+		}
+		if source.Module != "" {
+			out.WriteString(fmt.Sprintf("  - %s: %s (module %s)\n", id, source.Location(), source.Module))
+		} else {
+			out.WriteString(fmt.Sprintf("  - %s: %s\n", id, source.Location()))
+		}
+	}
+
+	return out.String()
+}
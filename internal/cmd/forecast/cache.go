@@ -0,0 +1,119 @@
+package forecast
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws-cloudformation/rain/internal/aws/cfn"
+	"github.com/aws-cloudformation/rain/internal/aws/ec2"
+	"github.com/aws-cloudformation/rain/internal/aws/iam"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// lookupCache stores the results of AWS lookups for the duration of a single
+// forecast run. Many resources in a template make the same calls, for example
+// to get the permissions for a type or to simulate the same action on the
+// same ARN, so we only make each call once.
+type lookupCache struct {
+	mu      sync.Mutex
+	entries map[string]*lookupEntry
+}
+
+// lookupEntry is a single cached result. done is closed when the
+// value is ready, so that concurrent callers wait for the first call
+// instead of making their own.
+type lookupEntry struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+func newLookupCache() *lookupCache {
+	return &lookupCache{entries: make(map[string]*lookupEntry)}
+}
+
+// lookups is the cache for the current forecast run
+var lookups = newLookupCache()
+
+// cached returns the result of fn, calling it only once for each key
+func cached[T any](c *lookupCache, key string, fn func() (T, error)) (T, error) {
+	c.mu.Lock()
+	entry, found := c.entries[key]
+	if !found {
+		entry = &lookupEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	if found {
+		<-entry.done
+	} else {
+		v, err := fn()
+		entry.value = v
+		entry.err = err
+		close(entry.done)
+	}
+
+	v, _ := entry.value.(T)
+	return v, entry.err
+}
+
+// getTypePermissions is a cached version of cfn.GetTypePermissions
+func getTypePermissions(typeName string, verb string) ([]string, error) {
+	return cached(lookups, fmt.Sprintf("permissions|%s|%s", typeName, verb),
+		func() ([]string, error) {
+			return cfn.GetTypePermissions(typeName, verb)
+		})
+}
+
+// simulation is the result of simulating a single IAM action
+type simulation struct {
+	allowed  bool
+	messages []string
+}
+
+// simulateAction is a cached version of iam.SimulateAction
+func simulateAction(action string, resourceArn string, roleArn string) (bool, []string, error) {
+	key := strings.Join([]string{"simulate", action, resourceArn, roleArn}, "|")
+	sim, err := cached(lookups, key, func() (simulation, error) {
+		allowed, messages, err := iam.SimulateAction(action, resourceArn, roleArn)
+		return simulation{allowed, messages}, err
+	})
+	return sim.allowed, sim.messages, err
+}
+
+// checkKeyPairExists is a cached version of ec2.CheckKeyPairExists
+func checkKeyPairExists(name string) (bool, error) {
+	return cached(lookups, "ec2-key-pair|"+name, func() (bool, error) {
+		return ec2.CheckKeyPairExists(name)
+	})
+}
+
+// getInstanceType is a cached version of ec2.GetInstanceType
+func getInstanceType(instanceType string) (*types.InstanceTypeInfo, error) {
+	return cached(lookups, "ec2-instance-type|"+instanceType, func() (*types.InstanceTypeInfo, error) {
+		return ec2.GetInstanceType(instanceType)
+	})
+}
+
+// getImage is a cached version of ec2.GetImage
+func getImage(imageId string) (*types.Image, error) {
+	return cached(lookups, "ec2-image|"+imageId, func() (*types.Image, error) {
+		return ec2.GetImage(imageId)
+	})
+}
+
+// getInstanceTypesForArchitecture is a cached version of ec2.GetInstanceTypesForArchitecture
+func getInstanceTypesForArchitecture(architecture string) ([]string, error) {
+	return cached(lookups, "ec2-arch|"+architecture, func() ([]string, error) {
+		return ec2.GetInstanceTypesForArchitecture(architecture)
+	})
+}
+
+// getDefaultVPCId is a cached version of ec2.GetDefaultVPCId
+func getDefaultVPCId() (string, error) {
+	return cached(lookups, "ec2-default-vpc", func() (string, error) {
+		return ec2.GetDefaultVPCId()
+	})
+}
@@ -0,0 +1,91 @@
+package forecast
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fc "github.com/aws-cloudformation/rain/plugins/forecast"
+)
+
+func TestCached(t *testing.T) {
+	c := newLookupCache()
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cached(c, "key", func() (string, error) {
+				calls.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return "value", nil
+			})
+			if err != nil || v != "value" {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %v", calls.Load())
+	}
+
+	// Errors are cached too
+	_, err := cached(c, "err", func() (int, error) {
+		return 0, fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	_, err = cached(c, "err", func() (int, error) {
+		t.Errorf("expected the error to be cached")
+		return 0, nil
+	})
+	if err == nil {
+		t.Errorf("expected the cached error")
+	}
+}
+
+func TestRunForecastersOrder(t *testing.T) {
+	pluginOnly = true
+	Parallel = 4
+	defer func() {
+		pluginOnly = false
+		pluginForecasters = make(map[string]func(input fc.PredictionInput) fc.Forecast)
+	}()
+
+	// Make earlier resources take longer so they finish last
+	pluginForecasters = map[string]func(input fc.PredictionInput) fc.Forecast{
+		"A::B::C": func(input fc.PredictionInput) fc.Forecast {
+			forecast := fc.MakeForecast(&input)
+			var n int
+			fmt.Sscanf(input.LogicalId, "R%d", &n)
+			time.Sleep(time.Duration(20-n) * time.Millisecond)
+			forecast.Add("CODE", true, input.LogicalId, 0)
+			return forecast
+		},
+	}
+
+	inputs := make([]fc.PredictionInput, 0)
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, fc.PredictionInput{
+			TypeName:  "A::B::C",
+			LogicalId: fmt.Sprintf("R%d", i),
+		})
+	}
+
+	results := runForecasters(inputs)
+	if len(results) != len(inputs) {
+		t.Fatalf("expected %v results, got %v", len(inputs), len(results))
+	}
+	for i, r := range results {
+		if len(r.Passed) != 1 || r.LogicalId != inputs[i].LogicalId {
+			t.Errorf("result %v is out of order: %+v", i, r.Passed)
+		}
+	}
+}
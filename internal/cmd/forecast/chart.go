@@ -0,0 +1,144 @@
+package forecast
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	_ "embed"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/graph"
+	"github.com/aws-cloudformation/rain/internal/config"
+)
+
+//go:embed chart-template.html
+var chartTemplate string
+
+// TimelineEntry is a single row in the predicted deployment timeline.
+// Start and End are the number of seconds since the beginning of the stack action.
+type TimelineEntry struct {
+	Id       string
+	Type     string
+	Start    int
+	End      int
+	Critical bool
+}
+
+// PredictTimeline schedules each resource in the template to start as soon
+// as all of its dependencies have finished, using the historical estimates
+// for each resource type. Resources on the longest path through the
+// dependency graph are marked as Critical. When the stack is being deleted,
+// each resource waits for the resources that depend on it instead.
+func PredictTimeline(t *cft.Template, action StackAction) []TimelineEntry {
+
+	g := graph.New(t)
+
+	entries := make(map[string]*TimelineEntry)
+
+	// predecessor is the dependency that finishes last, which is the one
+	// that determines when a resource can start
+	predecessor := make(map[string]string)
+
+	// Deletes run in the opposite direction from creates and updates
+	waitsFor := g.Get
+	if action == Delete {
+		waitsFor = g.GetReverse
+	}
+
+	var schedule func(n graph.Node) *TimelineEntry
+	schedule = func(n graph.Node) *TimelineEntry {
+		if e, ok := entries[n.Name]; ok {
+			return e
+		}
+
+		resourceType := getResourceType(t, n.Name)
+		if resourceType == "" {
+			panic(fmt.Sprintf("unexpected: no Type for %v", n.Name))
+		}
+
+		duration, err := GetResourceEstimate(resourceType, action)
+		if err != nil {
+			config.Debugf("no estimate for %v", resourceType)
+			duration = 0
+		}
+
+		e := &TimelineEntry{Id: n.Name, Type: resourceType}
+
+		// Store the entry before diving so that a circular
+		// dependency does not recurse forever
+		entries[n.Name] = e
+
+		for _, d := range waitsFor(n) {
+			if d.Type != "Resources" {
+				continue
+			}
+			de := schedule(d)
+			if de.End > e.Start {
+				e.Start = de.End
+				predecessor[n.Name] = d.Name
+			}
+		}
+
+		e.End = e.Start + duration
+
+		return e
+	}
+
+	var last *TimelineEntry
+	for _, n := range g.Nodes() {
+		if n.Type != "Resources" {
+			continue
+		}
+		e := schedule(n)
+		if last == nil || e.End > last.End {
+			last = e
+		}
+	}
+
+	// Walk back from the resource that finishes last to mark the critical path
+	if last != nil {
+		name := last.Id
+		for name != "" {
+			entries[name].Critical = true
+			name = predecessor[name]
+		}
+	}
+
+	retval := make([]TimelineEntry, 0, len(entries))
+	for _, e := range entries {
+		retval = append(retval, *e)
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		if retval[i].Start == retval[j].Start {
+			return retval[i].Id < retval[j].Id
+		}
+		return retval[i].Start < retval[j].Start
+	})
+
+	return retval
+}
+
+// createChart returns an html document with a gantt chart that shows
+// the predicted duration of each resource in the template
+func createChart(t *cft.Template, stackName string, action StackAction) (string, error) {
+
+	timeline := PredictTimeline(t, action)
+
+	data, err := json.Marshal(timeline)
+	if err != nil {
+		return "", err
+	}
+
+	title, err := json.Marshal(fmt.Sprintf("%s (%s)", stackName, action))
+	if err != nil {
+		return "", err
+	}
+
+	rendered := strings.Replace(chartTemplate, "__DATA__", string(data), 1)
+	rendered = strings.Replace(rendered, "__TITLE__", string(title), 1)
+
+	return rendered, nil
+}
@@ -5,10 +5,8 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/aws-cloudformation/rain/internal/aws/ec2"
 	"github.com/aws-cloudformation/rain/internal/aws/ssm"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 	"gopkg.in/yaml.v3"
@@ -41,7 +39,7 @@ func checkKeyName(input *fc.PredictionInput, forecast *fc.Forecast) {
 			// Check to see if the key exists
 			spin(input.TypeName, input.LogicalId, "EC2 instance key exists?")
 
-			exists, _ := ec2.CheckKeyPairExists(keyName)
+			exists, _ := checkKeyPairExists(keyName)
 			code := F0007
 			if exists {
 				forecast.Add(code, true, "Key exists", getLineNum(input.LogicalId, input.Resource))
@@ -49,7 +47,7 @@ func checkKeyName(input *fc.PredictionInput, forecast *fc.Forecast) {
 				forecast.Add(code, false, "Key does not exist", getLineNum(input.LogicalId, input.Resource))
 			}
 
-			spinner.Pop()
+			unspin()
 		} else {
 			config.Debugf("%s.KeyName is empty", input.LogicalId)
 		}
@@ -114,17 +112,17 @@ func checkInstanceType(input *fc.PredictionInput, forecast *fc.Forecast) {
 
 	// Call the DescribeInstanceTypes API to get the instance type info
 	spin(input.TypeName, input.LogicalId, "EC2 instance type exists?")
-	instanceTypeInfo, err := ec2.GetInstanceType(instanceType)
+	instanceTypeInfo, err := getInstanceType(instanceType)
 	if err != nil {
 		config.Debugf("GetInstanceType %s: %v", instanceType, err)
 		forecast.Add(code, false, fmt.Sprintf("Instance type does not exist: %s", instanceType),
 			getLineNum(input.LogicalId, input.Resource))
-		spinner.Pop()
+		unspin()
 		return
 	} else {
 		forecast.Add(code, true, "Instance type exists", getLineNum(input.LogicalId, input.Resource))
 	}
-	spinner.Pop()
+	unspin()
 
 	config.Debugf("instanceTypeInfo: %+v", instanceTypeInfo)
 
@@ -139,20 +137,20 @@ func checkInstanceType(input *fc.PredictionInput, forecast *fc.Forecast) {
 	imageId := resolveImageId(imageIdNode.Value)
 
 	spin(input.TypeName, input.LogicalId, "EC2 instance type matches AMI?")
-	image, err := ec2.GetImage(imageId)
+	image, err := getImage(imageId)
 	if err != nil {
 		forecast.Add(F0009, false, fmt.Sprintf("Image not found: %s", imageId),
 			getLineNum(input.LogicalId, input.Resource))
-		spinner.Pop()
+		unspin()
 		return
 	}
 
 	config.Debugf("Image for %s: %+v", input.LogicalId, image)
 
-	instanceTypesForArch, err := ec2.GetInstanceTypesForArchitecture(string(image.Architecture))
+	instanceTypesForArch, err := getInstanceTypesForArchitecture(string(image.Architecture))
 	if err != nil {
 		config.Debugf("failed to get instance types for architecture %s: %v", image.Architecture, err)
-		spinner.Pop()
+		unspin()
 		return
 	}
 	config.Debugf("instanceTypesForArch: %+v", instanceTypesForArch)
@@ -166,7 +164,7 @@ func checkInstanceType(input *fc.PredictionInput, forecast *fc.Forecast) {
 		forecast.Add(code, true, "Instance type matches AMI",
 			getLineNum(input.LogicalId, input.Resource))
 	}
-	spinner.Pop()
+	unspin()
 }
 
 func getPropNode(input *fc.PredictionInput) *yaml.Node {
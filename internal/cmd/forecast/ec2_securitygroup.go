@@ -4,9 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aws-cloudformation/rain/cft"
-	"github.com/aws-cloudformation/rain/internal/aws/ec2"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 	"gopkg.in/yaml.v3"
@@ -33,7 +31,7 @@ func CheckEC2SecurityGroup(input fc.PredictionInput) fc.Forecast {
 
 	spin(input.TypeName, input.LogicalId, "Checking if all security groups are in the same VPC")
 	checkSecurityGroupsInSameVPC(&input, &forecast)
-	spinner.Pop()
+	unspin()
 
 	return forecast
 
@@ -68,7 +66,7 @@ func checkSecurityGroupsInSameVPC(input *fc.PredictionInput, forecast *fc.Foreca
 	code := F0010
 
 	// Get the default VPC
-	defaultVPCId, err := ec2.GetDefaultVPCId()
+	defaultVPCId, err := getDefaultVPCId()
 	if err != nil {
 		msg := fmt.Sprintf("Unable to get default VPC Id: %v", err)
 		forecast.Add(code, false, msg, getLineNum(input.LogicalId, input.Resource))
@@ -3,7 +3,6 @@ package forecast
 import (
 	"github.com/aws-cloudformation/rain/internal/aws/acm"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/node"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
@@ -49,7 +48,7 @@ func CheckELBListener(input fc.PredictionInput) fc.Forecast {
 		ok, err := acm.CheckCertificate(certArn)
 		if err != nil {
 			config.Debugf("Error checking certArn %s: %s", certArn, err)
-			spinner.Pop()
+			unspin()
 			return forecast
 		}
 		code := F0012
@@ -61,7 +60,7 @@ func CheckELBListener(input fc.PredictionInput) fc.Forecast {
 		}
 	}
 
-	spinner.Pop()
+	unspin()
 
 	return forecast
 }
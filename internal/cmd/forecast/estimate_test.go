@@ -87,3 +87,115 @@ Resources:
 	}
 
 }
+
+const timelineTemplate = `
+Resources:
+
+  A:
+    Type: AWS::S3::Bucket
+    DependsOn: B
+
+  B:
+    Type: AWS::S3::BucketPolicy
+    DependsOn: E
+
+  C:
+    Type: AWS::EC2::Instance
+    DependsOn: [B, D]
+
+  D:
+    Type: AWS::EC2::LaunchTemplate
+    DependsOn: E
+
+  E:
+    Type: AWS::S3::Bucket
+
+  F:
+    Type: AWS::S3::Bucket
+`
+
+func TestPredictTimeline(t *testing.T) {
+	tt, err := parse.String(timelineTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeline := PredictTimeline(tt, Create)
+	if len(timeline) != 6 {
+		t.Fatalf("expected 6 entries, got %v", len(timeline))
+	}
+
+	byId := make(map[string]TimelineEntry)
+	end := 0
+	for _, e := range timeline {
+		byId[e.Id] = e
+		if e.End > end {
+			end = e.End
+		}
+	}
+
+	// The end of the timeline should match the total estimate
+	total := PredictTotalEstimate(tt, false)
+	if end != total {
+		t.Errorf("expected timeline to end at %v, got %v", total, end)
+	}
+
+	// Nothing depends on E or F, so they start right away
+	if byId["E"].Start != 0 || byId["F"].Start != 0 {
+		t.Errorf("expected E and F to start at 0: %+v %+v", byId["E"], byId["F"])
+	}
+
+	// C waits for the later of B and D
+	if byId["C"].Start != max(byId["B"].End, byId["D"].End) {
+		t.Errorf("expected C to start after B and D: %+v", byId["C"])
+	}
+
+	// A-B-E is the longest path
+	for _, id := range []string{"A", "B", "E"} {
+		if !byId[id].Critical {
+			t.Errorf("expected %v to be on the critical path", id)
+		}
+	}
+	for _, id := range []string{"C", "D", "F"} {
+		if byId[id].Critical {
+			t.Errorf("expected %v to not be on the critical path", id)
+		}
+	}
+}
+
+func TestPredictDeleteTimeline(t *testing.T) {
+	tt, err := parse.String(timelineTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeline := PredictTimeline(tt, Delete)
+	if len(timeline) != 6 {
+		t.Fatalf("expected 6 entries, got %v", len(timeline))
+	}
+
+	byId := make(map[string]TimelineEntry)
+	for _, e := range timeline {
+		byId[e.Id] = e
+	}
+
+	// Nothing depends on A, C or F, so they are deleted right away
+	for _, id := range []string{"A", "C", "F"} {
+		if byId[id].Start != 0 {
+			t.Errorf("expected %v to start at 0: %+v", id, byId[id])
+		}
+	}
+
+	// B waits for A and C, which depend on it
+	if byId["B"].Start != max(byId["A"].End, byId["C"].End) {
+		t.Errorf("expected B to start after A and C: %+v", byId["B"])
+	}
+
+	// E is deleted last, after B and D
+	if byId["E"].Start != max(byId["B"].End, byId["D"].End) {
+		t.Errorf("expected E to start after B and D: %+v", byId["E"])
+	}
+	if !byId["E"].Critical {
+		t.Errorf("expected E to be on the critical path")
+	}
+}
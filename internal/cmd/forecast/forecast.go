@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"plugin"
 	"strings"
+	"sync"
 
 	"github.com/aws-cloudformation/rain/cft"
 	"github.com/aws-cloudformation/rain/cft/format"
@@ -63,6 +64,16 @@ var pluginPath string
 // Only run predictions from the plugin, don't run any of the built in checks
 var pluginOnly bool
 
+// Output a gantt chart of the predicted deployment timeline instead of running checks
+var chart bool
+
+// Parallel is the maximum number of resources to check at the same time (--parallel)
+var Parallel int
+
+// quietSpinner is set while forecasters run concurrently. The spinner shows a
+// stack of messages, which only makes sense when one resource is checked at a time.
+var quietSpinner bool
+
 const (
 	ALL    = "all"
 	CREATE = "create"
@@ -72,6 +83,9 @@ const (
 
 var lineNums = make(map[string]int)
 
+// sourceFiles has the module files for resources that were emitted by modules
+var sourceFiles = make(map[string]string)
+
 // GetNode is a simplified version of s11n.GetMapValue that returns the value only
 func GetNode(prop *yaml.Node, name string) *yaml.Node {
 	_, n, _ := s11n.GetMapValue(prop, name)
@@ -86,9 +100,20 @@ var pluginForecasters = make(map[string]func(input fc.PredictionInput) fc.Foreca
 
 // Push a message about checking a resource onto the spinner
 func spin(typeName string, logicalId string, message string) {
+	if quietSpinner {
+		return
+	}
 	spinner.Push(fmt.Sprintf("%v %v - %v", typeName, logicalId, message))
 }
 
+// Pop the most recent message pushed by spin
+func unspin() {
+	if quietSpinner {
+		return
+	}
+	spinner.Pop()
+}
+
 // getLineNum returns the line number for the resource
 // It checks the lineNums map first and falls back to the yaml node Line
 func getLineNum(logicalId string, resource *yaml.Node) int {
@@ -113,9 +138,6 @@ func forecastForType(input fc.PredictionInput) fc.Forecast {
 		return forecast
 	}
 
-	// Resolve parameter refs
-	resolveRefs(input)
-
 	// Estimate how long the stackActionToEstimate will take
 	// (This is only for spinner output, we calculate total time separately)
 	var stackActionToEstimate StackAction
@@ -131,7 +153,7 @@ func forecastForType(input fc.PredictionInput) fc.Forecast {
 	}
 	config.Debugf("Got resource estimate for %v: %v", input.LogicalId, est)
 	spin(input.TypeName, input.LogicalId, fmt.Sprintf("estimate: %v seconds", est))
-	spinner.Pop()
+	unspin()
 
 	if !pluginOnly {
 		// Call generic prediction functions that we can run against
@@ -150,7 +172,7 @@ func forecastForType(input fc.PredictionInput) fc.Forecast {
 				getLineNum(input.LogicalId, input.Resource))
 		}
 
-		spinner.Pop()
+		unspin()
 	}
 
 	if !pluginOnly {
@@ -192,11 +214,86 @@ func forecastForType(input fc.PredictionInput) fc.Forecast {
 		forecast.Append(fn(input))
 	}
 
-	spinner.Pop()
+	unspin()
 
 	return forecast
 }
 
+// runForecasters calls forecastForType for each input, using up to Parallel
+// goroutines. The results are returned in the same order as the inputs.
+func runForecasters(inputs []fc.PredictionInput) []fc.Forecast {
+
+	results := make([]fc.Forecast, len(inputs))
+
+	if Parallel <= 1 || len(inputs) <= 1 {
+		for i, input := range inputs {
+			spinner.Push(fmt.Sprintf("Checking %s: %s", input.TypeName, input.LogicalId))
+			results[i] = forecastForType(input)
+			spinner.Pop()
+		}
+		return results
+	}
+
+	// Only this goroutine updates the spinner while the workers run
+	quietSpinner = true
+	defer func() { quietSpinner = false }()
+
+	jobs := make(chan int)
+	done := make(chan int)
+
+	// A panic in a worker is re-raised here so that it is reported
+	// the same way as a panic in sequential mode
+	var panicked any
+	var panicMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(Parallel, len(inputs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							panicMu.Lock()
+							if panicked == nil {
+								panicked = r
+							}
+							panicMu.Unlock()
+						}
+					}()
+					results[i] = forecastForType(inputs[i])
+				}()
+				done <- i
+			}
+		}()
+	}
+
+	go func() {
+		for i := range inputs {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	count := 0
+	spinner.Push(fmt.Sprintf("Checked %d of %d resources", count, len(inputs)))
+	for range done {
+		count++
+		spinner.Pop()
+		spinner.Push(fmt.Sprintf("Checked %d of %d resources", count, len(inputs)))
+	}
+	spinner.Pop()
+
+	if panicked != nil {
+		panic(panicked)
+	}
+
+	return results
+}
+
 // Query the account to make predictions about deployment failures.
 // Returns true if no failures are predicted.
 func Predict(source *cft.Template, stackName string, stack types.Stack, stackExists bool, dc *deployconfig.DeployConfig) bool {
@@ -217,6 +314,20 @@ func Predict(source *cft.Template, stackName string, stack types.Stack, stackExi
 	// Add the --debug arg to see a json version of the yaml node data model for the template
 	//config.Debugf("node: %v", toJson(rootMap))
 
+	// Start with an empty cache for each run
+	lookups = newLookupCache()
+
+	cfg := aws.Config()
+	callerArn, err := iam.GetCallerArn(cfg) // arn:aws:iam::755952356119:role/Admin
+	if err != nil {
+		panic("unable to get caller arn")
+	}
+	arnTokens := strings.Split(callerArn, ":")
+	if len(arnTokens) != 6 {
+		panic(fmt.Sprintf("unexpected number of tokens in caller arn: %v", callerArn))
+	}
+	env := fc.Env{Partition: arnTokens[1], Region: cfg.Region, Account: arnTokens[4]}
+
 	// Iterate over each resource
 
 	_, resources, _ := s11n.GetMapValue(rootMap, "Resources")
@@ -224,6 +335,8 @@ func Predict(source *cft.Template, stackName string, stack types.Stack, stackExi
 		panic("Expected to find a Resources section in the template")
 	}
 
+	inputs := make([]fc.PredictionInput, 0)
+
 	for i, r := range resources.Content {
 
 		if i%2 != 0 {
@@ -244,8 +357,6 @@ func Predict(source *cft.Template, stackName string, stack types.Stack, stackExi
 		typeName := typeNode.Value // Should be something like AWS::S3::Bucket
 		config.Debugf("typeName: %v", typeName)
 
-		spinner.Push(fmt.Sprintf("Checking %s: %s", typeName, logicalId))
-
 		input := fc.PredictionInput{}
 		input.LogicalId = logicalId
 		input.Source = source
@@ -256,24 +367,24 @@ func Predict(source *cft.Template, stackName string, stack types.Stack, stackExi
 		input.TypeName = typeName
 		input.Dc = dc
 		input.Ignore = fc.Ignore
-		cfg := aws.Config()
-		callerArn, err := iam.GetCallerArn(cfg) // arn:aws:iam::755952356119:role/Admin
-		if err != nil {
-			panic("unable to get caller arn")
-		}
-		arnTokens := strings.Split(callerArn, ":")
-		if len(arnTokens) != 6 {
-			panic(fmt.Sprintf("unexpected number of tokens in caller arn: %v", callerArn))
-		}
-		input.Env = fc.Env{Partition: arnTokens[1], Region: cfg.Region, Account: arnTokens[4]}
+		input.Env = env
 		input.RoleArn = RoleArn
+		input.SourceFile = sourceFiles[logicalId]
 		if input.RoleArn == "" {
 			input.RoleArn = callerArn
 		}
 
-		forecast.Append(forecastForType(input))
+		// Resolve parameter refs before any forecasters run, since
+		// some forecasters look at other resources in the template
+		if ResourceType == "" || ResourceType == typeName {
+			resolveRefs(input)
+		}
 
-		spinner.Pop()
+		inputs = append(inputs, input)
+	}
+
+	for _, f := range runForecasters(inputs) {
+		forecast.Append(f)
 	}
 
 	spinner.Stop()
@@ -381,11 +492,20 @@ resource-specific checks. See the README for more details.
 			lineNums[logicalId] = lineNum
 		}
 
+		pkg.LockFile = pkg.LockPath(fn)
 		source, err := pkg.File(fn)
 		if err != nil {
 			panic(err)
 		}
 
+		// Resources from modules point back to the module file
+		for logicalId, origin := range pkg.Sources {
+			if origin.Module != "" {
+				lineNums[logicalId] = origin.Line
+				sourceFiles[logicalId] = origin.File
+			}
+		}
+
 		// Packaging is necessary if we want to forecast a template with
 		// modules or anything else that needs packaging.
 		// But.. we lost line numbers, so we need to re-parse the file
@@ -419,6 +539,21 @@ resource-specific checks. See the README for more details.
 			panic(fmt.Sprintf("stack %v already exists, action %s is not valid", stackName, action))
 		}
 
+		if chart {
+			chartAction := Create
+			if action == DELETE {
+				chartAction = Delete
+			} else if stackExists {
+				chartAction = Update
+			}
+			rendered, err := createChart(source, stackName, chartAction)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println(rendered)
+			return
+		}
+
 		dc, err := dc.GetDeployConfig(tags, params, configFilePath, base,
 			source, stack, stackExists, true, false)
 		if err != nil {
@@ -465,6 +600,8 @@ func init() {
 	Cmd.Flags().StringSliceVar(&fc.Ignore, "ignore", []string{}, "Resource types and specific codes to ignore, separated by commas, for example, AWS::S3::Bucket,F0002")
 	Cmd.Flags().StringVar(&pluginPath, "plugin", "", "Path to a forecast plugin .so")
 	Cmd.Flags().BoolVar(&pluginOnly, "plugin-only", false, "If set, none of the built in prediction functions will be run")
+	Cmd.Flags().IntVar(&Parallel, "parallel", 8, "The maximum number of resources to check at the same time")
+	Cmd.Flags().BoolVar(&chart, "chart", false, "Output a gantt chart of the predicted deployment timeline as an html file")
 
 	// If you want to add a prediction for a type that is not already covered, add it here
 	// The function must return a Forecast struct
@@ -37,3 +37,17 @@ func TestForecastMethods(t *testing.T) {
 		t.Errorf("Append did not append")
 	}
 }
+
+func TestForecastSourceFile(t *testing.T) {
+	input := fc.PredictionInput{}
+	input.TypeName = "A::B::C"
+	input.LogicalId = "ContentBucket"
+	input.SourceFile = "modules/bucket.yaml"
+	forecast := fc.MakeForecast(&input)
+	forecast.Add("CODE1", false, "Failed", 12)
+
+	expected := "modules/bucket.yaml:12: A::B::C ContentBucket - Failed"
+	if forecast.Failed[0].Message != expected {
+		t.Errorf("Expected %q, got %q", expected, forecast.Failed[0].Message)
+	}
+}
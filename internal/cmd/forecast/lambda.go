@@ -6,7 +6,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/iam"
 	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 	"gopkg.in/yaml.v3"
 )
@@ -25,7 +24,7 @@ func checkLambdaRole(input *fc.PredictionInput, forecast *fc.Forecast) {
 		} else {
 			forecast.Add(F0016, true, "Role exists", lineNum)
 		}
-		spinner.Pop()
+		unspin()
 
 		// Check to make sure the iam role can be assumed by the lambda function
 		spin(input.TypeName, input.LogicalId, "Checking if lambda role can be assumed")
@@ -39,7 +38,7 @@ func checkLambdaRole(input *fc.PredictionInput, forecast *fc.Forecast) {
 				forecast.Add(F0017, true, "Role can be assumed", lineNum)
 			}
 		}
-		spinner.Pop()
+		unspin()
 	}
 }
 
@@ -117,7 +116,7 @@ func checkLambdaS3Bucket(input *fc.PredictionInput, forecast *fc.Forecast) {
 				}
 			}
 
-			spinner.Pop()
+			unspin()
 		} else {
 			config.Debugf("%s does not have S3Bucket and S3Key", input.LogicalId)
 		}
@@ -4,10 +4,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/aws-cloudformation/rain/internal/aws/cfn"
-	"github.com/aws-cloudformation/rain/internal/aws/iam"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 	"golang.org/x/exp/slices"
 )
@@ -19,8 +16,9 @@ func checkTypePermissions(input fc.PredictionInput, resourceArn string, verb str
 	spin(input.TypeName, input.LogicalId, "permitted?")
 
 	// Go get the list of permissions from the registry
-	actions, err := cfn.GetTypePermissions(input.TypeName, verb)
+	actions, err := getTypePermissions(input.TypeName, verb)
 	if err != nil {
+		unspin()
 		return false, []string{err.Error()}
 	}
 
@@ -69,16 +67,27 @@ func checkTypePermissions(input fc.PredictionInput, resourceArn string, verb str
 		}
 	}
 
-	// Update the spinner with the action being checked
-	spinnerCallback := func(action string) {
+	// Simulate the actions one at a time, since we can't easily predict
+	// which of the actions we get from the type description schema have
+	// different authorization types. Results are cached, since many
+	// resources in a template will check the same actions.
+	result := true
+	messages := make([]string, 0)
+	for _, action := range actionsToCheck {
 		spin(input.TypeName, input.LogicalId, action+" permitted?")
+		allowed, actionMessages, err := simulateAction(action, resourceArn, input.RoleArn)
+		unspin()
+		if err != nil {
+			unspin()
+			return false, append(messages, err.Error())
+		}
+		if !allowed {
+			result = false
+		}
+		messages = append(messages, actionMessages...)
 	}
 
-	// Simulate the actions
-	result, messages := iam.Simulate(actionsToCheck,
-		resourceArn, input.RoleArn, spinnerCallback)
-
-	spinner.Pop()
+	unspin()
 	return result, messages
 }
 
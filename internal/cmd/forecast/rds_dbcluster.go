@@ -9,7 +9,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/rds"
 	"github.com/aws-cloudformation/rain/internal/aws/servicequotas"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/node"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
@@ -71,7 +70,7 @@ func CheckRDSDBCluster(input fc.PredictionInput) fc.Forecast {
 		}
 	}
 
-	spinner.Pop()
+	unspin()
 
 	code = F0004
 
@@ -99,7 +98,7 @@ func CheckRDSDBCluster(input fc.PredictionInput) fc.Forecast {
 			getLineNum(input.LogicalId, input.Resource))
 	}
 
-	spinner.Pop()
+	unspin()
 
 	code = F0005
 
@@ -128,7 +127,7 @@ func CheckRDSDBCluster(input fc.PredictionInput) fc.Forecast {
 		}
 	}
 
-	spinner.Pop()
+	unspin()
 
 	code = F0006
 
@@ -178,7 +177,7 @@ func CheckRDSDBCluster(input fc.PredictionInput) fc.Forecast {
 		}
 	}
 
-	spinner.Pop()
+	unspin()
 
 	return forecast
 }
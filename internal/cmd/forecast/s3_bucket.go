@@ -6,7 +6,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/cfn"
 	"github.com/aws-cloudformation/rain/internal/aws/s3"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
@@ -54,7 +53,7 @@ func checkBucketNotEmpty(input fc.PredictionInput, bucket *types.StackResourceDe
 		// (or a similar custom resource? .. not sure how to do this reliably)
 	}
 
-	spinner.Pop()
+	unspin()
 
 	return true, ""
 }
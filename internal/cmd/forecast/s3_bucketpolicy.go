@@ -6,7 +6,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/cfn"
 	"github.com/aws-cloudformation/rain/internal/aws/iam"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 )
@@ -57,7 +56,7 @@ func CheckS3BucketPolicy(input fc.PredictionInput) fc.Forecast {
 		}
 	}
 
-	spinner.Pop()
+	unspin()
 
 	return forecast
 }
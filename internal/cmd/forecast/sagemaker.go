@@ -8,7 +8,6 @@ import (
 	"github.com/aws-cloudformation/rain/internal/aws/sagemaker"
 	"github.com/aws-cloudformation/rain/internal/aws/servicequotas"
 	"github.com/aws-cloudformation/rain/internal/config"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	"github.com/aws-cloudformation/rain/internal/s11n"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 )
@@ -56,7 +55,7 @@ func checkNotebookLimit(input *fc.PredictionInput, forecast *fc.Forecast) {
 	// request an increase for this limit.
 
 	spin(input.TypeName, input.LogicalId, "SageMaker notebook quota ok?")
-	defer spinner.Pop()
+	defer unspin()
 
 	atLimit := false
 
@@ -2,7 +2,6 @@ package forecast
 
 import (
 	"github.com/aws-cloudformation/rain/internal/aws/kms"
-	"github.com/aws-cloudformation/rain/internal/console/spinner"
 	fc "github.com/aws-cloudformation/rain/plugins/forecast"
 )
 
@@ -12,7 +11,7 @@ func CheckSNSTopic(input fc.PredictionInput) fc.Forecast {
 
 	spin(input.TypeName, input.LogicalId, "Checking SNS Topic Key")
 	checkSNSTopicKey(&input, &forecast)
-	spinner.Pop()
+	unspin()
 
 	return forecast
 }
@@ -0,0 +1,268 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var docsOutput string
+var docsForce bool
+
+// docsMarker is the first line of every file that docs writes, so
+// that it only overwrites files that it generated before
+const docsMarker = "<!-- Generated by rain module docs -->\n"
+
+// moduleDoc is a module found in a package directory
+type moduleDoc struct {
+	// Path is the path to the module, relative to the package directory
+	Path string
+	Info *pkg.ModuleInfo
+}
+
+func docs(cmd *cobra.Command, args []string) {
+	dir := args[0]
+	config.Debugf("module docs %s, output %s", dir, docsOutput)
+
+	modules, err := findModules(dir)
+	if err != nil {
+		panic(fmt.Errorf("unable to read modules in %s: %v", dir, err))
+	}
+	if len(modules) == 0 {
+		panic(fmt.Errorf("no modules found in %s", dir))
+	}
+
+	paths := make([]string, 0, len(modules)+1)
+	files := make(map[string]string)
+	for _, m := range modules {
+		out := filepath.Join(docsOutput, mdPath(m.Path))
+		paths = append(paths, out)
+		files[out] = formatMarkdown(m)
+	}
+	out := filepath.Join(docsOutput, "README.md")
+	paths = append(paths, out)
+	files[out] = formatIndex(dir, modules)
+
+	// Check everything before writing anything
+	if !docsForce {
+		for _, p := range paths {
+			if err := checkOverwrite(p); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(p, []byte(docsMarker+files[p]), 0644); err != nil {
+			panic(err)
+		}
+		fmt.Println(p)
+	}
+}
+
+// checkOverwrite returns an error if p exists and was not written by docs
+func checkOverwrite(p string) error {
+	content, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(string(content), docsMarker) {
+		return fmt.Errorf("%s was not generated by rain module docs; use --force to overwrite it", p)
+	}
+	return nil
+}
+
+// findModules returns every module in dir. Files that are not
+// templates, or that have no Resources or Modules, are skipped.
+func findModules(dir string) ([]moduleDoc, error) {
+	modules := make([]moduleDoc, 0)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".yaml", ".yml", ".json", ".template":
+		default:
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		info, err := pkg.InspectModule(content)
+		if err != nil {
+			config.Debugf("Skipping %s: %v", p, err)
+			return nil
+		}
+		if len(info.Resources) == 0 && len(info.Modules) == 0 {
+			config.Debugf("Skipping %s: no Resources or Modules", p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, moduleDoc{filepath.ToSlash(rel), info})
+		return nil
+	})
+
+	return modules, err
+}
+
+// mdPath returns the path to the Markdown page for a module
+func mdPath(modulePath string) string {
+	return strings.TrimSuffix(modulePath, filepath.Ext(modulePath)) + ".md"
+}
+
+// cell escapes text for a Markdown table cell
+func cell(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\n", " ")
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// formatMarkdown returns the reference page for a module
+func formatMarkdown(m moduleDoc) string {
+	var out strings.Builder
+	info := m.Info
+
+	out.WriteString(fmt.Sprintf("# %s\n\n", m.Path))
+	if info.Description != "" {
+		out.WriteString(fmt.Sprintf("%s\n\n", strings.TrimSpace(info.Description)))
+	}
+
+	out.WriteString("## Usage\n\n")
+	out.WriteString("```yaml\nModules:\n")
+	out.WriteString(fmt.Sprintf("  %s:\n", moduleName(m.Path)))
+	out.WriteString(fmt.Sprintf("    Source: ./%s\n", m.Path))
+	required := make([]string, 0)
+	for _, p := range info.Parameters {
+		if !p.HasDefault {
+			required = append(required, p.Name)
+		}
+	}
+	if len(required) > 0 {
+		out.WriteString("    Properties:\n")
+		for _, name := range required {
+			out.WriteString(fmt.Sprintf("      %s: \n", name))
+		}
+	}
+	out.WriteString("```\n")
+
+	if len(info.Parameters) > 0 {
+		out.WriteString("\n## Parameters\n\n")
+		out.WriteString("| Name | Type | Default | Description |\n")
+		out.WriteString("|------|------|---------|-------------|\n")
+		for _, p := range info.Parameters {
+			def := "*required*"
+			if p.HasDefault {
+				def = fmt.Sprintf("`%s`", cell(p.Default))
+			}
+			desc := cell(p.Description)
+			if len(p.AllowedValues) > 0 {
+				if desc != "" {
+					desc += " "
+				}
+				desc += fmt.Sprintf("Allowed values: `%s`", cell(strings.Join(p.AllowedValues, "`, `")))
+			}
+			out.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", p.Name, cell(p.Type), def, desc))
+		}
+	}
+
+	if len(info.Outputs) > 0 {
+		out.WriteString("\n## Outputs\n\n")
+		out.WriteString("| Name | Description |\n")
+		out.WriteString("|------|-------------|\n")
+		for _, o := range info.Outputs {
+			out.WriteString(fmt.Sprintf("| %s | %s |\n", o.Name, cell(o.Description)))
+		}
+	}
+
+	if len(info.Resources) > 0 {
+		out.WriteString("\n## Resources\n\n")
+		out.WriteString("The properties of these resources can be changed with `Overrides`.\n\n")
+		out.WriteString("| Name | Type | Properties |\n")
+		out.WriteString("|------|------|------------|\n")
+		for _, r := range info.Resources {
+			props := ""
+			if len(r.Properties) > 0 {
+				props = "`" + strings.Join(r.Properties, "`, `") + "`"
+			}
+			out.WriteString(fmt.Sprintf("| %s | `%s` | %s |\n", r.Name, r.Type, props))
+		}
+	}
+
+	if len(info.Modules) > 0 {
+		out.WriteString("\n## Modules\n\n")
+		out.WriteString("| Name | Source |\n")
+		out.WriteString("|------|--------|\n")
+		for _, sub := range info.Modules {
+			out.WriteString(fmt.Sprintf("| %s | `%s` |\n", sub.Name, cell(sub.Source)))
+		}
+	}
+
+	return out.String()
+}
+
+// moduleName turns a path like simple-vpc.yaml into a logical id like SimpleVpc
+func moduleName(modulePath string) string {
+	base := strings.TrimSuffix(filepath.Base(modulePath), filepath.Ext(modulePath))
+	name := ""
+	for _, word := range strings.FieldsFunc(base, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+	if name == "" {
+		return "MyModule"
+	}
+	return name
+}
+
+// formatIndex returns the page that lists every module in the package
+func formatIndex(dir string, modules []moduleDoc) string {
+	var out strings.Builder
+
+	out.WriteString(fmt.Sprintf("# %s\n\n", filepath.Base(filepath.Clean(dir))))
+	out.WriteString("| Module | Description |\n")
+	out.WriteString("|--------|-------------|\n")
+	for _, m := range modules {
+		out.WriteString(fmt.Sprintf("| [%s](%s) | %s |\n", m.Path, mdPath(m.Path), cell(m.Info.Description)))
+	}
+
+	return out.String()
+}
+
+var DocsCmd = &cobra.Command{
+	Use:   "docs <dir>",
+	Short: "Generate Markdown reference pages for a directory of modules",
+	Long: `Writes a Markdown page for each module in a package directory, with the module's Parameters,
+Outputs, Resources, and submodules, along with a README.md that lists all of the modules.
+Files in the output directory that were not generated by this command are not overwritten unless --force is set.`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   docs,
+}
+
+func init() {
+	DocsCmd.Flags().StringVarP(&docsOutput, "output", "o", "module-docs", "Directory to write the Markdown files to")
+	DocsCmd.Flags().BoolVar(&docsForce, "force", false, "Overwrite files that were not generated by this command")
+}
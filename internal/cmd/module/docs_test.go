@@ -0,0 +1,34 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckOverwrite(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.md")
+	if err := checkOverwrite(missing); err != nil {
+		t.Errorf("expected a new file to be allowed: %v", err)
+	}
+
+	generated := filepath.Join(dir, "generated.md")
+	if err := os.WriteFile(generated, []byte(docsMarker+"# bucket.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOverwrite(generated); err != nil {
+		t.Errorf("expected a generated file to be overwritten: %v", err)
+	}
+
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# My project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := checkOverwrite(readme)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected a hand-written file to be protected, got %v", err)
+	}
+}
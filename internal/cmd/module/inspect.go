@@ -0,0 +1,113 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/console"
+	"github.com/spf13/cobra"
+)
+
+var inspectTemplate string
+
+func inspect(cmd *cobra.Command, args []string) {
+	source := args[0]
+	config.Debugf("module inspect %s, template %s", source, inspectTemplate)
+
+	content, err := pkg.LoadModule(source, inspectTemplate)
+	if err != nil {
+		panic(fmt.Errorf("unable to load module %s: %v", source, err))
+	}
+
+	info, err := pkg.InspectModule(content)
+	if err != nil {
+		panic(fmt.Errorf("unable to parse module %s: %v", source, err))
+	}
+
+	fmt.Print(formatInfo(source, info))
+}
+
+// formatInfo formats the module interface for the console
+func formatInfo(source string, info *pkg.ModuleInfo) string {
+	var out strings.Builder
+
+	out.WriteString(fmt.Sprintf("%s\n", console.Bold(source)))
+	if info.Description != "" {
+		out.WriteString(fmt.Sprintf("%s\n", info.Description))
+	}
+
+	if len(info.Parameters) > 0 {
+		out.WriteString("\nParameters:\n")
+		for _, p := range info.Parameters {
+			attrs := []string{}
+			if p.Type != "" {
+				attrs = append(attrs, p.Type)
+			}
+			if p.HasDefault {
+				attrs = append(attrs, "default: "+p.Default)
+			} else {
+				attrs = append(attrs, "required")
+			}
+			out.WriteString(fmt.Sprintf("  %s (%s)\n", console.Yellow(p.Name), strings.Join(attrs, ", ")))
+			if p.Description != "" {
+				out.WriteString(fmt.Sprintf("    %s\n", p.Description))
+			}
+			if len(p.AllowedValues) > 0 {
+				out.WriteString(fmt.Sprintf("    Allowed values: %s\n", strings.Join(p.AllowedValues, ", ")))
+			}
+		}
+	}
+
+	if len(info.Outputs) > 0 {
+		out.WriteString("\nOutputs:\n")
+		for _, o := range info.Outputs {
+			out.WriteString(fmt.Sprintf("  %s\n", console.Yellow(o.Name)))
+			if o.Description != "" {
+				out.WriteString(fmt.Sprintf("    %s\n", o.Description))
+			}
+		}
+	}
+
+	if len(info.Resources) > 0 {
+		out.WriteString("\nResources:\n")
+		for _, r := range info.Resources {
+			out.WriteString(fmt.Sprintf("  %s (%s)\n", console.Yellow(r.Name), r.Type))
+			if r.Condition != "" {
+				out.WriteString(fmt.Sprintf("    Condition: %s\n", r.Condition))
+			}
+			if len(r.Properties) > 0 {
+				out.WriteString(fmt.Sprintf("    Properties: %s\n", strings.Join(r.Properties, ", ")))
+			}
+		}
+	}
+
+	if len(info.Modules) > 0 {
+		out.WriteString("\nModules:\n")
+		for _, m := range info.Modules {
+			out.WriteString(fmt.Sprintf("  %s (%s)\n", console.Yellow(m.Name), m.Source))
+		}
+	}
+
+	return out.String()
+}
+
+var InspectCmd = &cobra.Command{
+	Use:   "inspect <source>",
+	Short: "Show the parameters, outputs, and resources of a module",
+	Long: `Shows the interface of a module: its Parameters, which are set with Properties in the parent
+template, its Outputs, the Resources it creates along with the properties that can be overridden,
+and any submodules that it includes.
+
+The source can be a local file, a URL, a git:: URI, or a package alias like $alias/module.yaml.
+Use --template to resolve aliases with the Packages section of a template.`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   inspect,
+}
+
+func init() {
+	InspectCmd.Flags().StringVarP(&inspectTemplate, "template", "t", "", "Template with the Packages that define source aliases")
+	InspectCmd.Flags().BoolVar(&pkg.Offline, "offline", false, "Only use modules and packages that are already in the module cache")
+}
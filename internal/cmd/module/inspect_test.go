@@ -0,0 +1,30 @@
+package module_test
+
+import (
+	"os"
+
+	"github.com/aws-cloudformation/rain/internal/cmd/module"
+)
+
+func Example_inspect() {
+	os.Args = []string{
+		os.Args[0],
+		"inspect",
+		"../../../cft/pkg/tmpl/validate-module.yaml",
+	}
+
+	module.Cmd.Execute()
+	// Output:
+	// ../../../cft/pkg/tmpl/validate-module.yaml
+	//
+	// Parameters:
+	//   Name (String, required)
+	//   Env (String, default: dev)
+	//     Allowed values: dev, prod
+	//   Count (Number, default: 1)
+	//   Ports (List<Number>, default: [80])
+	//
+	// Resources:
+	//   Bucket (AWS::S3::Bucket)
+	//     Properties: BucketName, Tags
+}
@@ -0,0 +1,181 @@
+package module
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws-cloudformation/rain/cft"
+	"github.com/aws-cloudformation/rain/cft/diff"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/cft/pkg"
+	"github.com/aws-cloudformation/rain/internal/config"
+	"github.com/aws-cloudformation/rain/internal/console"
+	"github.com/aws-cloudformation/rain/internal/node"
+	"github.com/aws-cloudformation/rain/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+const (
+	templateSuffix = "-template.yaml"
+	expectSuffix   = "-expect.yaml"
+)
+
+var updateExpected bool
+
+// moduleTest is a template that is packaged and compared with its expected output
+type moduleTest struct {
+	Name     string
+	Template string
+	Expect   string
+}
+
+// testResult is the outcome of a module test
+type testResult struct {
+	Passed  bool
+	Updated bool
+	Diff    diff.Diff
+	Err     error
+}
+
+// findTests returns the template/expect pairs in dir. When update
+// is set, templates that do not have an expect file yet are included.
+func findTests(dir string, update bool) ([]moduleTest, error) {
+	tests := make([]moduleTest, 0)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, templateSuffix) {
+			return nil
+		}
+
+		expect := strings.TrimSuffix(p, templateSuffix) + expectSuffix
+		if _, err := os.Stat(expect); err != nil && !update {
+			config.Debugf("Skipping %s: %s does not exist", p, expect)
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, strings.TrimSuffix(p, templateSuffix))
+		if err != nil {
+			return err
+		}
+		tests = append(tests, moduleTest{filepath.ToSlash(name), p, expect})
+		return nil
+	})
+
+	return tests, err
+}
+
+// stripAnalytics removes the metadata that rain pkg adds to templates
+func stripAnalytics(t *cft.Template) {
+	metadata, err := t.GetSection(cft.Metadata)
+	if err != nil {
+		return
+	}
+	node.RemoveFromMap(metadata, pkg.AWSToolsMetrics)
+	if len(metadata.Content) == 0 {
+		t.RemoveSection(cft.Metadata)
+	}
+}
+
+// run packages the test's template and compares it with the expected output
+func (mt moduleTest) run(update bool) testResult {
+	packaged, err := pkg.File(mt.Template)
+	if err != nil {
+		return testResult{Err: fmt.Errorf("unable to package %s: %v", mt.Template, err)}
+	}
+	stripAnalytics(packaged)
+
+	if _, statErr := os.Stat(mt.Expect); statErr == nil {
+		expected, err := parse.File(mt.Expect)
+		if err != nil {
+			return testResult{Err: fmt.Errorf("unable to parse %s: %v", mt.Expect, err)}
+		}
+		stripAnalytics(expected)
+
+		d := diff.New(expected, packaged)
+		if d.Mode() == diff.Unchanged {
+			return testResult{Passed: true}
+		}
+		if !update {
+			return testResult{Diff: d}
+		}
+	} else if !update {
+		return testResult{Err: statErr}
+	}
+
+	out := format.String(packaged, format.Options{})
+	if err := os.WriteFile(mt.Expect, []byte(out), 0644); err != nil {
+		return testResult{Err: err}
+	}
+	return testResult{Passed: true, Updated: true}
+}
+
+func moduleTests(cmd *cobra.Command, args []string) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	// Analytics are not part of the module's output
+	pkg.NoAnalytics = true
+
+	tests, err := findTests(dir, updateExpected)
+	if err != nil {
+		panic(ui.Errorf(err, "unable to find tests in '%s'", dir))
+	}
+	if len(tests) == 0 {
+		panic(fmt.Errorf("no tests found in %s: expected pairs of files named x%s and x%s",
+			dir, templateSuffix, expectSuffix))
+	}
+
+	failed := 0
+	for _, mt := range tests {
+		result := mt.run(updateExpected)
+		switch {
+		case result.Updated:
+			fmt.Printf("%s %s\n", console.Yellow("UPDATED"), mt.Name)
+		case result.Passed:
+			fmt.Printf("%s %s\n", console.Green("PASS"), mt.Name)
+		default:
+			failed++
+			fmt.Printf("%s %s\n", console.Red("FAIL"), mt.Name)
+			if result.Err != nil {
+				fmt.Printf("  %v\n", result.Err)
+			} else {
+				fmt.Println(strings.TrimRight(ui.Indent("  ", ui.ColouriseDiff(result.Diff, false)), "\n"))
+			}
+		}
+	}
+
+	if failed > 0 {
+		panic(fmt.Errorf("%d of %d module tests failed", failed, len(tests)))
+	}
+}
+
+var TestCmd = &cobra.Command{
+	Use:   "test [dir]",
+	Short: "Package test templates and compare them with the expected output",
+	Long: `Looks for pairs of files named x-template.yaml and x-expect.yaml in dir, which defaults to the
+current directory. Each template is packaged, and the result is compared with the expected template.
+Key order and the analytics that rain adds to Metadata are ignored. Differences are shown for each
+test that fails.
+
+Use --update to write the packaged output to the expect files instead of failing. This also creates
+expect files for templates that do not have one yet.`,
+	Args:                  cobra.MaximumNArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   moduleTests,
+}
+
+func init() {
+	TestCmd.Flags().BoolVar(&updateExpected, "update", false, "Write the packaged output to the expect files")
+	TestCmd.Flags().BoolVarP(&pkg.Experimental, "experimental", "x", false, "Enable experimental features")
+	TestCmd.Flags().BoolVar(&pkg.ExpandLanguageExtensions, "expand-language-extensions", false, "Expand Fn::ForEach and other AWS::LanguageExtensions functions client-side when their inputs are static")
+	TestCmd.Flags().BoolVar(&pkg.Offline, "offline", false, "Only use modules and packages that are already in the module cache")
+}
@@ -0,0 +1,94 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/rain/cft/pkg"
+)
+
+func TestModuleTests(t *testing.T) {
+	pkg.NoAnalytics = true
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"bucket.yaml": `
+Parameters:
+  Name:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Ref Name
+`,
+		"bucket-template.yaml": `
+Modules:
+  Content:
+    Source: ./bucket.yaml
+    Properties:
+      Name: foo
+`,
+		// Key order does not matter
+		"bucket-expect.yaml": `
+Resources:
+  ContentBucket:
+    Properties:
+      BucketName: foo
+    Type: AWS::S3::Bucket
+`,
+		"new-template.yaml": `
+Modules:
+  Content:
+    Source: ./bucket.yaml
+    Properties:
+      Name: bar
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests, err := findTests(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 || tests[0].Name != "bucket" {
+		t.Fatalf("expected only the bucket test, got %+v", tests)
+	}
+	if result := tests[0].run(false); !result.Passed {
+		t.Fatalf("expected bucket to pass: %v %v", result.Err, result.Diff)
+	}
+
+	// A different expected value fails with a diff
+	expect := filepath.Join(dir, "bucket-expect.yaml")
+	os.WriteFile(expect, []byte(strings.Replace(files["bucket-expect.yaml"], "foo", "baz", 1)), 0644)
+	result := tests[0].run(false)
+	if result.Passed || result.Diff == nil {
+		t.Fatalf("expected bucket to fail with a diff")
+	}
+	if !strings.Contains(result.Diff.Format(false), "BucketName") {
+		t.Errorf("expected the diff to show BucketName: %s", result.Diff.Format(false))
+	}
+
+	// Updating regenerates the expect file and creates missing ones
+	tests, err = findTests(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 2 {
+		t.Fatalf("expected 2 tests with update, got %d", len(tests))
+	}
+	for _, mt := range tests {
+		if result := mt.run(true); !result.Updated {
+			t.Errorf("expected %s to be updated: %v", mt.Name, result.Err)
+		}
+		if result := mt.run(false); !result.Passed {
+			t.Errorf("expected %s to pass after the update: %v", mt.Name, result.Err)
+		}
+	}
+}
@@ -15,6 +15,7 @@ var Cmd = &cobra.Command{
 	Use:   "module <command> ",
 	Short: "Interact with Rain modules in CodeArtifact",
 	Long: `The rain module command can be used to publish modules to CodeArtifact, and to install modules from CodeArtifact.
+It can also show the interface of a module with inspect, generate reference documentation for a directory of modules with docs, and run module tests with test.
 
 	You must pass the --experimental (-x) flag to use this command, to acknowledge that it is experimental and likely to be unstable!
 `,
@@ -29,6 +30,8 @@ var version string
 func addCommonParams(c *cobra.Command) {
 	c.Flags().StringVarP(&config.Profile, "profile", "p", "", "AWS profile name; read from the AWS CLI configuration file")
 	c.Flags().StringVarP(&config.Region, "region", "r", "", "AWS region to use")
+	c.Flags().StringVar(&config.RecordDir, "record", "", "Record AWS API calls to a directory so they can be replayed later")
+	c.Flags().StringVar(&config.ReplayDir, "replay", "", "Serve AWS API calls from a directory created with --record instead of calling AWS")
 	c.Flags().BoolVar(&config.Debug, "debug", false, "Output debugging information")
 	c.Flags().BoolVarP(&experimental, "experimental", "x", false, "Acknowledge that this is an experimental feature")
 	c.Flags().StringVar(&domain, "domain", "cloudformation", "The CodeArtifact domain")
@@ -40,4 +43,7 @@ func init() {
 	Cmd.AddCommand(PublishCmd)
 	Cmd.AddCommand(InstallCmd)
 	Cmd.AddCommand(BootstrapCmd)
+	Cmd.AddCommand(InspectCmd)
+	Cmd.AddCommand(DocsCmd)
+	Cmd.AddCommand(TestCmd)
 }
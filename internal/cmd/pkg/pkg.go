@@ -15,6 +15,7 @@ import (
 
 var outFn = ""
 var dataModel bool
+var sourceMapFn = ""
 
 // Experimental is an optional argument that enables experimental features
 var Experimental bool
@@ -42,6 +43,7 @@ You may use the following, rain-specific directives in templates packaged with "
   !Rain::S3 <object>           supply an object with the following properties: 
     Path: <path>               a file or directory to be uploaded to S3
     Zip: true|false            If "true", rain with zip <path> even if it is a file
+    Exclude: [<pattern>]       .gitignore-style patterns for files to leave out of the zip file
     BucketProperty: <bucket>   If you supply "BucketProperty" and "KeyProperty", rain pkg will
     KeyProperty: <key>         include the uploaded file/directory's details as an object in the template
                                with the property names you specify.
@@ -56,6 +58,12 @@ You may use the following, rain-specific directives in templates packaged with "
                                of the module can be used to define additional properties for the extension.
                                This is an experimental directive that must be enabled by adding the 
                                --experimental arg on the command line.
+
+  !Rain::Custom::<Name> <value>
+                               Runs a custom directive, which is an executable that is declared in the
+                               Directives entry of the Rain section, or in a file passed to --directives.
+                               The value and its context are written to stdin as YAML, and the YAML that
+                               the executable writes to stdout replaces the directive.
 `,
 	Args:                  cobra.ExactArgs(1),
 	Aliases:               []string{"package"},
@@ -64,6 +72,7 @@ You may use the following, rain-specific directives in templates packaged with "
 		fn := args[0]
 
 		cftpkg.Experimental = Experimental
+		cftpkg.LockFile = cftpkg.LockPath(fn)
 
 		spinner.Push(fmt.Sprintf("Packaging template '%s'", fn))
 		packaged, err := cftpkg.File(fn)
@@ -72,6 +81,17 @@ You may use the following, rain-specific directives in templates packaged with "
 		}
 		spinner.Pop()
 
+		if cftpkg.Assets.Uploaded+cftpkg.Assets.Reused > 0 {
+			fmt.Fprintln(os.Stderr, cftpkg.Assets.String())
+		}
+
+		if sourceMapFn != "" {
+			err = cftpkg.Sources.Write(sourceMapFn)
+			if err != nil {
+				panic(ui.Errorf(err, "unable to write source map '%s'", sourceMapFn))
+			}
+		}
+
 		var out string
 		if dataModel {
 			out = node.ToJson(packaged.Node)
@@ -94,4 +114,10 @@ func init() {
 	Cmd.Flags().BoolVar(&dataModel, "datamodel", false, "Output the go yaml data model")
 	Cmd.Flags().StringVar(&format.NodeStyle, "node-style", "", format.NodeStyleDocs)
 	Cmd.Flags().BoolVar(&cftpkg.NoAnalytics, "no-analytics", false, "Do not include analytics in Metadata")
+	Cmd.Flags().BoolVar(&cftpkg.Offline, "offline", false, "Only use modules and packages that are already in the module cache")
+	Cmd.Flags().BoolVar(&cftpkg.UpdateLock, "update-lock", false, "Accept changes to remote modules and packages and update "+cftpkg.LockFileName)
+	Cmd.Flags().IntVar(&cftpkg.UploadConcurrency, "upload-concurrency", cftpkg.UploadConcurrency, "Number of assets to upload to S3 at the same time")
+	Cmd.Flags().StringVar(&cftpkg.DirectivesFile, "directives", "", "YAML file that maps custom directives to the executables that implement them")
+	Cmd.Flags().StringVar(&sourceMapFn, "source-map", "", "Write a JSON file that maps each packaged resource to the file and line it came from")
+	Cmd.Flags().BoolVar(&cftpkg.ExpandLanguageExtensions, "expand-language-extensions", false, "Expand Fn::ForEach and other AWS::LanguageExtensions functions client-side when their inputs are static")
 }
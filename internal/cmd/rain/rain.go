@@ -23,6 +23,7 @@ import (
 	"github.com/aws-cloudformation/rain/internal/cmd/merge"
 	"github.com/aws-cloudformation/rain/internal/cmd/module"
 	"github.com/aws-cloudformation/rain/internal/cmd/pkg"
+	"github.com/aws-cloudformation/rain/internal/cmd/render"
 	"github.com/aws-cloudformation/rain/internal/cmd/rm"
 	"github.com/aws-cloudformation/rain/internal/cmd/stackset"
 	"github.com/aws-cloudformation/rain/internal/cmd/tree"
@@ -71,6 +72,8 @@ func addCommand(label string, profileOptions, bucketOptions bool, c *cobra.Comma
 	if profileOptions {
 		c.Flags().StringVarP(&config.Profile, "profile", "p", "", "AWS profile name; read from the AWS CLI configuration file")
 		c.Flags().StringVarP(&config.Region, "region", "r", "", "AWS region to use")
+		c.Flags().StringVar(&config.RecordDir, "record", "", "Record AWS API calls to a directory so they can be replayed later")
+		c.Flags().StringVar(&config.ReplayDir, "replay", "", "Serve AWS API calls from a directory created with --record instead of calling AWS")
 	}
 
 	if bucketOptions {
@@ -100,6 +103,7 @@ func init() {
 	addCommand(templateGroup, false, false, rainfmt.Cmd)
 	addCommand(templateGroup, false, false, merge.Cmd)
 	addCommand(templateGroup, true, true, pkg.Cmd)
+	addCommand(templateGroup, false, false, render.Cmd)
 	addCommand(templateGroup, false, false, tree.Cmd)
 	addCommand(templateGroup, true, false, forecast.Cmd)
 	addCommand(templateGroup, true, false, module.Cmd)
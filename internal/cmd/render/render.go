@@ -0,0 +1,89 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/aws-cloudformation/rain/cft/eval"
+	"github.com/aws-cloudformation/rain/cft/format"
+	"github.com/aws-cloudformation/rain/cft/parse"
+	"github.com/aws-cloudformation/rain/internal/dc"
+	"github.com/aws-cloudformation/rain/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var configFilePath string
+var params []string
+var region string
+var accountId string
+var stackName string
+var azs []string
+var jsonFlag bool
+
+// Cmd is the render command's entrypoint
+var Cmd = &cobra.Command{
+	Use:   "render <template>",
+	Short: "Show the effective template for a set of parameter values",
+	Long: `Evaluates intrinsic functions in <template> using the supplied parameter values and prints the result.
+
+Ref, Fn::Sub, Fn::Join, Fn::Select, Fn::Split, Fn::FindInMap, Fn::If, Fn::Base64,
+Fn::Cidr, Fn::GetAZs and condition functions are evaluated locally, without calling AWS.
+Resources and Outputs with a Condition that is false are removed.
+Anything that can only be known after deployment, like a Ref to a resource or a Fn::GetAtt, is left as it is.
+
+Parameter values are read from a config file in the same format used by "rain deploy --config",
+or from --params. Parameters that are not supplied use their Default value.
+`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		fn := args[0]
+
+		t, err := parse.File(fn)
+		if err != nil {
+			panic(ui.Errorf(err, "unable to parse template '%s'", fn))
+		}
+
+		parameters := make(map[string]string)
+		if configFilePath != "" {
+			parameters, err = dc.ParametersFromFile(configFilePath)
+			if err != nil {
+				panic(err)
+			}
+		}
+		for k, v := range dc.ListToMap("param", params) {
+			parameters[k] = v
+		}
+
+		pseudo := make(map[string]string)
+		if region != "" {
+			pseudo["AWS::Region"] = region
+		}
+		if accountId != "" {
+			pseudo["AWS::AccountId"] = accountId
+		}
+		if stackName != "" {
+			pseudo["AWS::StackName"] = stackName
+		}
+
+		rendered, err := eval.Template(t, eval.Options{
+			Parameters:       parameters,
+			PseudoParameters: pseudo,
+			AZs:              azs,
+		})
+		if err != nil {
+			panic(ui.Errorf(err, "unable to render template '%s'", fn))
+		}
+
+		fmt.Print(format.String(rendered, format.Options{JSON: jsonFlag}))
+	},
+}
+
+func init() {
+	Cmd.Flags().StringVarP(&configFilePath, "config", "c", "", "YAML or JSON file to set parameters")
+	Cmd.Flags().StringSliceVar(&params, "params", []string{}, "set parameter values; use the format key1=value1,key2=value2")
+	Cmd.Flags().StringVar(&region, "region", "", "value for AWS::Region")
+	Cmd.Flags().StringVar(&accountId, "account-id", "", "value for AWS::AccountId")
+	Cmd.Flags().StringVar(&stackName, "stack-name", "", "value for AWS::StackName")
+	Cmd.Flags().StringSliceVar(&azs, "azs", []string{}, "availability zones returned by Fn::GetAZs")
+	Cmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "output as JSON")
+}
@@ -0,0 +1,71 @@
+package render_test
+
+import (
+	"os"
+
+	"github.com/aws-cloudformation/rain/internal/cmd/render"
+)
+
+func Example_render() {
+	os.Args = []string{
+		os.Args[0],
+		"../../../test/templates/condition.yaml",
+		"--params", "EnvType=prod",
+	}
+
+	render.Cmd.Execute()
+	// Output:
+	// AWSTemplateFormatVersion: "2010-09-09"
+	//
+	// Parameters:
+	//   EnvType:
+	//     Description: Environment type.
+	//     Type: String
+	//     AllowedValues:
+	//       - prod
+	//       - test
+	//     Default: test
+	//     ConstraintDescription: must specify prod or test.
+	//
+	// Mappings:
+	//   Map1:
+	//     Key1:
+	//       Name: Val1.1
+	//     Key2:
+	//       Name: Val1.2
+	//
+	//   Map2:
+	//     Key1:
+	//       Name: Val2.1
+	//     Key2:
+	//       Name: Val2.2
+	//
+	// Resources:
+	//   EC2Instance:
+	//     Type: AWS::EC2::Instance
+	//     Properties:
+	//       ImageId: ami-0ff8a91507f77f867
+	//
+	//   MountPoint:
+	//     Type: AWS::EC2::VolumeAttachment
+	//     Properties:
+	//       InstanceId: !Ref EC2Instance
+	//       VolumeId: !Ref NewVolume
+	//       Device: /dev/sdh
+	//
+	//   NewVolume:
+	//     Type: AWS::EC2::Volume
+	//     Properties:
+	//       Size: 100
+	//       AvailabilityZone: !GetAtt EC2Instance.AvailabilityZone
+	//
+	//   Bucket1:
+	//     Type: AWS::S3::Bucket
+	//     Properties:
+	//       BucketName: Val1.1
+	//
+	//   Bucket2:
+	//     Type: AWS::S3::Bucket
+	//     Properties:
+	//       BucketName: Val2.1
+}
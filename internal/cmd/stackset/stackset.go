@@ -38,6 +38,8 @@ func addCommand(profileOptions bool, bucketOptions bool, c *cobra.Command) {
 	if profileOptions {
 		c.Flags().StringVarP(&config.Profile, "profile", "p", "", "AWS profile name; read from the AWS CLI configuration file")
 		c.Flags().StringVarP(&config.Region, "region", "r", "", "AWS region to use")
+		c.Flags().StringVar(&config.RecordDir, "record", "", "Record AWS API calls to a directory so they can be replayed later")
+		c.Flags().StringVar(&config.ReplayDir, "replay", "", "Serve AWS API calls from a directory created with --record instead of calling AWS")
 	}
 	if bucketOptions {
 		c.Flags().StringVar(&s3.BucketName, "s3-bucket", "", "Name of the S3 bucket that is used to upload assets")
@@ -15,6 +15,13 @@ var Profile = ""
 // Region holds the requested AWS region name
 var Region = ""
 
+// RecordDir is a directory where AWS API calls are recorded (--record)
+var RecordDir = ""
+
+// ReplayDir is a directory with recorded AWS API calls that are
+// served instead of calling AWS (--replay)
+var ReplayDir = ""
+
 // Debugf prints messages for stdout only if Debug is true
 func Debugf(message string, parts ...interface{}) {
 	if Debug {
@@ -197,6 +197,41 @@ func ConfigFromStack(stack types.Stack) (string, error) {
 	return string(configFileContent), err
 }
 
+// readConfigFile reads a YAML or JSON file with Parameters and Tags
+func readConfigFile(configFilePath string) (*configFileFormat, error) {
+	configFileContent, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return nil, ui.Errorf(err, "unable to read config file '%s'", configFilePath)
+	}
+
+	var configFile configFileFormat
+	err = yaml.Unmarshal([]byte(configFileContent), &configFile)
+	if err != nil {
+		return nil, ui.Errorf(err, "unable to parse yaml in '%s'", configFilePath)
+	}
+
+	config.Debugf("Parsed config file struct: %+v", configFile)
+
+	return &configFile, nil
+}
+
+// ParametersFromFile returns the parameters in a config file,
+// without asking the user for any values that are missing
+func ParametersFromFile(configFilePath string) (map[string]string, error) {
+	configFile, err := readConfigFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configFile.Parameters) == 0 && len(configFile.LowerParameters) > 0 {
+		return configFile.LowerParameters, nil
+	}
+	if configFile.Parameters == nil {
+		return make(map[string]string), nil
+	}
+	return configFile.Parameters, nil
+}
+
 // GetDeployConfig populates an instance of DeployConfig based on user-supplied values
 func GetDeployConfig(
 	tags []string,
@@ -244,19 +279,11 @@ func GetDeployConfig(
 	}
 
 	if len(configFilePath) != 0 {
-		configFileContent, err := os.ReadFile(configFilePath)
+		configFile, err := readConfigFile(configFilePath)
 		if err != nil {
-			panic(ui.Errorf(err, "unable to read config file '%s'", configFilePath))
+			panic(err)
 		}
 
-		var configFile configFileFormat
-		err = yaml.Unmarshal([]byte(configFileContent), &configFile)
-		if err != nil {
-			panic(ui.Errorf(err, "unable to parse yaml in '%s'", configFilePath))
-		}
-
-		config.Debugf("Parsed config file struct: %+v", configFile)
-
 		configFileTags := configFile.Tags
 		if len(configFileTags) == 0 && len(configFile.LowerTags) > 0 {
 			configFileTags = configFile.LowerTags
@@ -30,6 +30,10 @@ type PredictionInput struct {
 	Env         Env
 	RoleArn     string
 	Ignore      []string
+
+	// SourceFile is the module file that the resource came from, if
+	// it was emitted by a module. Line numbers refer to this file.
+	SourceFile string
 }
 
 // GetPropertyNode returns the node for the given property name
@@ -49,6 +53,10 @@ type Forecast struct {
 	Passed    []Check
 	Failed    []Check
 	Ignore    []string
+
+	// SourceFile is the module file that the resource came from, if any
+	SourceFile string
+
 	// TODO: Errors []error
 	// Instead of config.Debugf, output unexpected errors
 	// Otherwise users won't know if checks are failing to run,
@@ -57,11 +65,12 @@ type Forecast struct {
 
 func MakeForecast(input *PredictionInput) Forecast {
 	return Forecast{
-		TypeName:  input.TypeName,
-		LogicalId: input.LogicalId,
-		Ignore:    input.Ignore,
-		Passed:    make([]Check, 0),
-		Failed:    make([]Check, 0),
+		TypeName:   input.TypeName,
+		LogicalId:  input.LogicalId,
+		Ignore:     input.Ignore,
+		SourceFile: input.SourceFile,
+		Passed:     make([]Check, 0),
+		Failed:     make([]Check, 0),
 	}
 }
 
@@ -91,7 +100,11 @@ func (f *Forecast) Append(forecast Forecast) {
 
 // Add adds a pass or fail message, formatting it to include the type name and logical id
 func (f *Forecast) Add(code string, passed bool, message string, lineNumber int) {
-	msg := fmt.Sprintf("%v: %v %v - %v", lineNumber, f.TypeName, f.LogicalId, message)
+	location := fmt.Sprintf("%v", lineNumber)
+	if f.SourceFile != "" {
+		location = fmt.Sprintf("%s:%v", f.SourceFile, lineNumber)
+	}
+	msg := fmt.Sprintf("%v: %v %v - %v", location, f.TypeName, f.LogicalId, message)
 	check := Check{
 		Pass:    passed,
 		Code:    code,